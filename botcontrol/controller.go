@@ -29,6 +29,27 @@ type BotConfig struct {
 	Prediction      int     `json:"prediction,omitempty"`
 	Multiplier      int     `json:"multiplier,omitempty"`
 	Script          string  `json:"script,omitempty"`
+	WarmupTicks     int     `json:"warmup_ticks,omitempty"`
+
+	// Per-trade multiplier limits (see strategy.Config)
+	TakeProfit       float64 `json:"take_profit,omitempty"`
+	TradeStopLoss    float64 `json:"trade_stop_loss,omitempty"`
+	DealCancellation string  `json:"deal_cancellation,omitempty"`
+	TrailActivation  float64 `json:"trail_activation,omitempty"`
+	TrailDistance    float64 `json:"trail_distance,omitempty"`
+
+	// Early exit rules (see strategy.Config)
+	ExitBidPercent    float64 `json:"exit_bid_percent,omitempty"`
+	ExitAdverseTicks  int     `json:"exit_adverse_ticks,omitempty"`
+	ExitSellTolerance float64 `json:"exit_sell_tolerance,omitempty"`
+
+	// Entry limits (see strategy.Config)
+	MaxOpenPositions int `json:"max_open_positions,omitempty"`
+	MinEntryTicks    int `json:"min_entry_ticks,omitempty"`
+	MinEntrySeconds  int `json:"min_entry_seconds,omitempty"`
+
+	Params     map[string]interface{} `json:"params,omitempty"`
+	ScriptName string                 `json:"script_name,omitempty"`
 }
 
 // BotStatus represents the current bot status
@@ -199,6 +220,12 @@ func (c *Controller) runBot(ctx context.Context) {
 	}
 	defer api.Disconnect()
 
+	account, err := strategy.AuthorizeAccount(api, c.apiToken)
+	if err != nil {
+		log.Printf("Authorization failed: %v", err)
+		return
+	}
+
 	// Create session
 	var sessionID primitive.ObjectID
 	if c.db != nil {
@@ -206,6 +233,11 @@ func (c *Controller) runBot(ctx context.Context) {
 			Strategy:     c.config.Strategy,
 			StartTime:    time.Now(),
 			InitialStake: c.config.InitialStake,
+			LoginID:      account.LoginID,
+		}
+		if c.config.Script != "" {
+			session.ScriptName = c.config.ScriptName
+			session.ScriptHash = strategy.ScriptHash(c.config.Script)
 		}
 		if err := c.db.CreateSession(ctx, session); err != nil {
 			log.Printf("Warning: Failed to create session: %v", err)
@@ -220,21 +252,34 @@ func (c *Controller) runBot(ctx context.Context) {
 
 	// Build strategy config
 	stratConfig := strategy.Config{
-		ApiToken:        c.apiToken,
-		Symbol:          c.config.Symbol,
-		Duration:        c.config.Duration,
-		DurationUnit:    c.config.DurationUnit,
-		InitialStake:    c.config.InitialStake,
-		TargetProfit:    c.config.TargetProfit,
-		StopLoss:        c.config.StopLoss,
-		StreakThreshold: c.config.StreakThreshold,
-		MartingaleMulti: c.config.MartingaleMulti,
-		Barrier:         c.config.Barrier,
-		Prediction:      c.config.Prediction,
-		Multiplier:      c.config.Multiplier,
-		DB:              c.db,
-		SessionID:       sessionID,
-		StrategyName:    c.config.Strategy,
+		ApiToken:          c.apiToken,
+		LoginID:           account.LoginID,
+		Symbol:            c.config.Symbol,
+		Duration:          c.config.Duration,
+		DurationUnit:      c.config.DurationUnit,
+		InitialStake:      c.config.InitialStake,
+		TargetProfit:      c.config.TargetProfit,
+		StopLoss:          c.config.StopLoss,
+		StreakThreshold:   c.config.StreakThreshold,
+		MartingaleMulti:   c.config.MartingaleMulti,
+		Barrier:           c.config.Barrier,
+		Prediction:        c.config.Prediction,
+		Multiplier:        c.config.Multiplier,
+		WarmupTicks:       c.config.WarmupTicks,
+		TakeProfit:        c.config.TakeProfit,
+		TradeStopLoss:     c.config.TradeStopLoss,
+		DealCancellation:  c.config.DealCancellation,
+		TrailActivation:   c.config.TrailActivation,
+		TrailDistance:     c.config.TrailDistance,
+		ExitBidPercent:    c.config.ExitBidPercent,
+		ExitAdverseTicks:  c.config.ExitAdverseTicks,
+		ExitSellTolerance: c.config.ExitSellTolerance,
+		MaxOpenPositions:  c.config.MaxOpenPositions,
+		MinEntryTicks:     c.config.MinEntryTicks,
+		MinEntrySeconds:   c.config.MinEntrySeconds,
+		DB:                c.db,
+		SessionID:         sessionID,
+		StrategyName:      c.config.Strategy,
 	}
 
 	// Update status
@@ -255,13 +300,26 @@ func (c *Controller) runBot(ctx context.Context) {
 		strat = strategy.NewRiseFallStrategy(api, stratConfig)
 	case "differs":
 		strat = strategy.NewDigitDiffersStrategy(api, stratConfig)
+	case "over_under":
+		strat = strategy.NewDigitOverUnderStrategy(api, stratConfig)
 	case "higher_lower":
 		strat = strategy.NewHigherLowerStrategy(api, stratConfig)
+	case "touch_no_touch", "ends_in_out", "stays_in_out":
+		barrierStrat, err := strategy.NewBarrierStrategy(api, stratConfig)
+		if err != nil {
+			log.Printf("Invalid %s configuration: %v", c.config.Strategy, err)
+			return
+		}
+		strat = barrierStrat
 	case "multiplier":
 		strat = strategy.NewMultiplierStrategy(api, stratConfig)
 	case "custom":
 		stratConfig.Script = c.config.Script
+		stratConfig.Params = c.config.Params
 		strat = strategy.NewCustomStrategy(api, stratConfig)
+	case "dbot":
+		stratConfig.Script = c.config.Script
+		strat = strategy.NewDBotStrategy(api, stratConfig)
 	default:
 		log.Printf("Unknown strategy: %s", c.config.Strategy)
 		return
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"deriv_trade/strategy"
+)
+
+// defaultAccountName names the account of SystemConfig.DerivAPIToken, used
+// when a bot or request does not choose one.
+const defaultAccountName = "default"
+
+// Account is a named Deriv account bots can trade on. ID is assigned by
+// the server and stays the same when the account is renamed.
+type Account struct {
+	ID    string `json:"id,omitempty"`
+	Name  string `json:"name"`
+	Token string `json:"token,omitempty"`
+}
+
+// assignAccountIDs gives every account without an ID a new random one.
+func assignAccountIDs(accounts []Account) {
+	for i := range accounts {
+		if accounts[i].ID != "" {
+			continue
+		}
+		id := make([]byte, 8)
+		rand.Read(id)
+		accounts[i].ID = hex.EncodeToString(id)
+	}
+}
+
+// AccountBalance is an account as reported by Deriv. Error is set instead
+// when the account could not be authorized.
+type AccountBalance struct {
+	Name    string `json:"name"`
+	Default bool   `json:"default"`
+	strategy.Account
+	Error string `json:"error,omitempty"`
+}
+
+// configuredAccounts returns the named accounts, preceded by the default
+// account when an API token is configured and no named account takes its
+// name.
+func configuredAccounts() []Account {
+	sysConfigMu.RLock()
+	defer sysConfigMu.RUnlock()
+
+	var accounts []Account
+	named := false
+	for _, a := range sysConfig.Accounts {
+		named = named || a.Name == defaultAccountName
+	}
+	if sysConfig.DerivAPIToken != "" && !named {
+		accounts = append(accounts, Account{Name: defaultAccountName, Token: sysConfig.DerivAPIToken})
+	}
+	return append(accounts, sysConfig.Accounts...)
+}
+
+// accountToken returns the API token of the named account; "" selects the
+// default account.
+func accountToken(name string) (string, error) {
+	if name == "" {
+		name = defaultAccountName
+	}
+	for _, a := range configuredAccounts() {
+		if a.Name == name {
+			return a.Token, nil
+		}
+	}
+	if name == defaultAccountName {
+		return "", fmt.Errorf("Deriv API token is not configured")
+	}
+	return "", fmt.Errorf("unknown account %q", name)
+}
+
+// validateAccounts checks the named accounts of a settings update.
+func validateAccounts(accounts []Account) error {
+	seen := map[string]bool{}
+	for _, a := range accounts {
+		if a.Name == "" {
+			return fmt.Errorf("account name is required")
+		}
+		if a.Token == "" {
+			return fmt.Errorf("account %q has no API token", a.Name)
+		}
+		if seen[a.Name] {
+			return fmt.Errorf("account %q is listed twice", a.Name)
+		}
+		seen[a.Name] = true
+	}
+	return nil
+}
+
+// handleAccounts returns the login id, currency and balance of every
+// configured account, without their tokens.
+func handleAccounts(w http.ResponseWriter, r *http.Request) {
+	accounts := configuredAccounts()
+	balances := make([]AccountBalance, len(accounts))
+
+	var wg sync.WaitGroup
+	for i, a := range accounts {
+		balances[i] = AccountBalance{Name: a.Name, Default: a.Name == defaultAccountName}
+		wg.Add(1)
+		go func(b *AccountBalance, token string) {
+			defer wg.Done()
+			api, err := newDerivAPI()
+			if err != nil {
+				b.Error = err.Error()
+				return
+			}
+			defer api.Disconnect()
+			account, err := strategy.AuthorizeAccount(api, token)
+			if err != nil {
+				b.Error = err.Error()
+				return
+			}
+			b.Account = account
+		}(&balances[i], a.Token)
+	}
+	wg.Wait()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(balances)
+}
@@ -9,6 +9,8 @@ import (
 	"strings"
 	"time"
 
+	"deriv_trade/strategy"
+
 	"go.mongodb.org/mongo-driver/bson"
 )
 
@@ -18,7 +20,8 @@ type AIRequest struct {
 }
 
 type AIResponse struct {
-	Reply string `json:"reply"`
+	Reply  string               `json:"reply"`
+	Issues []strategy.DBotIssue `json:"issues,omitempty"` // DBot validation results for generated XML
 }
 
 // OpenAI structures
@@ -294,10 +297,14 @@ func handleAIGenerateStrategy(w http.ResponseWriter, r *http.Request) {
 		
 		API Reference:
 		- function onTick(quote): Called on every new price tick. 'quote' is a float.
+		- function onTradeResult(result): Optional. Called when a contract settles with {contract_type, stake, profit, status}; status is "error" if the trade could not be placed and "skipped" if the position limits held it back. Contracts sold early add exit_reason and exit_slippage (sale price minus the bid it was decided on); failed sells add sell_failures and sell_error.
 		- function log(message): Logs a string to the console.
-		- function buy(contractType, amount): Executes a trade. contractType is "CALL" (Rise) or "PUT" (Fall). amount is the stake.
+		- function buy(contractType, amount, prediction): Executes a trade. contractType is "CALL" (Rise), "PUT" (Fall), or a digit contract: "DIGITEVEN", "DIGITODD", "DIGITMATCH", "DIGITDIFF", "DIGITOVER", "DIGITUNDER". amount is the stake. prediction is the digit MATCH/DIFF/OVER/UNDER contracts need (0-9, OVER 0-8, UNDER 1-9) and is omitted otherwise.
 		- function getInitialStake(): Returns the configured initial stake amount.
 		- function getSymbol(): Returns the configured symbol.
+		- function isWarmingUp(): True while historical ticks are replayed before trading starts; buy() is ignored during warm-up.
+		- function digitStats(window): Statistics of the symbol's last digits over the last window ticks (default 1000): {samples, last_digit, counts[10], frequencies[10], even, odd, digit_streak, parity_streak, digit_streaks, parity_streaks, chi_square, p_value, uniform}.
+		- exports.params = { name: {type, default, min, max, description} }: Optional. Declares tunable inputs (type "number", "integer", "boolean" or "string"); their configured values are read from the global params object, e.g. params.threshold.
 		
 		Rules:
 		1. OUTPUT ONLY JAVASCRIPT CODE. Do not include markdown formatting or "Here is the code". Just the code.
@@ -329,32 +336,58 @@ func handleAIGenerateStrategy(w http.ResponseWriter, r *http.Request) {
 		code = strings.TrimPrefix(code, "```xml")
 		code = strings.TrimPrefix(code, "```")
 		code = strings.TrimSuffix(code, "```")
+		code = strings.TrimSpace(code)
+	}
+
+	resp := AIResponse{Reply: code}
+	if req.Mode == "dbot" {
+		// Check generated XML before the user can save or run it
+		resp.Issues = strategy.ValidateDBotXML(code)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(AIResponse{Reply: code})
+	json.NewEncoder(w).Encode(resp)
 }
 
 func generateFallbackStrategy(prompt, mode string) string {
 	if mode == "dbot" {
 		return `<!-- Fallback DBot XML (AI Unavailable) -->
 <xml xmlns="http://www.w3.org/1999/xhtml" collection="false">
-  <block type="trade_definition" x="0" y="0">
-    <statement name="TRADE_OPTIONS">
-      <block type="trade_definition_market" id="market">
-        <field name="MARKET_LIST">synthetic_index</field>
-        <field name="SUBMARKET_LIST">random_index</field>
-        <field name="SYMBOL_LIST">R_100</field>
+  <block type="trade_definition" id="trade_def" x="0" y="0">
+    <value name="TRADETYPE">
+      <shadow type="text">
+        <field name="TEXT">rise</field>
+      </shadow>
+    </value>
+    <value name="MARKET">
+      <shadow type="text">
+        <field name="TEXT">R_100</field>
+      </shadow>
+    </value>
+    <statement name="INITIALIZATION">
+      <block type="text_print" id="init_print">
+        <value name="TEXT">
+          <shadow type="text">
+            <field name="TEXT">Bot Started</field>
+          </shadow>
+        </value>
       </block>
     </statement>
-    <statement name="INITIALIZATION">
-        <block type="text_print">
-            <value name="TEXT">
-                <shadow type="text">
-                    <field name="TEXT">Bot Started</field>
-                </shadow>
-            </value>
-        </block>
+  </block>
+  <block type="before_purchase" id="strategy" x="0" y="220">
+    <statement name="statement">
+      <block type="purchase" id="purchase_call">
+        <value name="BET">
+          <shadow type="math_number">
+            <field name="NUM">1</field>
+          </shadow>
+        </value>
+      </block>
+    </statement>
+  </block>
+  <block type="after_purchase" id="after_purch" x="0" y="420">
+    <statement name="statement">
+      <block type="trade_again" id="trade_again"></block>
     </statement>
   </block>
 </xml>`
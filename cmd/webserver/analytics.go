@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"deriv_trade/database"
+	"deriv_trade/strategy"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -202,3 +204,32 @@ func handleTradesExport(w http.ResponseWriter, r *http.Request) {
 		)
 	}
 }
+
+// simulateTimeout bounds a Monte Carlo run started from the API.
+const simulateTimeout = time.Minute
+
+// handleSimulate runs a Monte Carlo risk-of-ruin simulation for the posted
+// martingale settings.
+func handleSimulate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var opts strategy.SimulationOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), simulateTimeout)
+	defer cancel()
+	report, err := strategy.Simulate(ctx, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,623 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Dashboard users sign in with a password and get a session token, sent
+// back as the session cookie or as a bearer token. Each route requires a
+// role: viewers read, traders also run bots and trade, admins also manage
+// settings and users. Until the first admin is created nothing is served:
+// it is created either from DERIV_TRADER_ADMIN_USER and
+// DERIV_TRADER_ADMIN_PASSWORD, or in the dashboard with the one-time setup
+// token printed to the log (DERIV_TRADER_SETUP_TOKEN, which the desktop app
+// sets). Requests that change state must come from this server's own pages
+// or an allowed origin.
+const (
+	roleViewer = "viewer"
+	roleTrader = "trader"
+	roleAdmin  = "admin"
+
+	adminUserEnv     = "DERIV_TRADER_ADMIN_USER"
+	adminPasswordEnv = "DERIV_TRADER_ADMIN_PASSWORD"
+	setupTokenEnv    = "DERIV_TRADER_SETUP_TOKEN"
+
+	sessionCookie = "deriv_trader_session"
+	sessionTTL    = 24 * time.Hour
+
+	minPasswordLength = 8
+	// maxLoginFailures failed logins in a row from one address lock that
+	// address out of the username for loginLockout; failures older than
+	// loginLockout are forgotten.
+	maxLoginFailures = 5
+	loginLockout     = 15 * time.Minute
+)
+
+var roleRank = map[string]int{roleViewer: 1, roleTrader: 2, roleAdmin: 3}
+
+var UsersFile = "users.json"
+
+// User is a dashboard login.
+type User struct {
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"password_hash,omitempty"`
+	Role         string    `json:"role"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type authSession struct {
+	username string
+	expires  time.Time
+}
+
+type loginFailure struct {
+	count int
+	last  time.Time
+	until time.Time
+}
+
+var auth = struct {
+	sync.Mutex
+	users    map[string]User
+	sessions map[string]authSession   // token -> session
+	failures map[string]*loginFailure // client IP and username -> failures
+	// setupToken creates the first admin; "" once one exists
+	setupToken string
+}{users: map[string]User{}, sessions: map[string]authSession{}, failures: map[string]*loginFailure{}}
+
+// loadUsers reads UsersFile; a missing file means no users yet, unless an
+// admin is given in the environment.
+func loadUsers() {
+	data, err := os.ReadFile(UsersFile)
+	if errors.Is(err, os.ErrNotExist) {
+		if err := createAdminFromEnv(); err != nil {
+			log.Fatalf("Failed to create admin from %s: %v", adminPasswordEnv, err)
+		}
+		if len(auth.users) == 0 {
+			startSetup()
+		}
+		return
+	}
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", UsersFile, err)
+	}
+	var users []User
+	if err := json.Unmarshal(data, &users); err != nil {
+		log.Fatalf("Invalid %s: %v", UsersFile, err)
+	}
+
+	auth.Lock()
+	for _, u := range users {
+		auth.users[u.Username] = u
+	}
+	empty := len(auth.users) == 0
+	auth.Unlock()
+	if empty {
+		startSetup()
+	}
+}
+
+// startSetup sets the token the first admin is created with, from
+// setupTokenEnv or else at random, and prints it.
+func startSetup() {
+	token := os.Getenv(setupTokenEnv)
+	if token == "" {
+		var err error
+		if token, err = newSessionToken(); err != nil {
+			log.Fatalf("Failed to create setup token: %v", err)
+		}
+	}
+	auth.Lock()
+	auth.setupToken = token
+	auth.Unlock()
+	log.Printf("No dashboard users in %s: open the dashboard and create the first admin with setup token %s", UsersFile, token)
+}
+
+// createAdminFromEnv creates the first admin from adminUserEnv (by default
+// "admin") and adminPasswordEnv, when the password is set.
+func createAdminFromEnv() error {
+	password := os.Getenv(adminPasswordEnv)
+	if password == "" {
+		return nil
+	}
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	username := os.Getenv(adminUserEnv)
+	if username == "" {
+		username = "admin"
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	auth.Lock()
+	defer auth.Unlock()
+	auth.users[username] = User{Username: username, PasswordHash: string(hash), Role: roleAdmin, CreatedAt: time.Now()}
+	if err := saveUsersLocked(); err != nil {
+		return err
+	}
+	log.Printf("Created admin %q in %s", username, UsersFile)
+	return nil
+}
+
+// saveUsersLocked writes the users to UsersFile. Callers hold auth.
+func saveUsersLocked() error {
+	users := make([]User, 0, len(auth.users))
+	for _, u := range auth.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	data, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := UsersFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, UsersFile)
+}
+
+// authenticate returns the user making the request, from the session
+// cookie or an Authorization: Bearer token.
+func authenticate(r *http.Request) (User, bool) {
+	auth.Lock()
+	defer auth.Unlock()
+
+	token := requestToken(r)
+	if token == "" {
+		return User{}, false
+	}
+	s, ok := auth.sessions[token]
+	if !ok {
+		return User{}, false
+	}
+	if time.Now().After(s.expires) {
+		delete(auth.sessions, token)
+		return User{}, false
+	}
+	// The current record, so role changes and deletions apply at once
+	u, ok := auth.users[s.username]
+	return u, ok
+}
+
+func requestToken(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+	}
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+// requireRole serves h only to users with at least the given role.
+func requireRole(role string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkWriteOrigin(w, r) {
+			return
+		}
+		user, ok := authenticate(r)
+		if !ok {
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+		if roleRank[user.Role] < roleRank[role] {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// requireReadWriteRole serves h to users with at least role read for GET
+// and HEAD requests, and at least role write for any other method, for
+// routes that both show and change something.
+func requireReadWriteRole(read, write string, h http.HandlerFunc) http.HandlerFunc {
+	readH, writeH := requireRole(read, h), requireRole(write, h)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			readH(w, r)
+			return
+		}
+		writeH(w, r)
+	}
+}
+
+// checkWriteOrigin rejects requests that change state and come from another
+// site's page, so a page open in the operator's browser cannot drive the
+// server. It reports whether the request may go on.
+func checkWriteOrigin(w http.ResponseWriter, r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	if !checkOrigin(r) {
+		http.Error(w, "Cross-origin request rejected", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// checkOrigin accepts requests, including WebSocket connections, from pages
+// served by this server and from the origins listed in
+// SystemConfig.AllowedOrigins. Clients that send no Origin are not
+// browsers and are accepted.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	sysConfigMu.RLock()
+	defer sysConfigMu.RUnlock()
+	for _, allowed := range sysConfig.AllowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	log.Printf("Rejected %s %s from origin %s", r.Method, r.URL.Path, origin)
+	return false
+}
+
+func newSessionToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// handleLogin checks a username and password and starts a session. The
+// token is set as an HttpOnly cookie and returned for use as a bearer token.
+func handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !checkWriteOrigin(w, r) {
+		return
+	}
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	failureKey := clientIP(r) + " " + req.Username
+	auth.Lock()
+	f := auth.failures[failureKey]
+	if f != nil && time.Now().Before(f.until) {
+		auth.Unlock()
+		http.Error(w, "Too many failed logins; try again later", http.StatusTooManyRequests)
+		return
+	}
+	user, ok := auth.users[req.Username]
+	auth.Unlock()
+
+	// Compare against a dummy hash for unknown users so both cases take as long
+	hash := user.PasswordHash
+	if !ok {
+		hash = "$2a$10$7EqJtq98hPqEX7fNZaFWoOhi5BWX4Z3ZxVZpiO5F1Bqg6gGOgSZ2W"
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(req.Password)); err != nil || !ok {
+		now := time.Now()
+		auth.Lock()
+		pruneLoginFailuresLocked(now)
+		f = auth.failures[failureKey]
+		if f == nil {
+			f = &loginFailure{}
+			auth.failures[failureKey] = f
+		}
+		f.count++
+		f.last = now
+		if f.count >= maxLoginFailures {
+			f.count = 0
+			f.until = now.Add(loginLockout)
+			log.Printf("Login for %q from %s locked for %s after %d failures", req.Username, clientIP(r), loginLockout, maxLoginFailures)
+		}
+		auth.Unlock()
+		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		return
+	}
+
+	auth.Lock()
+	delete(auth.failures, failureKey)
+	auth.Unlock()
+	startSession(w, r, user)
+}
+
+// pruneLoginFailuresLocked forgets failures that no longer count towards or
+// hold a lockout. Callers hold auth.
+func pruneLoginFailuresLocked(now time.Time) {
+	for key, f := range auth.failures {
+		if now.After(f.until) && now.Sub(f.last) > loginLockout {
+			delete(auth.failures, key)
+		}
+	}
+}
+
+// clientIP returns the address a request came from, without its port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// startSession signs user in: the session token is set as the session
+// cookie and returned with the user.
+func startSession(w http.ResponseWriter, r *http.Request, user User) {
+	token, err := newSessionToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	expires := time.Now().Add(sessionTTL)
+	auth.Lock()
+	auth.sessions[token] = authSession{username: user.Username, expires: expires}
+	auth.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":    token,
+		"username": user.Username,
+		"role":     user.Role,
+		"expires":  expires,
+	})
+}
+
+// handleSetup reports (GET) whether the first admin still has to be
+// created, and creates it (POST) given the setup token.
+func handleSetup(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		auth.Lock()
+		required := auth.setupToken != ""
+		auth.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]bool{"required": required})
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !checkWriteOrigin(w, r) {
+		return
+	}
+
+	var req struct {
+		SetupToken string `json:"setup_token"`
+		Username   string `json:"username"`
+		Password   string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Username == "" {
+		http.Error(w, "username is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Password) < minPasswordLength {
+		http.Error(w, fmt.Sprintf("password must be at least %d characters", minPasswordLength), http.StatusBadRequest)
+		return
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	auth.Lock()
+	if auth.setupToken == "" {
+		auth.Unlock()
+		http.Error(w, "Setup is already done", http.StatusConflict)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(req.SetupToken), []byte(auth.setupToken)) != 1 {
+		auth.Unlock()
+		http.Error(w, "Invalid setup token", http.StatusForbidden)
+		return
+	}
+	user := User{Username: req.Username, PasswordHash: string(hash), Role: roleAdmin, CreatedAt: time.Now()}
+	auth.users[user.Username] = user
+	if err := saveUsersLocked(); err != nil {
+		delete(auth.users, user.Username)
+		auth.Unlock()
+		http.Error(w, "Failed to save users", http.StatusInternalServerError)
+		return
+	}
+	auth.setupToken = ""
+	auth.Unlock()
+
+	log.Printf("Created admin %q in %s", user.Username, UsersFile)
+	startSession(w, r, user)
+}
+
+// handleLogout ends the session of the request.
+func handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !checkWriteOrigin(w, r) {
+		return
+	}
+	if token := requestToken(r); token != "" {
+		auth.Lock()
+		delete(auth.sessions, token)
+		auth.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "logged out"})
+}
+
+// handleMe returns the signed-in user, or 401 when a login is needed.
+func handleMe(w http.ResponseWriter, r *http.Request) {
+	user, ok := authenticate(r)
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	user.PasswordHash = ""
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// handleUsers lists (GET), creates or updates (POST) and deletes (DELETE,
+// ?username=) dashboard users. A POST without a password keeps the current
+// one; the last admin cannot be removed or demoted.
+func handleUsers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		auth.Lock()
+		users := make([]User, 0, len(auth.users))
+		for _, u := range auth.users {
+			u.PasswordHash = ""
+			users = append(users, u)
+		}
+		auth.Unlock()
+		sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(users)
+
+	case http.MethodPost:
+		var req struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			Role     string `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if req.Username == "" {
+			http.Error(w, "username is required", http.StatusBadRequest)
+			return
+		}
+		if _, ok := roleRank[req.Role]; !ok {
+			http.Error(w, "role must be viewer, trader or admin", http.StatusBadRequest)
+			return
+		}
+		var hash []byte
+		if req.Password != "" {
+			if len(req.Password) < minPasswordLength {
+				http.Error(w, fmt.Sprintf("password must be at least %d characters", minPasswordLength), http.StatusBadRequest)
+				return
+			}
+			var err error
+			if hash, err = bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		auth.Lock()
+		defer auth.Unlock()
+		user, exists := auth.users[req.Username]
+		if !exists {
+			if hash == nil {
+				http.Error(w, "password is required for a new user", http.StatusBadRequest)
+				return
+			}
+			user = User{Username: req.Username, CreatedAt: time.Now()}
+		} else if user.Role == roleAdmin && req.Role != roleAdmin && countAdminsLocked() == 1 {
+			http.Error(w, "cannot demote the last admin", http.StatusConflict)
+			return
+		}
+		user.Role = req.Role
+		if hash != nil {
+			user.PasswordHash = string(hash)
+		}
+		auth.users[user.Username] = user
+		if err := saveUsersLocked(); err != nil {
+			http.Error(w, "Failed to save users", http.StatusInternalServerError)
+			return
+		}
+
+		user.PasswordHash = ""
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(user)
+
+	case http.MethodDelete:
+		username := r.URL.Query().Get("username")
+		auth.Lock()
+		defer auth.Unlock()
+		user, ok := auth.users[username]
+		if !ok {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		if user.Role == roleAdmin && countAdminsLocked() == 1 {
+			http.Error(w, "cannot delete the last admin", http.StatusConflict)
+			return
+		}
+		delete(auth.users, username)
+		for token, s := range auth.sessions {
+			if s.username == username {
+				delete(auth.sessions, token)
+			}
+		}
+		if err := saveUsersLocked(); err != nil {
+			http.Error(w, "Failed to save users", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func countAdminsLocked() int {
+	n := 0
+	for _, u := range auth.users {
+		if u.Role == roleAdmin {
+			n++
+		}
+	}
+	return n
+}
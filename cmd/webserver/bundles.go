@@ -0,0 +1,451 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"deriv_trade/database"
+	"deriv_trade/strategy"
+)
+
+// bundleFormat is the version of the StrategyBundle layout written on export.
+const bundleFormat = 1
+
+// maxBundleSize caps uploaded bundles.
+const maxBundleSize = 5 << 20
+
+// bundleManifest is the name of the bundle description inside a zip export;
+// the script sits next to it under the strategy's own name.
+const bundleManifest = "bundle.json"
+
+// StrategyBundle is the portable form of a saved strategy.
+type StrategyBundle struct {
+	Format      int                       `json:"format"`
+	Name        string                    `json:"name"`
+	Description string                    `json:"description,omitempty"`
+	Content     string                    `json:"content,omitempty"` // empty in zip manifests
+	Tags        []string                  `json:"tags"`
+	Params      map[string]interface{}    `json:"params,omitempty"`
+	BotConfig   *BotConfig                `json:"bot_config,omitempty"` // recommended settings; Script is never set
+	Backtest    *database.BacktestSummary `json:"backtest,omitempty"`
+	ExportedAt  time.Time                 `json:"exported_at"`
+}
+
+// knownStrategies are the strategy names the bot binary accepts.
+var knownStrategies = map[string]bool{
+	"even_odd": true, "rise_fall": true, "differs": true, "over_under": true, "higher_lower": true,
+	"touch_no_touch": true, "ends_in_out": true, "stays_in_out": true,
+	"multiplier": true, "custom": true, "dbot": true,
+}
+
+func validateBotConfig(c *BotConfig) error {
+	if c.Strategy != "" && !knownStrategies[c.Strategy] {
+		return fmt.Errorf("unknown strategy %q", c.Strategy)
+	}
+	if c.InitialStake < 0 || c.TargetProfit < 0 || c.StopLoss < 0 || c.Martingale < 0 {
+		return fmt.Errorf("stake, target profit, stop loss and martingale must not be negative")
+	}
+	if c.Duration < 0 || c.StreakThreshold < 0 || c.WarmupTicks < 0 || c.Multiplier < 0 {
+		return fmt.Errorf("duration, streak, warm-up and multiplier must not be negative")
+	}
+	if c.MaxOpenPositions < 0 || c.MinEntryTicks < 0 || c.MinEntrySeconds < 0 {
+		return fmt.Errorf("position limit and entry spacing must not be negative")
+	}
+	if err := strategy.ValidateMultiplierLimits(c.TakeProfit, c.TradeStopLoss, c.DealCancellation); err != nil {
+		return err
+	}
+	if err := strategy.ValidateTrailingTakeProfit(c.TrailActivation, c.TrailDistance); err != nil {
+		return err
+	}
+	if err := strategy.ValidateEarlyExit(c.ExitBidPercent, c.ExitAdverseTicks, c.ExitSellTolerance); err != nil {
+		return err
+	}
+	if c.Prediction != nil && (*c.Prediction < 0 || *c.Prediction > 9) {
+		return fmt.Errorf("prediction must be a digit between 0 and 9")
+	}
+	switch c.DurationUnit {
+	case "", "t", "s", "m", "h", "d":
+	default:
+		return fmt.Errorf("invalid duration unit %q", c.DurationUnit)
+	}
+	if c.Symbol != "" && !strategy.KnownSymbols[c.Symbol] {
+		return fmt.Errorf("unknown symbol %q", c.Symbol)
+	}
+	return nil
+}
+
+// configToMap and mapToConfig convert between BotConfig and the schemaless
+// form strategies store it in.
+func configToMap(c *BotConfig) map[string]interface{} {
+	if c == nil {
+		return nil
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil
+	}
+	var m map[string]interface{}
+	json.Unmarshal(data, &m)
+	delete(m, "script")
+	return m
+}
+
+func mapToConfig(m map[string]interface{}) *BotConfig {
+	if m == nil {
+		return nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil
+	}
+	var c BotConfig
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil
+	}
+	c.Script = ""
+	return &c
+}
+
+// handleStrategyExport downloads a strategy bundle. GET ?name=&format=json|zip
+// exports what is stored; POST {name, format, bot_config, backtest} overrides
+// the recommended config and backtest summary for this export.
+func handleStrategyExport(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name      string                    `json:"name"`
+		Format    string                    `json:"format"`
+		BotConfig *BotConfig                `json:"bot_config"`
+		Backtest  *database.BacktestSummary `json:"backtest"`
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		req.Name = r.URL.Query().Get("name")
+		req.Format = r.URL.Query().Get("format")
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !validStrategyName(req.Name) {
+		http.Error(w, "Invalid strategy name", http.StatusBadRequest)
+		return
+	}
+
+	s, err := getStrategyStore().Get(r.Context(), req.Name)
+	if err != nil {
+		http.Error(w, "Strategy not found", http.StatusNotFound)
+		return
+	}
+
+	bundle := StrategyBundle{
+		Format:      bundleFormat,
+		Name:        s.Name,
+		Description: s.Description,
+		Content:     s.Content,
+		Tags:        s.Tags,
+		Params:      s.Params,
+		BotConfig:   mapToConfig(s.RecommendedConfig),
+		Backtest:    s.Backtest,
+		ExportedAt:  time.Now(),
+	}
+	if req.BotConfig != nil {
+		req.BotConfig.Script = ""
+		bundle.BotConfig = req.BotConfig
+	}
+	if req.Backtest != nil {
+		bundle.Backtest = req.Backtest
+	}
+
+	base := strings.TrimSuffix(s.Name, filepath.Ext(s.Name))
+	switch req.Format {
+	case "", "json":
+		w.Header().Set("Content-Disposition", attachment(base+".bundle.json"))
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(bundle)
+	case "zip":
+		var buf bytes.Buffer
+		if err := writeBundleZip(&buf, bundle); err != nil {
+			http.Error(w, "Failed to build bundle", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Disposition", attachment(base+".zip"))
+		w.Header().Set("Content-Type", "application/zip")
+		w.Write(buf.Bytes())
+	default:
+		http.Error(w, "Format must be json or zip", http.StatusBadRequest)
+	}
+}
+
+// attachment is the Content-Disposition of a download, quoting or encoding
+// the strategy name as needed.
+func attachment(filename string) string {
+	return mime.FormatMediaType("attachment", map[string]string{"filename": filename})
+}
+
+func writeBundleZip(out io.Writer, bundle StrategyBundle) error {
+	zw := zip.NewWriter(out)
+
+	script, err := zw.Create(bundle.Name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(script, bundle.Content); err != nil {
+		return err
+	}
+
+	bundle.Content = ""
+	manifest, err := zw.Create(bundleManifest)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(manifest)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(bundle); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func readBundleZip(data []byte) (StrategyBundle, error) {
+	var bundle StrategyBundle
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return bundle, fmt.Errorf("invalid zip: %w", err)
+	}
+
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	read := func(f *zip.File) ([]byte, error) {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		// Read one byte past the limit to tell a full file from a cut one
+		data, err := io.ReadAll(io.LimitReader(rc, maxBundleSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxBundleSize {
+			return nil, fmt.Errorf("bundle too large: %s exceeds %d bytes", f.Name, maxBundleSize)
+		}
+		return data, nil
+	}
+
+	manifest, ok := files[bundleManifest]
+	if !ok {
+		return bundle, fmt.Errorf("zip has no %s", bundleManifest)
+	}
+	raw, err := read(manifest)
+	if err != nil {
+		return bundle, err
+	}
+	if err := json.Unmarshal(raw, &bundle); err != nil {
+		return bundle, fmt.Errorf("invalid %s: %w", bundleManifest, err)
+	}
+
+	if bundle.Content == "" {
+		script, ok := files[bundle.Name]
+		if !ok {
+			return bundle, fmt.Errorf("zip has no script named %q", bundle.Name)
+		}
+		content, err := read(script)
+		if err != nil {
+			return bundle, err
+		}
+		bundle.Content = string(content)
+	}
+	return bundle, nil
+}
+
+// readBundleUpload accepts a bundle as a JSON body, a zip body, or a
+// multipart "file" upload of either.
+func readBundleUpload(w http.ResponseWriter, r *http.Request) (StrategyBundle, error) {
+	var bundle StrategyBundle
+	r.Body = http.MaxBytesReader(w, r.Body, maxBundleSize)
+
+	var data []byte
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, ferr := r.FormFile("file")
+		if ferr != nil {
+			return bundle, fmt.Errorf("file upload required")
+		}
+		defer file.Close()
+		data, err = io.ReadAll(file)
+	} else {
+		data, err = io.ReadAll(r.Body)
+	}
+	if err != nil {
+		return bundle, fmt.Errorf("failed to read bundle: %w", err)
+	}
+
+	// Zip archives start with "PK"
+	if bytes.HasPrefix(data, []byte("PK")) {
+		return readBundleZip(data)
+	}
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return bundle, fmt.Errorf("invalid bundle JSON: %w", err)
+	}
+	return bundle, nil
+}
+
+// uniqueStrategyName appends -2, -3, ... before the extension until the name is free.
+func uniqueStrategyName(store StrategyStore, r *http.Request, name string) (string, error) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	candidate := name
+	for i := 2; ; i++ {
+		_, err := store.Get(r.Context(), candidate)
+		if err == errStrategyNotFound {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		candidate = base + "-" + strconv.Itoa(i) + ext
+	}
+}
+
+// handleStrategyImport validates and saves an uploaded bundle. A name that
+// is already taken is handled per ?on_conflict=rename (default), overwrite,
+// skip or error.
+func handleStrategyImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	onConflict := r.URL.Query().Get("on_conflict")
+	if onConflict == "" {
+		onConflict = "rename"
+	}
+	switch onConflict {
+	case "rename", "overwrite", "skip", "error":
+	default:
+		http.Error(w, "on_conflict must be rename, overwrite, skip or error", http.StatusBadRequest)
+		return
+	}
+
+	bundle, err := readBundleUpload(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Validate the bundle itself
+	if bundle.Format > bundleFormat {
+		http.Error(w, fmt.Sprintf("bundle format %d is newer than supported format %d", bundle.Format, bundleFormat), http.StatusBadRequest)
+		return
+	}
+	if !strings.HasSuffix(bundle.Name, ".js") && !strings.HasSuffix(bundle.Name, ".xml") {
+		http.Error(w, "Bundle name must end in .js or .xml", http.StatusBadRequest)
+		return
+	}
+	if !validStrategyName(bundle.Name) {
+		http.Error(w, "Invalid strategy name", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(bundle.Content) == "" {
+		http.Error(w, "Bundle has no script", http.StatusBadRequest)
+		return
+	}
+	if bundle.BotConfig != nil {
+		if err := validateBotConfig(bundle.BotConfig); err != nil {
+			http.Error(w, "Invalid bot_config: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Validate the script the same way saving does
+	check := checkStrategyContent(bundle.Content)
+	if !check.Valid {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(check)
+		return
+	}
+	params := bundle.Params
+	if !strategy.IsDBotXML(bundle.Content) {
+		if params, err = strategy.ResolveScriptParams(bundle.Content, bundle.Params); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Name collisions
+	store := getStrategyStore()
+	name := bundle.Name
+	existing, err := store.Get(r.Context(), name)
+	if err != nil && err != errStrategyNotFound {
+		http.Error(w, "Failed to read strategy", http.StatusInternalServerError)
+		return
+	}
+	if existing != nil {
+		switch onConflict {
+		case "error":
+			http.Error(w, fmt.Sprintf("strategy %s already exists", name), http.StatusConflict)
+			return
+		case "skip":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"status": "skipped", "name": name})
+			return
+		case "rename":
+			if name, err = uniqueStrategyName(store, r, name); err != nil {
+				http.Error(w, "Failed to read strategy", http.StatusInternalServerError)
+				return
+			}
+		case "overwrite":
+			if _, err := store.AddVersion(r.Context(), name, existing.Content, "snapshot before import"); err != nil {
+				http.Error(w, "Failed to record strategy version", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	s := &database.Strategy{
+		Name:              name,
+		Content:           bundle.Content,
+		Description:       bundle.Description,
+		Tags:              bundle.Tags,
+		Params:            params,
+		RecommendedConfig: configToMap(bundle.BotConfig),
+		Backtest:          bundle.Backtest,
+	}
+	if err := store.Save(r.Context(), s); err != nil {
+		http.Error(w, "Failed to save strategy", http.StatusInternalServerError)
+		return
+	}
+	version, err := store.AddVersion(r.Context(), name, bundle.Content, "imported from bundle "+bundle.Name)
+	if err != nil {
+		http.Error(w, "Failed to record strategy version", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "imported",
+		"name":    name,
+		"renamed": name != bundle.Name,
+		"version": version,
+		"issues":  check.Issues,
+	})
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"deriv_trade/strategy"
+
+	"github.com/ksysoev/deriv-api/schema"
+)
+
+// digitReadyTimeout bounds how long a request waits for a new tracker to
+// load its history.
+const digitReadyTimeout = 5 * time.Second
+
+// digitTrackers records which symbols the webserver streams ticks for to
+// keep their digit statistics current. Each tracker's channel is closed
+// once its history is loaded, or it gave up.
+var (
+	digitTrackers   = map[string]chan struct{}{}
+	digitTrackersMu sync.Mutex
+)
+
+// trackDigits starts streaming ticks for symbol into its digit statistics,
+// seeded with recent history, unless a tracker is already running. It
+// returns the tracker's ready channel.
+func trackDigits(symbol string) <-chan struct{} {
+	digitTrackersMu.Lock()
+	defer digitTrackersMu.Unlock()
+	if ready, ok := digitTrackers[symbol]; ok {
+		return ready
+	}
+	ready := make(chan struct{})
+	digitTrackers[symbol] = ready
+	go runDigitTracker(symbol, ready)
+	return ready
+}
+
+func runDigitTracker(symbol string, ready chan struct{}) {
+	loaded := false
+	markReady := func() {
+		if !loaded {
+			loaded = true
+			close(ready)
+		}
+	}
+	defer func() {
+		markReady()
+		// Let the next request start a fresh tracker
+		digitTrackersMu.Lock()
+		delete(digitTrackers, symbol)
+		digitTrackersMu.Unlock()
+	}()
+
+	api, err := newDerivAPI()
+	if err != nil {
+		log.Printf("Digit tracker %s: failed to connect to Deriv API: %v", symbol, err)
+		return
+	}
+	defer api.Disconnect()
+
+	stats := strategy.DigitStatsFor(symbol)
+	if stats.Snapshot(strategy.MaxDigitWindow).Samples == 0 {
+		quotes, pipSize, err := strategy.TickHistory(api, symbol, strategy.MaxDigitWindow)
+		if err != nil {
+			log.Printf("Digit tracker %s: history unavailable: %v", symbol, err)
+		}
+		for _, q := range quotes {
+			stats.Add(q, pipSize)
+		}
+	}
+	markReady()
+
+	_, sub, err := api.SubscribeTicks(schema.Ticks{Ticks: symbol})
+	if err != nil {
+		log.Printf("Digit tracker %s: failed to subscribe to ticks: %v", symbol, err)
+		return
+	}
+	defer sub.Forget()
+
+	for tick := range sub.Stream {
+		if tick.Tick != nil && tick.Tick.Quote != nil {
+			stats.Add(*tick.Tick.Quote, int(tick.Tick.PipSize))
+		}
+	}
+	log.Printf("Digit tracker %s: tick stream closed", symbol)
+}
+
+// handleDigits returns rolling last-digit statistics for ?symbol= over the
+// last ?window= ticks (default 1000), starting a tracker for new symbols.
+func handleDigits(w http.ResponseWriter, r *http.Request) {
+	symbol := r.URL.Query().Get("symbol")
+	if symbol == "" {
+		http.Error(w, "symbol is required", http.StatusBadRequest)
+		return
+	}
+	// Every tracked symbol holds a Deriv connection and its statistics
+	if !strategy.KnownSymbols[symbol] {
+		http.Error(w, "unknown symbol "+symbol, http.StatusBadRequest)
+		return
+	}
+	window := strategy.DefaultDigitWindow
+	if v := r.URL.Query().Get("window"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > strategy.MaxDigitWindow {
+			http.Error(w, "window must be between 1 and "+strconv.Itoa(strategy.MaxDigitWindow), http.StatusBadRequest)
+			return
+		}
+		window = n
+	}
+
+	// Give a new tracker a moment to load history before answering
+	timer := time.NewTimer(digitReadyTimeout)
+	defer timer.Stop()
+	select {
+	case <-trackDigits(symbol):
+	case <-timer.C:
+	case <-r.Context().Done():
+		return
+	}
+
+	stats := strategy.DigitStatsFor(symbol)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats.Snapshot(window))
+}
@@ -17,6 +17,7 @@ import (
 	"time"
 
 	"deriv_trade/database"
+	"deriv_trade/strategy"
 
 	"github.com/gorilla/websocket"
 	"go.mongodb.org/mongo-driver/bson"
@@ -39,9 +40,7 @@ var (
 	upgrader = websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
-		CheckOrigin: func(r *http.Request) bool {
-			return true // Allow all origins for now
-		},
+		CheckOrigin:     checkOrigin,
 	}
 	clients   = make(map[*websocket.Conn]bool)
 	clientsMu sync.Mutex
@@ -57,6 +56,18 @@ type SystemConfig struct {
 	MongoURI      string `json:"mongo_uri"`
 	OpenAIKey     string `json:"openai_key,omitempty"`
 	OpenAIModel   string `json:"openai_model,omitempty"`
+	StrategyStore string `json:"strategy_store,omitempty"` // "filesystem" (default) or "mongodb"
+
+	// Session limits for manual trades from /api/trade; 0 uses the bot's defaults
+	ManualStopLoss     float64 `json:"manual_stop_loss,omitempty"`
+	ManualTargetProfit float64 `json:"manual_target_profit,omitempty"`
+	ManualMaxOpen      int     `json:"manual_max_open,omitempty"`
+
+	// Named accounts bots can trade on; DerivAPIToken is the "default" account
+	Accounts []Account `json:"accounts,omitempty"`
+
+	// Origins besides this server's own that may open /ws, e.g. "https://dash.example.com"
+	AllowedOrigins []string `json:"allowed_origins,omitempty"`
 }
 
 func loadSystemConfig() {
@@ -64,6 +75,9 @@ func loadSystemConfig() {
 	if err == nil {
 		json.Unmarshal(file, &sysConfig)
 	}
+	assignAccountIDs(sysConfig.Accounts)
+	loadSecrets()
+	loadUsers()
 
 	// Fallback to Env if missing in file
 	if sysConfig.DerivAPIToken == "" {
@@ -77,15 +91,27 @@ func loadSystemConfig() {
 	}
 }
 
+// saveSystemConfig writes the secrets to SecretsFile and everything else to
+// ConfigFile.
 func saveSystemConfig() error {
 	sysConfigMu.RLock()
 	defer sysConfigMu.RUnlock()
 
-	data, err := json.MarshalIndent(sysConfig, "", "  ")
+	if secrets == nil {
+		return fmt.Errorf("secret store is not available")
+	}
+	if err := secrets.save(configSecrets(sysConfig)); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(withoutSecrets(sysConfig), "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(ConfigFile, data, 0644)
+	if err := os.WriteFile(ConfigFile, data, 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file
+	return os.Chmod(ConfigFile, 0600)
 }
 
 func main() {
@@ -108,40 +134,84 @@ func main() {
 		}()
 	}
 
+	// Strategy storage needs the database connection when MongoDB is selected
+	initStrategyStore()
+
 	// Serve Static Files
 	fs := http.FileServer(http.Dir("./web"))
 	http.Handle("/", fs)
 
+	// Authentication Endpoints
+	http.HandleFunc("/api/auth/login", handleLogin)
+	http.HandleFunc("/api/auth/logout", handleLogout)
+	http.HandleFunc("/api/auth/setup", handleSetup)
+	http.HandleFunc("/api/auth/me", handleMe)
+	http.HandleFunc("/api/users", requireRole(roleAdmin, handleUsers))
+
 	// API Endpoints
-	http.HandleFunc("/api/stats", handleStats)
-	http.HandleFunc("/api/trades", handleTrades)
-	http.HandleFunc("/api/sessions", handleSessions)
-	http.HandleFunc("/ws", handleWebSocket)
-	http.HandleFunc("/api/settings", handleSettings)
+	http.HandleFunc("/api/stats", requireRole(roleViewer, handleStats))
+	http.HandleFunc("/api/trades", requireRole(roleViewer, handleTrades))
+	http.HandleFunc("/api/sessions", requireRole(roleViewer, handleSessions))
+	http.HandleFunc("/ws", requireRole(roleViewer, handleWebSocket))
+	http.HandleFunc("/api/settings", requireRole(roleAdmin, handleSettings))
+	http.HandleFunc("/api/accounts", requireRole(roleViewer, handleAccounts))
 
 	// Bot Control Endpoints (Placeholder for now)
-	http.HandleFunc("/api/bot/start", handleBotStart)
-	http.HandleFunc("/api/bot/stop", handleBotStop)
-	http.HandleFunc("/api/bot/status", handleBotStatus)
+	http.HandleFunc("/api/bot/start", requireRole(roleTrader, handleBotStart))
+	http.HandleFunc("/api/bot/stop", requireRole(roleTrader, handleBotStop))
+	http.HandleFunc("/api/bot/status", requireRole(roleViewer, handleBotStatus))
 
 	// Strategy Management
-	http.HandleFunc("/api/strategies/list", handleStrategiesList)
-	http.HandleFunc("/api/strategies/get", handleStrategyGet)
-	http.HandleFunc("/api/strategies/save", handleStrategySave)
-	http.HandleFunc("/api/strategies/delete", handleStrategyDelete)
+	http.HandleFunc("/api/strategies/list", requireRole(roleViewer, handleStrategiesList))
+	http.HandleFunc("/api/strategies/get", requireRole(roleViewer, handleStrategyGet))
+	http.HandleFunc("/api/strategies/save", requireRole(roleTrader, handleStrategySave))
+	http.HandleFunc("/api/strategies/delete", requireRole(roleTrader, handleStrategyDelete))
+	http.HandleFunc("/api/strategies/validate", requireRole(roleViewer, handleStrategyValidate))
+	http.HandleFunc("/api/strategies/convert", requireRole(roleViewer, handleStrategyConvert))
+	http.HandleFunc("/api/strategies/check", requireRole(roleViewer, handleStrategyCheck))
+	http.HandleFunc("/api/strategies/params", requireReadWriteRole(roleViewer, roleTrader, handleStrategyParams))
+	http.HandleFunc("/api/strategies/versions", requireRole(roleViewer, handleStrategyVersions))
+	http.HandleFunc("/api/strategies/diff", requireRole(roleViewer, handleStrategyDiff))
+	http.HandleFunc("/api/strategies/restore", requireRole(roleTrader, handleStrategyRestore))
+	http.HandleFunc("/api/strategies/export", requireRole(roleViewer, handleStrategyExport))
+	http.HandleFunc("/api/strategies/import", requireRole(roleTrader, handleStrategyImport))
 
 	// Journal & Logs
-	http.HandleFunc("/api/journal/list", handleJournalList)
-	http.HandleFunc("/api/journal/create", handleJournalCreate)
-	http.HandleFunc("/api/journal/delete", handleJournalDelete)
-	http.HandleFunc("/api/logs/download", handleLogsDownload)
+	http.HandleFunc("/api/journal/list", requireRole(roleViewer, handleJournalList))
+	http.HandleFunc("/api/journal/create", requireRole(roleTrader, handleJournalCreate))
+	http.HandleFunc("/api/journal/delete", requireRole(roleTrader, handleJournalDelete))
+	http.HandleFunc("/api/logs/download", requireRole(roleViewer, handleLogsDownload))
 
 	// Analytics & AI
-	http.HandleFunc("/api/analytics/cashflow", handleCashFlow)
-	http.HandleFunc("/api/analytics/report", handleTradeReport)
-	http.HandleFunc("/api/analytics/analyze", handleAIAnalyze)
-	http.HandleFunc("/api/analytics/generate-strategy", handleAIGenerateStrategy)
-	http.HandleFunc("/api/trades/export", handleTradesExport)
+	http.HandleFunc("/api/analytics/cashflow", requireRole(roleViewer, handleCashFlow))
+	http.HandleFunc("/api/analytics/report", requireRole(roleViewer, handleTradeReport))
+	http.HandleFunc("/api/analytics/analyze", requireRole(roleTrader, handleAIAnalyze))
+	http.HandleFunc("/api/analytics/generate-strategy", requireRole(roleTrader, handleAIGenerateStrategy))
+	http.HandleFunc("/api/analytics/simulate", requireRole(roleViewer, handleSimulate))
+	http.HandleFunc("/api/analytics/digits", requireRole(roleViewer, handleDigits))
+	http.HandleFunc("/api/trades/export", requireRole(roleViewer, handleTradesExport))
+
+	// Open positions across bots and manual trades
+	http.HandleFunc("/api/portfolio", requireRole(roleViewer, handlePortfolio))
+
+	// Reconciliation of stored trades with the account's profit table
+	http.HandleFunc("/api/reconcile/run", requireRole(roleTrader, handleReconcileRun))
+	http.HandleFunc("/api/reconcile/reports", requireRole(roleViewer, handleReconcileReports))
+	http.HandleFunc("/api/reconcile/report", requireRole(roleViewer, handleReconcileReport))
+
+	// Manual trading next to the bots
+	http.HandleFunc("/api/trade/proposal", requireRole(roleTrader, handleTradeProposal))
+	http.HandleFunc("/api/trade/buy", requireRole(roleTrader, handleTradeBuy))
+	http.HandleFunc("/api/trade/sell", requireRole(roleTrader, handleTradeSell))
+	http.HandleFunc("/api/trade/limits", requireRole(roleTrader, handleTradeLimits))
+	http.HandleFunc("/api/trade/open", requireRole(roleViewer, handleTradeOpen))
+
+	// Recorded ticks and optimization
+	http.HandleFunc("/api/ticks/record", requireRole(roleTrader, handleTicksRecord))
+	http.HandleFunc("/api/optimizer/run", requireRole(roleTrader, handleOptimizerRun))
+	http.HandleFunc("/api/optimizer/runs", requireRole(roleViewer, handleOptimizerRuns))
+	http.HandleFunc("/api/optimizer/result", requireRole(roleViewer, handleOptimizerResult))
+	http.HandleFunc("/api/optimizer/walkforward", requireRole(roleTrader, handleOptimizerWalkForward))
 
 	// Server
 	port := getPort()
@@ -262,6 +332,7 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	clientsMu.Unlock()
 
 	log.Println("New WebSocket client connected")
+	startPortfolio()
 
 	for {
 		_, _, err := ws.ReadMessage()
@@ -321,6 +392,7 @@ func handleBotStatus(w http.ResponseWriter, r *http.Request) {
 
 	if botManager.running && !botManager.startTime.IsZero() {
 		response["start_time"] = botManager.startTime.Unix()
+		response["account"] = botManager.account
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -332,15 +404,34 @@ func handleSettings(w http.ResponseWriter, r *http.Request) {
 		sysConfigMu.RLock()
 		defer sysConfigMu.RUnlock()
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(sysConfig)
+		json.NewEncoder(w).Encode(maskedConfig(sysConfig))
 	} else if r.Method == http.MethodPost {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		var newConfig SystemConfig
-		if err := json.NewDecoder(r.Body).Decode(&newConfig); err != nil {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(body, &newConfig); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		json.Unmarshal(body, &fields)
 
 		sysConfigMu.Lock()
+		keepSecrets(sysConfig, &newConfig, fields)
+		assignAccountIDs(newConfig.Accounts)
+		if err := validateAccounts(newConfig.Accounts); err != nil {
+			sysConfigMu.Unlock()
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if secrets == nil {
+			sysConfigMu.Unlock()
+			http.Error(w, "Secret store is not available; check the passphrase or keyfile", http.StatusServiceUnavailable)
+			return
+		}
 		sysConfig = newConfig
 		sysConfigMu.Unlock()
 
@@ -348,6 +439,7 @@ func handleSettings(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Failed to save config", http.StatusInternalServerError)
 			return
 		}
+		initStrategyStore()
 
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(map[string]string{"status": "saved"})
@@ -364,6 +456,7 @@ type BotManager struct {
 	logChan   chan string
 	stopChan  chan struct{}
 	startTime time.Time
+	account   string // account the running bot trades on
 }
 
 type BotConfig struct {
@@ -371,6 +464,7 @@ type BotConfig struct {
 	Duration        int     `json:"duration"`
 	DurationUnit    string  `json:"duration_unit"`
 	Barrier         string  `json:"barrier"`
+	Prediction      *int    `json:"prediction,omitempty"` // digit for digit contracts; nil lets the strategy choose
 	Multiplier      int     `json:"multiplier"`
 	InitialStake    float64 `json:"initial_stake"`
 	TargetProfit    float64 `json:"target_profit"`
@@ -380,6 +474,33 @@ type BotConfig struct {
 	Symbol          string  `json:"symbol"`
 	UseTrailingStop bool    `json:"use_trailing_stop"`
 	Script          string  `json:"script"` // Custom strategy script content
+	WarmupTicks     int     `json:"warmup_ticks"`
+
+	// Named account from SystemConfig.Accounts to trade on; "" is the default account
+	Account string `json:"account,omitempty"`
+
+	// Per-trade multiplier limits and deal cancellation window; 0/"" disables
+	TakeProfit       float64 `json:"take_profit,omitempty"`
+	TradeStopLoss    float64 `json:"trade_stop_loss,omitempty"`
+	DealCancellation string  `json:"deal_cancellation,omitempty"`
+	// Per-position trailing take profit for multipliers; 0 distance disables
+	TrailActivation float64 `json:"trail_activation,omitempty"`
+	TrailDistance   float64 `json:"trail_distance,omitempty"`
+
+	// Early exit rules for sellable contracts; 0 disables, or uses the
+	// default sell tolerance
+	ExitBidPercent    float64 `json:"exit_bid_percent,omitempty"`
+	ExitAdverseTicks  int     `json:"exit_adverse_ticks,omitempty"`
+	ExitSellTolerance float64 `json:"exit_sell_tolerance,omitempty"`
+
+	// Entry limits: contracts open at once (0 means 1) and spacing between entries
+	MaxOpenPositions int `json:"max_open_positions,omitempty"`
+	MinEntryTicks    int `json:"min_entry_ticks,omitempty"`
+	MinEntrySeconds  int `json:"min_entry_seconds,omitempty"`
+
+	// Script parameter values; when omitted, the values saved for ScriptName are used
+	Params     map[string]interface{} `json:"params,omitempty"`
+	ScriptName string                 `json:"script_name,omitempty"`
 }
 
 var botManager = &BotManager{
@@ -408,11 +529,40 @@ func (bm *BotManager) Start(config BotConfig) error {
 		"-streak", strconv.Itoa(config.StreakThreshold),
 		"-symbol", config.Symbol,
 		"-trailing_stop=" + strconv.FormatBool(config.UseTrailingStop),
+		"-warmup", strconv.Itoa(config.WarmupTicks),
+		"-max_open", strconv.Itoa(config.MaxOpenPositions),
+		"-min_ticks", strconv.Itoa(config.MinEntryTicks),
+		"-min_seconds", strconv.Itoa(config.MinEntrySeconds),
 	}
 
 	if config.Barrier != "" {
 		args = append(args, "-barrier", config.Barrier)
 	}
+	if config.TakeProfit > 0 {
+		args = append(args, "-take_profit", fmt.Sprintf("%f", config.TakeProfit))
+	}
+	if config.TradeStopLoss > 0 {
+		args = append(args, "-trade_stop_loss", fmt.Sprintf("%f", config.TradeStopLoss))
+	}
+	if config.TrailDistance > 0 {
+		args = append(args, "-trail_activation", fmt.Sprintf("%f", config.TrailActivation))
+		args = append(args, "-trail_distance", fmt.Sprintf("%f", config.TrailDistance))
+	}
+	if config.ExitBidPercent > 0 {
+		args = append(args, "-exit_bid_percent", fmt.Sprintf("%f", config.ExitBidPercent))
+	}
+	if config.ExitAdverseTicks > 0 {
+		args = append(args, "-exit_adverse_ticks", strconv.Itoa(config.ExitAdverseTicks))
+	}
+	if config.ExitSellTolerance > 0 {
+		args = append(args, "-exit_sell_tolerance", fmt.Sprintf("%f", config.ExitSellTolerance))
+	}
+	if config.DealCancellation != "" {
+		args = append(args, "-cancellation", config.DealCancellation)
+	}
+	if config.Prediction != nil {
+		args = append(args, "-prediction", strconv.Itoa(*config.Prediction))
+	}
 
 	// Note: The Go binary now accepts all these flags.
 
@@ -435,16 +585,41 @@ func (bm *BotManager) Start(config BotConfig) error {
 
 	bm.cmd = exec.Command(binaryName, args...)
 
-	// Inject API Token from config
+	// Inject the API token of the chosen account
+	token, err := accountToken(config.Account)
+	if err != nil {
+		return err
+	}
 	bm.cmd.Env = os.Environ()
-	sysConfigMu.RLock()
-	token := sysConfig.DerivAPIToken
-	sysConfigMu.RUnlock()
 	bm.cmd.Env = append(bm.cmd.Env, "DERIV_API_TOKEN="+token)
 
-	// Inject STRATEGY_SCRIPT if present in config (custom strategy)
-	if config.Strategy == "custom" && config.Script != "" {
+	// Inject STRATEGY_SCRIPT if present in config (custom JS or DBot XML strategy)
+	if (config.Strategy == "custom" || config.Strategy == "dbot") && config.Script != "" {
 		bm.cmd.Env = append(bm.cmd.Env, "STRATEGY_SCRIPT="+config.Script)
+		if config.ScriptName != "" {
+			bm.cmd.Env = append(bm.cmd.Env, "STRATEGY_NAME="+config.ScriptName)
+		}
+	}
+
+	// Inject STRATEGY_PARAMS for custom scripts that declare parameters
+	if config.Strategy == "custom" {
+		params := config.Params
+		if params == nil && config.ScriptName != "" {
+			if saved, err := getStrategyStore().Get(context.Background(), config.ScriptName); err == nil {
+				params = saved.Params
+			}
+		}
+		params, err := strategy.ResolveScriptParams(config.Script, params)
+		if err != nil {
+			return fmt.Errorf("invalid strategy parameters: %w", err)
+		}
+		if len(params) > 0 {
+			data, err := json.Marshal(params)
+			if err != nil {
+				return err
+			}
+			bm.cmd.Env = append(bm.cmd.Env, "STRATEGY_PARAMS="+string(data))
+		}
 	}
 
 	// Create pipes for stdout and stderr
@@ -463,10 +638,15 @@ func (bm *BotManager) Start(config BotConfig) error {
 
 	bm.running = true
 	bm.startTime = time.Now()
+	bm.account = config.Account
+	if bm.account == "" {
+		bm.account = defaultAccountName
+	}
 
 	// Stream logs
-	go bm.streamOutput(stdoutPipe)
-	go bm.streamOutput(stderrPipe)
+	bot := botLabel(config)
+	go bm.streamOutput(stdoutPipe, bot)
+	go bm.streamOutput(stderrPipe, bot)
 
 	// Monitor process in background
 	go func() {
@@ -479,7 +659,7 @@ func (bm *BotManager) Start(config BotConfig) error {
 		broadcast("Bot stopped", "info")
 	}()
 
-	broadcast(fmt.Sprintf("Bot started with strategy: %s", config.Strategy), "info")
+	broadcast(fmt.Sprintf("Bot started with strategy: %s on account: %s", config.Strategy, bm.account), "info")
 	return nil
 }
 
@@ -499,22 +679,26 @@ func (bm *BotManager) Stop() error {
 	return nil
 }
 
-func (bm *BotManager) streamOutput(r io.Reader) {
+func (bm *BotManager) streamOutput(r io.Reader, bot string) {
 	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		text := scanner.Text()
+		trackBotContract(text, bot)
 		// Send to WebSocket
 		broadcast(text, "log")
 	}
 }
 
 func broadcast(message, type_ string) {
-	msg := map[string]string{
+	broadcastJSON(map[string]string{
 		"type":    type_,
 		"message": message,
 		"time":    time.Now().Format("15:04:05"),
-	}
+	})
+}
 
+// broadcastJSON sends msg to every WebSocket client as JSON.
+func broadcastJSON(msg interface{}) {
 	clientsMu.Lock()
 	defer clientsMu.Unlock()
 
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+
+	"deriv_trade/database"
+	"deriv_trade/strategy"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// optimizeTimeout bounds a background optimization run.
+	optimizeTimeout = 30 * time.Minute
+	// defaultOptimizeTop is how many ranked results a run keeps.
+	defaultOptimizeTop = 100
+	// defaultBacktestTicks is how many recent ticks are used when no range is given.
+	defaultBacktestTicks = 50000
+)
+
+// OptimizeRequest starts a parameter search over recorded ticks. Config holds
+// the fixed bot settings; Ranges the parameters to vary.
+type OptimizeRequest struct {
+	Config  BotConfig                      `json:"config"`
+	From    time.Time                      `json:"from"`
+	To      time.Time                      `json:"to"`
+	Limit   int64                          `json:"limit"` // most recent ticks to use
+	Ranges  map[string]strategy.ParamRange `json:"ranges"`
+	Mode    string                         `json:"mode"` // "grid" or "random"
+	Samples int                            `json:"samples"`
+	Metric  string                         `json:"metric"`
+	Payout  float64                        `json:"payout"`
+	Workers int                            `json:"workers"` // 0 uses one per CPU
+	Seed    int64                          `json:"seed"`
+	Top     int                            `json:"top"`
+}
+
+// backtestConfig maps bot settings onto the strategy config a backtest replays.
+func backtestConfig(c BotConfig) strategy.Config {
+	// Without a prediction the strategy picks its own digit, as the bot does
+	prediction := -1
+	if c.Prediction != nil {
+		prediction = *c.Prediction
+	}
+	return strategy.Config{
+		Symbol:          c.Symbol,
+		Duration:        c.Duration,
+		DurationUnit:    c.DurationUnit,
+		InitialStake:    c.InitialStake,
+		MartingaleMulti: c.Martingale,
+		StreakThreshold: c.StreakThreshold,
+		TargetProfit:    c.TargetProfit,
+		StopLoss:        c.StopLoss,
+		Barrier:         c.Barrier,
+		Prediction:      prediction,
+		StrategyName:    c.Strategy,
+		UseTrailingStop: c.UseTrailingStop,
+	}
+}
+
+// loadBacktestTicks reads recorded ticks for a backtest, defaulting to the
+// most recent defaultBacktestTicks when no range or limit is given.
+func loadBacktestTicks(ctx context.Context, symbol string, from, to time.Time, limit int64) ([]database.Tick, error) {
+	if limit <= 0 && from.IsZero() && to.IsZero() {
+		limit = defaultBacktestTicks
+	}
+	ticks, err := dbClient.GetTicks(ctx, symbol, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(ticks) == 0 {
+		return nil, fmt.Errorf("no recorded ticks for %s in the requested range; record some with /api/ticks/record", symbol)
+	}
+	if err := fillPipSize(ticks, symbol); err != nil {
+		return nil, err
+	}
+	return ticks, nil
+}
+
+// fillPipSize sets the pip size of ticks recorded without one from the
+// symbol's active_symbols entry, so their last digits keep trailing zeros.
+func fillPipSize(ticks []database.Tick, symbol string) error {
+	missing := false
+	for _, t := range ticks {
+		missing = missing || t.PipSize <= 0
+	}
+	if !missing {
+		return nil
+	}
+
+	api, err := newDerivAPI()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Deriv API for the pip size of %s: %w", symbol, err)
+	}
+	defer api.Disconnect()
+	pipSize := strategy.SymbolPipSize(api, symbol)
+	if pipSize <= 0 {
+		return fmt.Errorf("pip size of %s is unknown", symbol)
+	}
+	for i := range ticks {
+		if ticks[i].PipSize <= 0 {
+			ticks[i].PipSize = pipSize
+		}
+	}
+	return nil
+}
+
+// optimizeWorkers clamps the requested parallel backtests to [1, NumCPU] so a
+// request can't start more goroutines than the machine can run.
+func optimizeWorkers(requested int) int {
+	cpus := runtime.NumCPU()
+	switch {
+	case requested == 0 || requested > cpus:
+		return cpus
+	case requested < 1:
+		return 1
+	}
+	return requested
+}
+
+// optimizeOptions maps a request onto the strategy package's search options.
+func (req OptimizeRequest) optimizeOptions() strategy.OptimizeOptions {
+	return strategy.OptimizeOptions{
+		Base:    backtestConfig(req.Config),
+		Ranges:  req.Ranges,
+		Mode:    req.Mode,
+		Samples: req.Samples,
+		Metric:  req.Metric,
+		Payout:  req.Payout,
+		Workers: optimizeWorkers(req.Workers),
+		Seed:    req.Seed,
+		Top:     req.Top,
+	}
+}
+
+// handleOptimizerRun validates a search, records it as running and runs it in
+// the background. Poll /api/optimizer/result?id= for the ranked results.
+func handleOptimizerRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if dbClient == nil {
+		http.Error(w, "Database not connected", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req OptimizeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Top <= 0 {
+		req.Top = defaultOptimizeTop
+	}
+
+	opts := req.optimizeOptions()
+	values, combos, err := opts.Candidates()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ticks, err := loadBacktestTicks(r.Context(), req.Config.Symbol, req.From, req.To, req.Limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	run := &database.OptimizationRun{
+		Strategy:     req.Config.Strategy,
+		Symbol:       req.Config.Symbol,
+		Mode:         req.Mode,
+		Metric:       req.Metric,
+		Ranges:       values,
+		Base:         configToMap(&req.Config),
+		Status:       "running",
+		Combinations: len(combos),
+		From:         time.Unix(ticks[0].Epoch, 0).UTC(),
+		To:           time.Unix(ticks[len(ticks)-1].Epoch, 0).UTC(),
+		Ticks:        len(ticks),
+	}
+	if run.Mode == "" {
+		run.Mode = "grid"
+	}
+	if run.Metric == "" {
+		run.Metric = "net_pnl"
+	}
+	if err := dbClient.CreateOptimization(r.Context(), run); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	go runOptimization(run.ID, opts, ticks)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":           run.ID,
+		"status":       run.Status,
+		"combinations": run.Combinations,
+		"ticks":        run.Ticks,
+	})
+}
+
+func runOptimization(id primitive.ObjectID, opts strategy.OptimizeOptions, ticks []database.Tick) {
+	ctx, cancel := context.WithTimeout(context.Background(), optimizeTimeout)
+	defer cancel()
+
+	started := time.Now()
+	results, err := strategy.Optimize(ctx, opts, ticks)
+	completed := time.Now()
+
+	update := bson.M{"completed_at": completed}
+	if err != nil {
+		update["status"] = "failed"
+		update["error"] = err.Error()
+		broadcast(fmt.Sprintf("Optimization %s failed: %v", id.Hex(), err), "error")
+	} else {
+		update["status"] = "completed"
+		update["results"] = results
+		broadcast(fmt.Sprintf("Optimization %s completed in %s", id.Hex(), completed.Sub(started).Round(time.Second)), "info")
+	}
+
+	saveCtx, saveCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer saveCancel()
+	if err := dbClient.UpdateOptimization(saveCtx, id, update); err != nil {
+		log.Printf("Failed to save optimization %s: %v", id.Hex(), err)
+	}
+}
+
+func handleOptimizerRuns(w http.ResponseWriter, r *http.Request) {
+	if dbClient == nil {
+		http.Error(w, "Database not connected", http.StatusServiceUnavailable)
+		return
+	}
+
+	limit := int64(50)
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if n, err := strconv.ParseInt(l, 10, 64); err == nil {
+			limit = n
+		}
+	}
+
+	runs, err := dbClient.GetOptimizations(r.Context(), limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if runs == nil {
+		runs = []database.OptimizationRun{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runs)
+}
+
+func handleOptimizerResult(w http.ResponseWriter, r *http.Request) {
+	if dbClient == nil {
+		http.Error(w, "Database not connected", http.StatusServiceUnavailable)
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+
+	run, err := dbClient.GetOptimization(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if run == nil {
+		http.Error(w, "Optimization not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
+// handleOptimizerWalkForward re-optimizes over rolling in-sample windows and
+// reports how the chosen parameters performed on the out-of-sample windows.
+func handleOptimizerWalkForward(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if dbClient == nil {
+		http.Error(w, "Database not connected", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		OptimizeRequest
+		InSample  int  `json:"in_sample"`
+		OutSample int  `json:"out_sample"`
+		Step      int  `json:"step"`
+		Anchored  bool `json:"anchored"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	opts := strategy.WalkForwardOptions{
+		Optimize:  req.optimizeOptions(),
+		InSample:  req.InSample,
+		OutSample: req.OutSample,
+		Step:      req.Step,
+		Anchored:  req.Anchored,
+	}
+	if _, _, err := opts.Optimize.Candidates(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ticks, err := loadBacktestTicks(r.Context(), req.Config.Symbol, req.From, req.To, req.Limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), optimizeTimeout)
+	defer cancel()
+	report, err := strategy.WalkForward(ctx, opts, ticks)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"deriv_trade/strategy"
+
+	"github.com/ksysoev/deriv-api"
+	"github.com/ksysoev/deriv-api/schema"
+)
+
+const (
+	// portfolioRefresh is how often the open contracts are listed again to
+	// pick up contracts the account-wide stream does not report and to
+	// drop ones that closed without a final update.
+	portfolioRefresh = 15 * time.Second
+	// portfolioRetry is the wait before reconnecting after the service stops.
+	portfolioRetry = 10 * time.Second
+	// unknownBot labels positions opened outside the bots and manual trading.
+	unknownBot = "other"
+)
+
+// Position is an open contract on the account with its unrealized PnL.
+type Position struct {
+	ContractID   int       `json:"contract_id"`
+	Account      string    `json:"account"`
+	ContractType string    `json:"contract_type"`
+	Symbol       string    `json:"symbol"`
+	Bot          string    `json:"bot"`
+	BuyPrice     float64   `json:"buy_price"`
+	BidPrice     float64   `json:"bid_price"`
+	Payout       float64   `json:"payout,omitempty"`
+	Profit       float64   `json:"profit"`
+	ValidToSell  bool      `json:"valid_to_sell"`
+	PurchaseTime int64     `json:"purchase_time"`
+	Updated      time.Time `json:"updated"`
+}
+
+// BotExposure sums the open positions of one bot on one account.
+type BotExposure struct {
+	Bot           string  `json:"bot"`
+	Account       string  `json:"account"`
+	Positions     int     `json:"positions"`
+	Staked        float64 `json:"staked"`
+	UnrealizedPnL float64 `json:"unrealized_pnl"`
+}
+
+// PortfolioSnapshot is the response of /api/portfolio.
+type PortfolioSnapshot struct {
+	Running       bool          `json:"running"`
+	Positions     []Position    `json:"positions"`
+	Bots          []BotExposure `json:"bots"`
+	UnrealizedPnL float64       `json:"unrealized_pnl"`
+}
+
+// portfolio holds the open contracts of every account, kept current by
+// runPortfolio, and which bot opened each of them.
+var portfolio = struct {
+	sync.Mutex
+	running   map[string]bool // account name -> service running
+	positions map[int]*Position
+	owners    map[int]string // contract id -> bot, from the bots' logs and manual trades
+}{running: map[string]bool{}, positions: map[int]*Position{}, owners: map[int]string{}}
+
+// setContractOwner records the bot that opened a contract.
+func setContractOwner(contractID int, bot string) {
+	portfolio.Lock()
+	defer portfolio.Unlock()
+	portfolio.owners[contractID] = bot
+	if p, ok := portfolio.positions[contractID]; ok {
+		p.Bot = bot
+	}
+}
+
+// ownerLocked returns the bot that opened a contract. Callers hold portfolio.
+func ownerLocked(contractID int) string {
+	if bot, ok := portfolio.owners[contractID]; ok {
+		return bot
+	}
+	return unknownBot
+}
+
+// startPortfolio starts tracking the open contracts of every configured
+// account that is not tracked yet.
+func startPortfolio() {
+	accounts := configuredAccounts()
+
+	portfolio.Lock()
+	defer portfolio.Unlock()
+	for _, a := range accounts {
+		if portfolio.running[a.Name] {
+			continue
+		}
+		portfolio.running[a.Name] = true
+		go func(a Account) {
+			runPortfolio(a.Name, a.Token)
+			// Let the next request start the service again, after a pause so a
+			// bad token or a dead connection is not retried in a loop
+			time.Sleep(portfolioRetry)
+			portfolio.Lock()
+			delete(portfolio.running, a.Name)
+			portfolio.Unlock()
+		}(a)
+	}
+}
+
+func runPortfolio(account, token string) {
+	api, err := newDerivAPI()
+	if err != nil {
+		log.Printf("Portfolio %s: failed to connect to Deriv API: %v", account, err)
+		return
+	}
+	defer api.Disconnect()
+	if _, err := api.Authorize(schema.Authorize{Authorize: token}); err != nil {
+		log.Printf("Portfolio %s: authorization failed: %v", account, err)
+		return
+	}
+
+	// Without a contract id the stream covers every open contract
+	sub := schema.ProposalOpenContractSubscribe(1)
+	_, stream, err := api.SubscribeProposalOpenContract(schema.ProposalOpenContract{
+		ProposalOpenContract: 1,
+		Subscribe:            &sub,
+	})
+	if err != nil {
+		log.Printf("Portfolio %s: failed to subscribe to open contracts: %v", account, err)
+		return
+	}
+	defer stream.Forget()
+
+	watched := map[int]bool{} // contracts with their own subscription
+	refresh := time.NewTicker(portfolioRefresh)
+	defer refresh.Stop()
+	refreshPortfolio(api, account, watched)
+
+	for {
+		select {
+		case <-refresh.C:
+			refreshPortfolio(api, account, watched)
+		case update, ok := <-stream.Stream:
+			if !ok {
+				log.Printf("Portfolio %s: open contract stream closed", account)
+				return
+			}
+			if update.ProposalOpenContract != nil {
+				updatePosition(account, update.ProposalOpenContract)
+			}
+		}
+	}
+}
+
+// refreshPortfolio lists the account's open contracts, adds the ones not
+// tracked yet with their own subscription, and drops tracked ones that are
+// gone.
+func refreshPortfolio(api *deriv.DerivAPI, account string, watched map[int]bool) {
+	resp, err := api.Portfolio(schema.Portfolio{Portfolio: 1})
+	if err != nil || resp.Portfolio == nil {
+		log.Printf("Portfolio %s: failed to list open contracts: %v", account, err)
+		return
+	}
+
+	open := map[int]bool{}
+	for _, c := range resp.Portfolio.Contracts {
+		if c.ContractId == nil {
+			continue
+		}
+		id := *c.ContractId
+		open[id] = true
+
+		portfolio.Lock()
+		_, known := portfolio.positions[id]
+		if !known {
+			p := &Position{ContractID: id, Account: account, Bot: ownerLocked(id), Updated: time.Now()}
+			if c.ContractType != nil {
+				p.ContractType = *c.ContractType
+			}
+			if c.Symbol != nil {
+				p.Symbol = *c.Symbol
+			}
+			if c.BuyPrice != nil {
+				p.BuyPrice = *c.BuyPrice
+			}
+			if c.Payout != nil {
+				p.Payout = *c.Payout
+			}
+			if c.PurchaseTime != nil {
+				p.PurchaseTime = int64(*c.PurchaseTime)
+			}
+			portfolio.positions[id] = p
+		}
+		portfolio.Unlock()
+
+		if !known && !watched[id] {
+			watched[id] = true
+			go watchContract(api, account, id)
+		}
+	}
+
+	portfolio.Lock()
+	var closed []Position
+	for id, p := range portfolio.positions {
+		if p.Account == account && !open[id] {
+			closed = append(closed, *p)
+			delete(portfolio.positions, id)
+			delete(portfolio.owners, id)
+		}
+	}
+	portfolio.Unlock()
+	for id := range watched {
+		if !open[id] {
+			delete(watched, id)
+		}
+	}
+	for _, p := range closed {
+		broadcastJSON(map[string]interface{}{"type": "position_closed", "position": p})
+	}
+}
+
+// watchContract streams one contract the account-wide stream missed.
+func watchContract(api *deriv.DerivAPI, account string, contractID int) {
+	sub := schema.ProposalOpenContractSubscribe(1)
+	_, stream, err := api.SubscribeProposalOpenContract(schema.ProposalOpenContract{
+		ProposalOpenContract: 1,
+		ContractId:           &contractID,
+		Subscribe:            &sub,
+	})
+	if err != nil {
+		log.Printf("Portfolio %s: failed to subscribe to contract %d: %v", account, contractID, err)
+		return
+	}
+	defer stream.Forget()
+
+	for update := range stream.Stream {
+		poc := update.ProposalOpenContract
+		if poc == nil {
+			continue
+		}
+		updatePosition(account, poc)
+		if poc.IsSold != nil && *poc.IsSold == 1 {
+			return
+		}
+	}
+}
+
+// updatePosition applies a proposal_open_contract update and pushes it to
+// the dashboard.
+func updatePosition(account string, poc *schema.ProposalOpenContractRespProposalOpenContract) {
+	if poc.ContractId == nil {
+		return
+	}
+	id := *poc.ContractId
+
+	portfolio.Lock()
+	p, ok := portfolio.positions[id]
+	if !ok {
+		p = &Position{ContractID: id, Account: account, Bot: ownerLocked(id)}
+	}
+	if poc.ContractType != nil {
+		p.ContractType = *poc.ContractType
+	}
+	if poc.Underlying != nil {
+		p.Symbol = *poc.Underlying
+	}
+	if poc.BuyPrice != nil {
+		p.BuyPrice = *poc.BuyPrice
+	}
+	if poc.BidPrice != nil {
+		p.BidPrice = *poc.BidPrice
+	}
+	if poc.Payout != nil {
+		p.Payout = *poc.Payout
+	}
+	if poc.Profit != nil {
+		p.Profit = *poc.Profit
+	}
+	if poc.PurchaseTime != nil {
+		p.PurchaseTime = int64(*poc.PurchaseTime)
+	}
+	p.ValidToSell = poc.IsValidToSell != nil && *poc.IsValidToSell == 1
+	p.Updated = time.Now()
+
+	sold := poc.IsSold != nil && *poc.IsSold == 1
+	if sold {
+		delete(portfolio.positions, id)
+		delete(portfolio.owners, id)
+	} else {
+		portfolio.positions[id] = p
+	}
+	position := *p
+	portfolio.Unlock()
+
+	msgType := "position"
+	if sold {
+		msgType = "position_closed"
+	}
+	broadcastJSON(map[string]interface{}{"type": msgType, "position": position})
+}
+
+// portfolioSnapshot returns the open positions, newest first, with their
+// unrealized PnL per bot.
+func portfolioSnapshot() PortfolioSnapshot {
+	portfolio.Lock()
+	defer portfolio.Unlock()
+
+	snap := PortfolioSnapshot{Running: len(portfolio.running) > 0, Positions: []Position{}, Bots: []BotExposure{}}
+	bots := map[[2]string]*BotExposure{}
+	for _, p := range portfolio.positions {
+		snap.Positions = append(snap.Positions, *p)
+		snap.UnrealizedPnL += p.Profit
+		key := [2]string{p.Account, p.Bot}
+		b, ok := bots[key]
+		if !ok {
+			b = &BotExposure{Bot: p.Bot, Account: p.Account}
+			bots[key] = b
+		}
+		b.Positions++
+		b.Staked += p.BuyPrice
+		b.UnrealizedPnL += p.Profit
+	}
+	for _, b := range bots {
+		snap.Bots = append(snap.Bots, *b)
+	}
+	sort.Slice(snap.Positions, func(i, j int) bool {
+		return snap.Positions[i].PurchaseTime > snap.Positions[j].PurchaseTime
+	})
+	sort.Slice(snap.Bots, func(i, j int) bool {
+		if snap.Bots[i].Account != snap.Bots[j].Account {
+			return snap.Bots[i].Account < snap.Bots[j].Account
+		}
+		return snap.Bots[i].Bot < snap.Bots[j].Bot
+	})
+	return snap
+}
+
+// handlePortfolio returns the open positions of every account and their
+// unrealized PnL per bot, starting the portfolio service on first use.
+func handlePortfolio(w http.ResponseWriter, r *http.Request) {
+	startPortfolio()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(portfolioSnapshot())
+}
+
+// botLabel names a bot run in the portfolio: the strategy, and the script
+// for custom and DBot strategies.
+func botLabel(config BotConfig) string {
+	if config.ScriptName != "" {
+		return config.Strategy + ":" + config.ScriptName
+	}
+	return config.Strategy
+}
+
+// trackBotContract attributes a contract to the bot whose log line
+// announced it.
+func trackBotContract(line, bot string) {
+	if id, ok := strategy.ParseContractOpened(line); ok {
+		setContractOwner(id, bot)
+	}
+}
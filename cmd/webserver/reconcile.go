@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"deriv_trade/database"
+	"deriv_trade/strategy"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// reconcileTimeout bounds a background reconciliation.
+	reconcileTimeout = 10 * time.Minute
+	// defaultReconcileRange is the period reconciled when no range is given.
+	defaultReconcileRange = 24 * time.Hour
+	// maxReconcileRange caps the period of one reconciliation.
+	maxReconcileRange = 31 * 24 * time.Hour
+)
+
+// handleReconcileRun starts reconciling the stored trades with an account's
+// profit table for a time range, by default the default account and the
+// last 24 hours.
+func handleReconcileRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if dbClient == nil {
+		http.Error(w, "Database not connected", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Account string    `json:"account"`
+		From    time.Time `json:"from"`
+		To      time.Time `json:"to"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.To.IsZero() {
+		req.To = time.Now()
+	}
+	if req.From.IsZero() {
+		req.From = req.To.Add(-defaultReconcileRange)
+	}
+	if !req.From.Before(req.To) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+	if req.To.Sub(req.From) > maxReconcileRange {
+		http.Error(w, "range must not exceed 31 days", http.StatusBadRequest)
+		return
+	}
+
+	if req.Account == "" {
+		req.Account = defaultAccountName
+	}
+	token, err := accountToken(req.Account)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report := &database.ReconciliationReport{
+		Account: req.Account,
+		From:    req.From.UTC(),
+		To:      req.To.UTC(),
+		Status:  "running",
+	}
+	if err := dbClient.CreateReconciliation(r.Context(), report); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	go runReconciliation(report.ID, report.From, report.To, token)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":      report.ID,
+		"account": report.Account,
+		"status":  report.Status,
+		"from":    report.From,
+		"to":      report.To,
+	})
+}
+
+func runReconciliation(id primitive.ObjectID, from, to time.Time, token string) {
+	ctx, cancel := context.WithTimeout(context.Background(), reconcileTimeout)
+	defer cancel()
+
+	update, err := reconcile(ctx, from, to, token)
+	update["completed_at"] = time.Now()
+	if err != nil {
+		update["status"] = "failed"
+		update["error"] = err.Error()
+		broadcast(fmt.Sprintf("Reconciliation %s failed: %v", id.Hex(), err), "error")
+	} else {
+		update["status"] = "completed"
+		broadcast(fmt.Sprintf("Reconciliation %s completed: %d contracts, %d matched, %d inserted, %d mismatched",
+			id.Hex(), update["contracts"], update["matched"], update["inserted"], update["mismatched"]), "info")
+	}
+
+	saveCtx, saveCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer saveCancel()
+	if err := dbClient.UpdateReconciliation(saveCtx, id, update); err != nil {
+		log.Printf("Failed to save reconciliation %s: %v", id.Hex(), err)
+	}
+}
+
+// reconcile downloads the profit table for the range, inserts the settled
+// contracts the database is missing and flags stored trades whose profit
+// differs. It returns the report fields to save, including the work done
+// before a failure.
+func reconcile(ctx context.Context, from, to time.Time, token string) (bson.M, error) {
+	update := bson.M{}
+
+	api, err := newDerivAPI()
+	if err != nil {
+		return update, fmt.Errorf("failed to connect to Deriv API: %w", err)
+	}
+	defer api.Disconnect()
+	account, err := strategy.AuthorizeAccount(api, token)
+	if err != nil {
+		return update, fmt.Errorf("authorization failed: %w", err)
+	}
+	update["login_id"] = account.LoginID
+
+	contracts, err := strategy.DownloadProfitTable(api, from, to)
+	if err != nil {
+		return update, fmt.Errorf("failed to download profit table: %w", err)
+	}
+	reported := make(map[string]bool, len(contracts))
+	ids := make([]string, 0, len(contracts))
+	derivPnL := 0.0
+	for _, c := range contracts {
+		reported[c.ContractID] = true
+		ids = append(ids, c.ContractID)
+		derivPnL += c.Profit
+	}
+	update["contracts"] = len(contracts)
+	update["deriv_pnl"] = derivPnL
+
+	stored, err := dbClient.GetTrades(ctx, bson.M{"contract_id": bson.M{"$in": ids}}, 0)
+	if err != nil {
+		return update, err
+	}
+	// Trades are timestamped at settlement, so the account's trades in the
+	// range are those Deriv should have reported. Trades saved before they
+	// were tagged with a login id are counted for every account.
+	inRange, err := dbClient.GetTrades(ctx, bson.M{
+		"timestamp": bson.M{"$gte": from, "$lte": to},
+		"login_id":  bson.M{"$in": bson.A{account.LoginID, nil}},
+	}, 0)
+	if err != nil {
+		return update, err
+	}
+
+	items := []database.ReconciliationItem{}
+	databasePnL := 0.0
+	databaseOnly := 0
+	for _, t := range inRange {
+		databasePnL += t.Profit
+		if t.ContractID != "" && !reported[t.ContractID] {
+			databaseOnly++
+			items = append(items, database.ReconciliationItem{
+				ContractID:     t.ContractID,
+				Action:         "database_only",
+				Strategy:       t.Strategy,
+				Symbol:         t.Symbol,
+				ContractType:   t.ContractType,
+				DatabaseProfit: t.Profit,
+			})
+		}
+	}
+	update["database_pnl"] = databasePnL
+	update["database_only"] = databaseOnly
+
+	matched, missing, mismatched := strategy.MatchTrades(contracts, stored)
+	matchedCount, mismatchedCount := len(matched), len(mismatched)
+
+	for _, m := range mismatched {
+		if err := dbClient.UpdateTrade(ctx, m.Trade.ID, bson.M{
+			"reconciliation": database.ReconcileMismatch,
+			"deriv_profit":   m.Contract.Profit,
+		}); err != nil {
+			update["items"] = items
+			return update, err
+		}
+		items = append(items, mismatchItem(m.Trade, m.Contract))
+	}
+
+	// Trades saved before bots recorded contract ids are matched on what
+	// they do record, which needs each contract's symbol; only contracts
+	// that match no such trade are inserted
+	for i := range missing {
+		if err := strategy.ContractDetails(api, &missing[i]); err != nil {
+			log.Printf("Reconciliation: no details for contract %s: %v", missing[i].ContractID, err)
+		}
+	}
+	untagged, err := dbClient.GetTrades(ctx, bson.M{
+		"contract_id": bson.M{"$in": bson.A{nil, ""}},
+		"timestamp":   bson.M{"$gte": from.Add(-strategy.UntaggedMatchWindow), "$lte": to.Add(strategy.UntaggedMatchWindow)},
+		"login_id":    bson.M{"$in": bson.A{account.LoginID, nil}},
+	}, 0)
+	if err != nil {
+		update["items"] = items
+		return update, err
+	}
+	pairs, missing := strategy.MatchUntagged(missing, untagged)
+	tagged := 0
+	for _, p := range pairs {
+		set := bson.M{"contract_id": p.Contract.ContractID}
+		if p.Mismatch {
+			set["reconciliation"] = database.ReconcileMismatch
+			set["deriv_profit"] = p.Contract.Profit
+		}
+		if err := dbClient.UpdateTrade(ctx, p.Trade.ID, set); err != nil {
+			update["tagged"] = tagged
+			update["items"] = items
+			return update, err
+		}
+		tagged++
+		if p.Mismatch {
+			mismatchedCount++
+			items = append(items, mismatchItem(p.Trade, p.Contract))
+		} else {
+			matchedCount++
+		}
+	}
+	update["tagged"] = tagged
+	update["matched"] = matchedCount
+	update["mismatched"] = mismatchedCount
+
+	inserted := 0
+	for _, c := range missing {
+		trade := strategy.ReconciledTrade(c)
+		trade.LoginID = account.LoginID
+		if err := dbClient.InsertTrade(ctx, &trade); err != nil {
+			update["inserted"] = inserted
+			update["items"] = items
+			return update, err
+		}
+		inserted++
+		items = append(items, database.ReconciliationItem{
+			ContractID:   c.ContractID,
+			Action:       database.ReconcileInserted,
+			Symbol:       c.Symbol,
+			ContractType: c.ContractType,
+			DerivProfit:  c.Profit,
+		})
+	}
+	update["inserted"] = inserted
+	update["items"] = items
+	return update, nil
+}
+
+// mismatchItem reports a stored trade whose profit differs from Deriv's.
+func mismatchItem(t database.Trade, c strategy.SettledContract) database.ReconciliationItem {
+	return database.ReconciliationItem{
+		ContractID:     c.ContractID,
+		Action:         database.ReconcileMismatch,
+		Strategy:       t.Strategy,
+		Symbol:         t.Symbol,
+		ContractType:   t.ContractType,
+		DerivProfit:    c.Profit,
+		DatabaseProfit: t.Profit,
+	}
+}
+
+// handleReconcileReports lists recent reconciliations without their items.
+func handleReconcileReports(w http.ResponseWriter, r *http.Request) {
+	if dbClient == nil {
+		http.Error(w, "Database not connected", http.StatusServiceUnavailable)
+		return
+	}
+
+	limit := int64(50)
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if n, err := strconv.ParseInt(l, 10, 64); err == nil {
+			limit = n
+		}
+	}
+
+	reports, err := dbClient.GetReconciliations(r.Context(), limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if reports == nil {
+		reports = []database.ReconciliationReport{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
+
+// handleReconcileReport returns one reconciliation with the contracts it
+// inserted or flagged.
+func handleReconcileReport(w http.ResponseWriter, r *http.Request) {
+	if dbClient == nil {
+		http.Error(w, "Database not connected", http.StatusServiceUnavailable)
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+
+	report, err := dbClient.GetReconciliation(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if report == nil {
+		http.Error(w, "Reconciliation not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// API tokens and the OpenAI key are kept out of config.json, in SecretsFile
+// sealed with AES-256-GCM. The key is derived from the passphrase in
+// DERIV_TRADER_PASSPHRASE with scrypt, or else from a keyfile
+// (DERIV_TRADER_KEYFILE, by default deriv-trader/secrets.key in the user's
+// config directory, created on first start). The default keeps the key out
+// of the directory holding SecretsFile, so a copy of one is not enough.
+const (
+	passphraseEnv = "DERIV_TRADER_PASSPHRASE"
+	keyfileEnv    = "DERIV_TRADER_KEYFILE"
+	// legacyKeyfile is where earlier versions created the keyfile, next to
+	// SecretsFile; it is still read when present
+	legacyKeyfile = "secrets.key"
+
+	kdfScrypt  = "scrypt"
+	kdfKeyfile = "keyfile"
+
+	// secretMask starts the masked form of a secret in API responses;
+	// sending it back leaves the secret unchanged.
+	secretMask = "****"
+)
+
+var (
+	SecretsFile = "secrets.json"
+
+	// secrets seals SecretsFile; nil when the key is not available, in
+	// which case settings cannot be saved.
+	secrets *secretStore
+)
+
+// sealedSecrets is the content of SecretsFile.
+type sealedSecrets struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"` // kdfScrypt or kdfKeyfile
+	Salt    []byte `json:"salt,omitempty"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"` // JSON object of secret name -> value
+}
+
+type secretStore struct {
+	kdf  string
+	salt []byte
+	aead cipher.AEAD
+}
+
+// openSecretStore derives the key for SecretsFile. An existing file keeps
+// the kind of key it was sealed with; a new one uses the passphrase when
+// it is set and the keyfile otherwise.
+func openSecretStore() (*secretStore, error) {
+	existing, err := readSealedSecrets()
+	if err != nil {
+		return nil, err
+	}
+	passphrase := os.Getenv(passphraseEnv)
+
+	kdf := kdfKeyfile
+	if passphrase != "" {
+		kdf = kdfScrypt
+	}
+	var salt []byte
+	if existing != nil {
+		kdf, salt = existing.KDF, existing.Salt
+	}
+
+	var key []byte
+	switch kdf {
+	case kdfScrypt:
+		if passphrase == "" {
+			return nil, fmt.Errorf("%s is sealed with a passphrase; set %s", SecretsFile, passphraseEnv)
+		}
+		if salt == nil {
+			salt = make([]byte, 16)
+			if _, err := rand.Read(salt); err != nil {
+				return nil, err
+			}
+		}
+		key, err = scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	case kdfKeyfile:
+		// A keyfile is only created for a new store; without the original
+		// one the existing secrets cannot be opened
+		key, err = readKeyfile(existing == nil)
+	default:
+		return nil, fmt.Errorf("%s uses unknown key derivation %q", SecretsFile, kdf)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &secretStore{kdf: kdf, salt: salt, aead: aead}, nil
+}
+
+func readSealedSecrets() (*sealedSecrets, error) {
+	data, err := os.ReadFile(SecretsFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sealed sealedSecrets
+	if err := json.Unmarshal(data, &sealed); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", SecretsFile, err)
+	}
+	return &sealed, nil
+}
+
+// keyfilePath returns the keyfile set in DERIV_TRADER_KEYFILE, the legacy
+// keyfile when one exists, or the default one in the user's config
+// directory.
+func keyfilePath() (string, error) {
+	if path := os.Getenv(keyfileEnv); path != "" {
+		return path, nil
+	}
+	if _, err := os.Stat(legacyKeyfile); err == nil {
+		log.Printf("Warning: Keyfile %s sits next to %s; move it and set %s, or use %s", legacyKeyfile, SecretsFile, keyfileEnv, passphraseEnv)
+		return legacyKeyfile, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("no default keyfile location (%v); set %s or %s", err, keyfileEnv, passphraseEnv)
+	}
+	return filepath.Join(dir, "deriv-trader", "secrets.key"), nil
+}
+
+// readKeyfile returns the key derived from the keyfile, creating a random
+// keyfile when create is set and none exists.
+func readKeyfile(create bool) ([]byte, error) {
+	path, err := keyfilePath()
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && create {
+		content = make([]byte, 32)
+		if _, err := rand.Read(content); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, fmt.Errorf("failed to create keyfile: %w", err)
+		}
+		if err := os.WriteFile(path, content, 0600); err != nil {
+			return nil, fmt.Errorf("failed to create keyfile: %w", err)
+		}
+		log.Printf("Created keyfile %s for %s", path, SecretsFile)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read keyfile: %w", err)
+	}
+	if len(content) == 0 {
+		return nil, fmt.Errorf("keyfile %s is empty", path)
+	}
+
+	key := sha256.Sum256(content)
+	return key[:], nil
+}
+
+// load returns the stored secrets, or none when SecretsFile does not exist.
+func (s *secretStore) load() (map[string]string, error) {
+	values := map[string]string{}
+	sealed, err := readSealedSecrets()
+	if err != nil || sealed == nil {
+		return values, err
+	}
+
+	data, err := s.aead.Open(nil, sealed.Nonce, sealed.Data, []byte(sealed.KDF))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: wrong passphrase or keyfile", SecretsFile)
+	}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("invalid %s content: %w", SecretsFile, err)
+	}
+	return values, nil
+}
+
+// save seals values into SecretsFile, replacing it atomically.
+func (s *secretStore) save(values map[string]string) error {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	sealed := sealedSecrets{
+		Version: 1,
+		KDF:     s.kdf,
+		Salt:    s.salt,
+		Nonce:   nonce,
+		Data:    s.aead.Seal(nil, nonce, data, []byte(s.kdf)),
+	}
+	out, err := json.MarshalIndent(sealed, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := SecretsFile + ".tmp"
+	if err := os.WriteFile(tmp, out, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, SecretsFile)
+}
+
+// loadSecrets fills the secrets of sysConfig from SecretsFile and moves any
+// plaintext secrets config.json still holds into it.
+func loadSecrets() {
+	store, err := openSecretStore()
+	if err == nil {
+		var values map[string]string
+		if values, err = store.load(); err == nil {
+			secrets = store
+			plaintext := configSecrets(sysConfig)
+			// Plaintext values are newer than the stored ones: they were
+			// written by an earlier version or edited in by hand
+			for name, value := range plaintext {
+				values[name] = value
+			}
+			applySecrets(&sysConfig, values)
+			if len(plaintext) > 0 {
+				if err := saveSystemConfig(); err != nil {
+					log.Printf("Warning: Failed to move plaintext secrets out of %s: %v", ConfigFile, err)
+				} else {
+					log.Printf("Moved %d plaintext secrets from %s to %s", len(plaintext), ConfigFile, SecretsFile)
+				}
+			}
+			return
+		}
+	}
+	log.Printf("Warning: Secrets unavailable: %v. Stored API tokens and keys are not loaded and settings cannot be saved.", err)
+}
+
+// configSecrets returns the non-empty secrets of c by name.
+func configSecrets(c SystemConfig) map[string]string {
+	values := map[string]string{}
+	if c.DerivAPIToken != "" {
+		values["deriv_api_token"] = c.DerivAPIToken
+	}
+	if c.OpenAIKey != "" {
+		values["openai_key"] = c.OpenAIKey
+	}
+	for _, a := range c.Accounts {
+		if a.Token != "" {
+			values["account:"+a.Name] = a.Token
+		}
+	}
+	return values
+}
+
+// applySecrets sets the secrets of c from values; secrets missing from
+// values are left as they are.
+func applySecrets(c *SystemConfig, values map[string]string) {
+	if v, ok := values["deriv_api_token"]; ok {
+		c.DerivAPIToken = v
+	}
+	if v, ok := values["openai_key"]; ok {
+		c.OpenAIKey = v
+	}
+	for i, a := range c.Accounts {
+		if v, ok := values["account:"+a.Name]; ok {
+			c.Accounts[i].Token = v
+		}
+	}
+}
+
+// withoutSecrets returns a copy of c with every secret blanked, as written
+// to config.json.
+func withoutSecrets(c SystemConfig) SystemConfig {
+	c.DerivAPIToken = ""
+	c.OpenAIKey = ""
+	c.Accounts = append([]Account(nil), c.Accounts...)
+	for i := range c.Accounts {
+		c.Accounts[i].Token = ""
+	}
+	return c
+}
+
+// maskedConfig returns a copy of c with every secret masked, as returned by
+// GET /api/settings.
+func maskedConfig(c SystemConfig) SystemConfig {
+	c.DerivAPIToken = maskSecret(c.DerivAPIToken)
+	c.OpenAIKey = maskSecret(c.OpenAIKey)
+	c.Accounts = append([]Account(nil), c.Accounts...)
+	for i := range c.Accounts {
+		c.Accounts[i].Token = maskSecret(c.Accounts[i].Token)
+	}
+	return c
+}
+
+// maskSecret hides all of a secret but its last four characters.
+func maskSecret(v string) string {
+	if len(v) <= 8 {
+		if v == "" {
+			return ""
+		}
+		return secretMask
+	}
+	return secretMask + v[len(v)-4:]
+}
+
+func isMasked(v string) bool {
+	return strings.HasPrefix(v, secretMask)
+}
+
+// keepSecrets makes secrets write-only in a settings update: a secret that
+// is absent from the request or sent back masked keeps its current value.
+// An empty value clears a secret. fields holds the top-level keys present
+// in the request.
+//
+// Account tokens are matched by account ID, so a renamed account keeps its
+// token, then by name for requests without a known ID, and last by the
+// masked token when it identifies a single current account.
+func keepSecrets(current SystemConfig, next *SystemConfig, fields map[string]json.RawMessage) {
+	if _, ok := fields["deriv_api_token"]; !ok || isMasked(next.DerivAPIToken) {
+		next.DerivAPIToken = current.DerivAPIToken
+	}
+	if _, ok := fields["openai_key"]; !ok || isMasked(next.OpenAIKey) {
+		next.OpenAIKey = current.OpenAIKey
+	}
+
+	byID := map[string]Account{}
+	byName := map[string]Account{}
+	byMask := map[string][]Account{}
+	for _, a := range current.Accounts {
+		if a.ID != "" {
+			byID[a.ID] = a
+		}
+		byName[a.Name] = a
+		if a.Token != "" {
+			byMask[maskSecret(a.Token)] = append(byMask[maskSecret(a.Token)], a)
+		}
+	}
+	requested := map[string]bool{}
+	for _, a := range next.Accounts {
+		requested[a.ID] = true
+	}
+	for i, a := range next.Accounts {
+		if a.Token != "" && !isMasked(a.Token) {
+			continue
+		}
+		prev, ok := byID[a.ID]
+		if !ok {
+			prev, ok = byName[a.Name]
+		}
+		if !ok && len(byMask[a.Token]) == 1 {
+			prev, ok = byMask[a.Token][0], true
+		}
+		next.Accounts[i].Token = prev.Token
+		// Take over the matched account's ID unless another row keeps it
+		if ok && a.ID != prev.ID && !requested[prev.ID] {
+			next.Accounts[i].ID = prev.ID
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestKeepSecretsAccounts(t *testing.T) {
+	const (
+		demoToken = "demo-token-aaaa"
+		realToken = "real-token-bbbb"
+		// Two tokens with the same masked form
+		sameA = "first-token-1234"
+		sameB = "second-token-1234"
+	)
+	demo := Account{ID: "a1", Name: "demo", Token: demoToken}
+	live := Account{ID: "b2", Name: "real", Token: realToken}
+
+	tests := []struct {
+		name    string
+		current []Account
+		next    []Account
+		want    []Account
+	}{
+		{
+			name:    "unchanged",
+			current: []Account{demo, live},
+			next:    []Account{{ID: "a1", Name: "demo", Token: maskSecret(demoToken)}, {ID: "b2", Name: "real", Token: maskSecret(realToken)}},
+			want:    []Account{demo, live},
+		},
+		{
+			name:    "rename",
+			current: []Account{demo},
+			next:    []Account{{ID: "a1", Name: "practice", Token: maskSecret(demoToken)}},
+			want:    []Account{{ID: "a1", Name: "practice", Token: demoToken}},
+		},
+		{
+			name:    "swap names",
+			current: []Account{demo, live},
+			next:    []Account{{ID: "a1", Name: "real", Token: maskSecret(demoToken)}, {ID: "b2", Name: "demo", Token: maskSecret(realToken)}},
+			want:    []Account{{ID: "a1", Name: "real", Token: demoToken}, {ID: "b2", Name: "demo", Token: realToken}},
+		},
+		{
+			name:    "swap rows",
+			current: []Account{demo, live},
+			next:    []Account{{ID: "b2", Name: "real", Token: maskSecret(realToken)}, {ID: "a1", Name: "demo", Token: maskSecret(demoToken)}},
+			want:    []Account{live, demo},
+		},
+		{
+			name:    "delete and add with the same name",
+			current: []Account{demo},
+			next:    []Account{{Name: "demo", Token: "new-token-cccc"}},
+			want:    []Account{{Name: "demo", Token: "new-token-cccc"}},
+		},
+		{
+			name:    "delete one and rename the other",
+			current: []Account{demo, live},
+			next:    []Account{{ID: "b2", Name: "demo", Token: maskSecret(realToken)}},
+			want:    []Account{{ID: "b2", Name: "demo", Token: realToken}},
+		},
+		{
+			name:    "request without ids matches by name",
+			current: []Account{demo, live},
+			next:    []Account{{Name: "real", Token: maskSecret(realToken)}},
+			want:    []Account{live},
+		},
+		{
+			name:    "unknown id falls back to the name",
+			current: []Account{demo},
+			next:    []Account{{ID: "stale", Name: "demo", Token: maskSecret(demoToken)}},
+			want:    []Account{demo},
+		},
+		{
+			name:    "renamed without id matches a unique mask",
+			current: []Account{demo, live},
+			next:    []Account{{Name: "practice", Token: maskSecret(demoToken)}},
+			want:    []Account{{ID: "a1", Name: "practice", Token: demoToken}},
+		},
+		{
+			name:    "shared mask is not guessed",
+			current: []Account{{ID: "a1", Name: "one", Token: sameA}, {ID: "b2", Name: "two", Token: sameB}},
+			next:    []Account{{Name: "renamed", Token: maskSecret(sameA)}},
+			want:    []Account{{Name: "renamed", Token: ""}},
+		},
+		{
+			name:    "shared mask matched by id",
+			current: []Account{{ID: "a1", Name: "one", Token: sameA}, {ID: "b2", Name: "two", Token: sameB}},
+			next:    []Account{{ID: "b2", Name: "renamed", Token: maskSecret(sameA)}, {ID: "a1", Name: "one", Token: maskSecret(sameB)}},
+			want:    []Account{{ID: "b2", Name: "renamed", Token: sameB}, {ID: "a1", Name: "one", Token: sameA}},
+		},
+		{
+			name:    "copied row does not take over the id",
+			current: []Account{demo},
+			next:    []Account{{ID: "a1", Name: "demo", Token: maskSecret(demoToken)}, {Name: "copy", Token: maskSecret(demoToken)}},
+			want:    []Account{demo, {Name: "copy", Token: demoToken}},
+		},
+		{
+			name:    "new token replaces the stored one",
+			current: []Account{demo},
+			next:    []Account{{ID: "a1", Name: "demo", Token: "new-token-dddd"}},
+			want:    []Account{{ID: "a1", Name: "demo", Token: "new-token-dddd"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := SystemConfig{Accounts: tt.next}
+			keepSecrets(SystemConfig{Accounts: tt.current}, &next, map[string]json.RawMessage{"accounts": nil})
+			if !reflect.DeepEqual(next.Accounts, tt.want) {
+				t.Errorf("accounts = %+v, want %+v", next.Accounts, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeepSecretsTopLevel(t *testing.T) {
+	current := SystemConfig{DerivAPIToken: "deriv-token-1234", OpenAIKey: "openai-key-5678"}
+	tests := []struct {
+		name      string
+		body      string
+		wantDeriv string
+		wantAI    string
+	}{
+		{"absent keeps", `{}`, current.DerivAPIToken, current.OpenAIKey},
+		{"masked keeps", `{"deriv_api_token": "****1234", "openai_key": "****5678"}`, current.DerivAPIToken, current.OpenAIKey},
+		{"empty clears", `{"deriv_api_token": "", "openai_key": ""}`, "", ""},
+		{"new value replaces", `{"deriv_api_token": "other-token"}`, "other-token", current.OpenAIKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var next SystemConfig
+			var fields map[string]json.RawMessage
+			json.Unmarshal([]byte(tt.body), &next)
+			json.Unmarshal([]byte(tt.body), &fields)
+			keepSecrets(current, &next, fields)
+			if next.DerivAPIToken != tt.wantDeriv || next.OpenAIKey != tt.wantAI {
+				t.Errorf("tokens = %q, %q; want %q, %q", next.DerivAPIToken, next.OpenAIKey, tt.wantDeriv, tt.wantAI)
+			}
+		})
+	}
+}
@@ -0,0 +1,536 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"deriv_trade/database"
+	"deriv_trade/strategy"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Strategy storage backends selectable through SystemConfig.StrategyStore
+const (
+	StoreFilesystem = "filesystem"
+	StoreMongoDB    = "mongodb"
+)
+
+var (
+	errStrategyNotFound = errors.New("strategy not found")
+	errVersionNotFound  = errors.New("version not found")
+)
+
+// StrategyQuery filters List results. Empty fields match everything.
+type StrategyQuery struct {
+	Name string // case-insensitive substring of the strategy name
+	Tag  string // exact tag
+}
+
+func (q StrategyQuery) matches(s database.Strategy) bool {
+	if q.Name != "" && !strings.Contains(strings.ToLower(s.Name), strings.ToLower(q.Name)) {
+		return false
+	}
+	if q.Tag == "" {
+		return true
+	}
+	for _, t := range s.Tags {
+		if t == q.Tag {
+			return true
+		}
+	}
+	return false
+}
+
+// StrategyStore persists strategy scripts, their metadata and version history.
+type StrategyStore interface {
+	// List returns matching strategies sorted by name, without content.
+	List(ctx context.Context, query StrategyQuery) ([]database.Strategy, error)
+	// Get returns a strategy with its content, or errStrategyNotFound.
+	Get(ctx context.Context, name string) (*database.Strategy, error)
+	// Save creates or replaces a strategy, setting its timestamps.
+	Save(ctx context.Context, s *database.Strategy) error
+	// Delete removes a strategy but keeps its version history.
+	Delete(ctx context.Context, name string) error
+
+	// Versions returns a strategy's history, newest first, without content.
+	Versions(ctx context.Context, name string) ([]database.StrategyVersion, error)
+	// Version returns one revision with its content, or errVersionNotFound.
+	Version(ctx context.Context, name string, version int) (*database.StrategyVersion, error)
+	// AddVersion records content unless it matches the latest version, and
+	// returns the version that now describes it.
+	AddVersion(ctx context.Context, name, content, note string) (database.StrategyVersion, error)
+}
+
+var (
+	strategyStore   StrategyStore
+	strategyStoreMu sync.RWMutex
+)
+
+func getStrategyStore() StrategyStore {
+	strategyStoreMu.RLock()
+	defer strategyStoreMu.RUnlock()
+	return strategyStore
+}
+
+// initStrategyStore selects the backend named in the system config. MongoDB
+// falls back to the filesystem when the database is unavailable, and an
+// empty MongoDB store is seeded from the strategies directory.
+func initStrategyStore() {
+	sysConfigMu.RLock()
+	backend := sysConfig.StrategyStore
+	sysConfigMu.RUnlock()
+
+	fsStore := newFSStrategyStore(StrategiesDir)
+	var store StrategyStore = fsStore
+
+	if backend == StoreMongoDB {
+		if dbClient == nil {
+			log.Printf("Warning: strategy store %q needs MongoDB; using the strategies directory", backend)
+		} else {
+			mongoStore := &mongoStrategyStore{db: dbClient}
+			if err := migrateStrategies(context.Background(), fsStore, mongoStore); err != nil {
+				log.Printf("Warning: Failed to migrate strategies to MongoDB: %v", err)
+			}
+			store = mongoStore
+		}
+	}
+
+	strategyStoreMu.Lock()
+	strategyStore = store
+	strategyStoreMu.Unlock()
+}
+
+// migrateStrategies copies every strategy and its history into an empty store.
+func migrateStrategies(ctx context.Context, from, to StrategyStore) error {
+	existing, err := to.List(ctx, StrategyQuery{})
+	if err != nil || len(existing) > 0 {
+		return err
+	}
+
+	list, err := from.List(ctx, StrategyQuery{})
+	if err != nil {
+		return err
+	}
+	for _, item := range list {
+		s, err := from.Get(ctx, item.Name)
+		if err != nil {
+			return err
+		}
+		versions, err := from.Versions(ctx, s.Name)
+		if err != nil {
+			return err
+		}
+		for i := len(versions) - 1; i >= 0; i-- {
+			v, err := from.Version(ctx, s.Name, versions[i].Version)
+			if err != nil {
+				return err
+			}
+			if _, err := to.AddVersion(ctx, s.Name, v.Content, v.Note); err != nil {
+				return err
+			}
+		}
+		if err := to.Save(ctx, s); err != nil {
+			return err
+		}
+	}
+	if len(list) > 0 {
+		log.Printf("Migrated %d strategies to MongoDB", len(list))
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory and
+// renames it into place, so readers never see a partially written file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// The filesystem store keeps versions content-addressed: each distinct script
+// body is stored once under VersionsDir/<hash>, and VersionsFile lists every
+// strategy's history.
+const VersionsDir = ".versions"
+const VersionsFile = "versions.json"
+
+// fsStrategyStore keeps scripts as files in dir, metadata in MetaFile and
+// versions under VersionsDir.
+type fsStrategyStore struct {
+	dir string
+	mu  sync.Mutex // serializes every read-modify-write of the index files
+}
+
+func newFSStrategyStore(dir string) *fsStrategyStore {
+	return &fsStrategyStore{dir: dir}
+}
+
+// StrategyMeta is the meta.json entry for one strategy file.
+type StrategyMeta struct {
+	Description string                 `json:"description,omitempty"`
+	Tags        []string               `json:"tags"`
+	Params      map[string]interface{} `json:"params,omitempty"`
+	CreatedAt   time.Time              `json:"created_at,omitempty"`
+	UpdatedAt   time.Time              `json:"updated_at,omitempty"`
+
+	RecommendedConfig map[string]interface{}    `json:"recommended_config,omitempty"`
+	Backtest          *database.BacktestSummary `json:"backtest,omitempty"`
+}
+
+func (f *fsStrategyStore) ensureDir() error {
+	return os.MkdirAll(f.dir, 0755)
+}
+
+func (f *fsStrategyStore) loadMeta() map[string]StrategyMeta {
+	store := make(map[string]StrategyMeta)
+	data, err := os.ReadFile(filepath.Join(f.dir, MetaFile))
+	if err == nil {
+		json.Unmarshal(data, &store)
+	}
+	return store
+}
+
+func (f *fsStrategyStore) saveMeta(store map[string]StrategyMeta) error {
+	data, err := json.MarshalIndent(store, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(f.dir, MetaFile), data, 0644)
+}
+
+// record combines a file's metadata with its modification time for files
+// saved before timestamps were recorded.
+func (f *fsStrategyStore) record(name string, meta StrategyMeta, info os.FileInfo) database.Strategy {
+	s := database.Strategy{
+		Name:        name,
+		Description: meta.Description,
+		Tags:        meta.Tags,
+		Params:      meta.Params,
+		CreatedAt:   meta.CreatedAt,
+		UpdatedAt:   meta.UpdatedAt,
+
+		RecommendedConfig: meta.RecommendedConfig,
+		Backtest:          meta.Backtest,
+	}
+	if s.Tags == nil {
+		s.Tags = []string{}
+	}
+	if info != nil {
+		if s.UpdatedAt.IsZero() {
+			s.UpdatedAt = info.ModTime()
+		}
+		if s.CreatedAt.IsZero() {
+			s.CreatedAt = info.ModTime()
+		}
+	}
+	return s
+}
+
+func (f *fsStrategyStore) List(ctx context.Context, query StrategyQuery) ([]database.Strategy, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.ensureDir(); err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(f.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := f.loadMeta()
+	strategies := []database.Strategy{}
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !(strings.HasSuffix(name, ".js") || strings.HasSuffix(name, ".xml")) {
+			continue
+		}
+		info, _ := file.Info()
+		s := f.record(name, meta[name], info)
+		if query.matches(s) {
+			strategies = append(strategies, s)
+		}
+	}
+	return strategies, nil
+}
+
+func (f *fsStrategyStore) Get(ctx context.Context, name string) (*database.Strategy, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := filepath.Join(f.dir, name)
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, errStrategyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, _ := os.Stat(path)
+
+	s := f.record(name, f.loadMeta()[name], info)
+	s.Content = string(content)
+	return &s, nil
+}
+
+func (f *fsStrategyStore) Save(ctx context.Context, s *database.Strategy) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.ensureDir(); err != nil {
+		return err
+	}
+	path := filepath.Join(f.dir, s.Name)
+
+	meta := f.loadMeta()
+	now := time.Now()
+	created := meta[s.Name].CreatedAt
+	if created.IsZero() {
+		created = now
+		if !s.CreatedAt.IsZero() {
+			created = s.CreatedAt // keep the original time when migrating
+		} else if info, err := os.Stat(path); err == nil {
+			created = info.ModTime() // file saved before timestamps were recorded
+		}
+	}
+
+	if err := writeFileAtomic(path, []byte(s.Content), 0644); err != nil {
+		return err
+	}
+	if s.Tags == nil {
+		s.Tags = []string{}
+	}
+	meta[s.Name] = StrategyMeta{
+		Description: s.Description,
+		Tags:        s.Tags,
+		Params:      s.Params,
+		CreatedAt:   created,
+		UpdatedAt:   now,
+
+		RecommendedConfig: s.RecommendedConfig,
+		Backtest:          s.Backtest,
+	}
+	s.CreatedAt, s.UpdatedAt = created, now
+	return f.saveMeta(meta)
+}
+
+func (f *fsStrategyStore) Delete(ctx context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := os.Remove(filepath.Join(f.dir, name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	meta := f.loadMeta()
+	delete(meta, name)
+	return f.saveMeta(meta)
+}
+
+func (f *fsStrategyStore) loadVersions() map[string][]database.StrategyVersion {
+	store := make(map[string][]database.StrategyVersion)
+	data, err := os.ReadFile(filepath.Join(f.dir, VersionsFile))
+	if err == nil {
+		json.Unmarshal(data, &store)
+	}
+	return store
+}
+
+func (f *fsStrategyStore) versionPath(hash string) string {
+	return filepath.Join(f.dir, VersionsDir, hash)
+}
+
+func (f *fsStrategyStore) Versions(ctx context.Context, name string) ([]database.StrategyVersion, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	history := f.loadVersions()[name]
+	list := make([]database.StrategyVersion, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		list = append(list, history[i])
+	}
+	return list, nil
+}
+
+func (f *fsStrategyStore) Version(ctx context.Context, name string, version int) (*database.StrategyVersion, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, v := range f.loadVersions()[name] {
+		if v.Version == version {
+			content, err := os.ReadFile(f.versionPath(v.Hash))
+			if err != nil {
+				return nil, fmt.Errorf("content for version %d is missing", version)
+			}
+			v.Content = string(content)
+			return &v, nil
+		}
+	}
+	return nil, errVersionNotFound
+}
+
+func (f *fsStrategyStore) AddVersion(ctx context.Context, name, content, note string) (database.StrategyVersion, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	hash := strategy.ScriptHash(content)
+	store := f.loadVersions()
+	history := store[name]
+	if n := len(history); n > 0 && history[n-1].Hash == hash {
+		return history[n-1], nil
+	}
+
+	if err := os.MkdirAll(filepath.Join(f.dir, VersionsDir), 0755); err != nil {
+		return database.StrategyVersion{}, err
+	}
+	if _, err := os.Stat(f.versionPath(hash)); os.IsNotExist(err) {
+		if err := writeFileAtomic(f.versionPath(hash), []byte(content), 0644); err != nil {
+			return database.StrategyVersion{}, err
+		}
+	}
+
+	v := database.StrategyVersion{
+		Version:   len(history) + 1,
+		Hash:      hash,
+		Timestamp: time.Now(),
+		Note:      note,
+		Size:      len(content),
+	}
+	store[name] = append(history, v)
+
+	data, err := json.MarshalIndent(store, "", "  ")
+	if err != nil {
+		return database.StrategyVersion{}, err
+	}
+	if err := writeFileAtomic(filepath.Join(f.dir, VersionsFile), data, 0644); err != nil {
+		return database.StrategyVersion{}, err
+	}
+	return v, nil
+}
+
+// mongoStrategyStore keeps strategies and versions in MongoDB collections.
+type mongoStrategyStore struct {
+	db *database.Client
+	mu sync.Mutex // serializes version numbering
+}
+
+func (m *mongoStrategyStore) List(ctx context.Context, query StrategyQuery) ([]database.Strategy, error) {
+	filter := bson.M{}
+	if query.Name != "" {
+		filter["_id"] = bson.M{"$regex": regexp.QuoteMeta(query.Name), "$options": "i"}
+	}
+	if query.Tag != "" {
+		filter["tags"] = query.Tag
+	}
+
+	strategies, err := m.db.ListStrategies(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if strategies == nil {
+		strategies = []database.Strategy{}
+	}
+	return strategies, nil
+}
+
+func (m *mongoStrategyStore) Get(ctx context.Context, name string) (*database.Strategy, error) {
+	s, err := m.db.GetStrategy(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return nil, errStrategyNotFound
+	}
+	return s, nil
+}
+
+func (m *mongoStrategyStore) Save(ctx context.Context, s *database.Strategy) error {
+	if s.Tags == nil {
+		s.Tags = []string{}
+	}
+	return m.db.SaveStrategy(ctx, s)
+}
+
+func (m *mongoStrategyStore) Delete(ctx context.Context, name string) error {
+	return m.db.DeleteStrategy(ctx, name)
+}
+
+func (m *mongoStrategyStore) Versions(ctx context.Context, name string) ([]database.StrategyVersion, error) {
+	versions, err := m.db.GetStrategyVersions(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if versions == nil {
+		versions = []database.StrategyVersion{}
+	}
+	return versions, nil
+}
+
+func (m *mongoStrategyStore) Version(ctx context.Context, name string, version int) (*database.StrategyVersion, error) {
+	v, err := m.db.GetStrategyVersion(ctx, name, version)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, errVersionNotFound
+	}
+	return v, nil
+}
+
+func (m *mongoStrategyStore) AddVersion(ctx context.Context, name, content, note string) (database.StrategyVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	versions, err := m.db.GetStrategyVersions(ctx, name)
+	if err != nil {
+		return database.StrategyVersion{}, err
+	}
+	hash := strategy.ScriptHash(content)
+	next := 1
+	if len(versions) > 0 {
+		if versions[0].Hash == hash {
+			return versions[0], nil
+		}
+		next = versions[0].Version + 1
+	}
+
+	v := database.StrategyVersion{
+		Name:    name,
+		Version: next,
+		Hash:    hash,
+		Note:    note,
+		Size:    len(content),
+		Content: content,
+	}
+	if err := m.db.InsertStrategyVersion(ctx, &v); err != nil {
+		return database.StrategyVersion{}, err
+	}
+	v.Content = ""
+	return v, nil
+}
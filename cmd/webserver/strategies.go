@@ -2,78 +2,37 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strings"
+
+	"deriv_trade/database"
+	"deriv_trade/strategy"
 )
 
 const StrategiesDir = "strategies"
 const MetaFile = "meta.json"
 
-type StrategyFile struct {
-	Name string   `json:"name"`
-	Path string   `json:"path"`
-	Tags []string `json:"tags"`
-}
-
-type StrategyMeta struct {
-	Tags []string `json:"tags"`
-}
-
-type MetaStore map[string]StrategyMeta
-
-func loadMeta() MetaStore {
-	store := make(MetaStore)
-	data, err := os.ReadFile(filepath.Join(StrategiesDir, MetaFile))
-	if err == nil {
-		json.Unmarshal(data, &store)
-	}
-	return store
-}
-
-func saveMeta(store MetaStore) error {
-	data, err := json.MarshalIndent(store, "", "  ")
-	if err != nil {
-		return err
-	}
-	return os.WriteFile(filepath.Join(StrategiesDir, MetaFile), data, 0644)
-}
-
-func ensureStrategiesDir() {
-	if _, err := os.Stat(StrategiesDir); os.IsNotExist(err) {
-		os.Mkdir(StrategiesDir, 0755)
-	}
+// validStrategyName rejects empty names and anything that could escape the strategies directory.
+func validStrategyName(name string) bool {
+	return name != "" && !strings.Contains(name, "..") && !strings.Contains(name, "/") && !strings.Contains(name, "\\")
 }
 
+// handleStrategiesList lists saved strategies, optionally filtered by ?tag= and
+// a case-insensitive name search ?q=.
 func handleStrategiesList(w http.ResponseWriter, r *http.Request) {
-	ensureStrategiesDir()
+	query := StrategyQuery{
+		Name: r.URL.Query().Get("q"),
+		Tag:  r.URL.Query().Get("tag"),
+	}
 
-	files, err := os.ReadDir(StrategiesDir)
+	strategies, err := getStrategyStore().List(r.Context(), query)
 	if err != nil {
-		http.Error(w, "Failed to read strategies directory", http.StatusInternalServerError)
+		http.Error(w, "Failed to list strategies", http.StatusInternalServerError)
 		return
 	}
 
-	meta := loadMeta()
-	var strategies []StrategyFile
-
-	for _, file := range files {
-		if !file.IsDir() && (strings.HasSuffix(file.Name(), ".js") || strings.HasSuffix(file.Name(), ".xml")) {
-			name := file.Name()
-			tags := []string{}
-			if m, ok := meta[name]; ok {
-				tags = m.Tags
-			}
-
-			strategies = append(strategies, StrategyFile{
-				Name: name,
-				Path: filepath.Join(StrategiesDir, name),
-				Tags: tags,
-			})
-		}
-	}
-
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(strategies)
 }
@@ -85,14 +44,14 @@ func handleStrategyGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if strings.Contains(name, "..") || strings.Contains(name, "/") || strings.Contains(name, "\\") {
+	if !validStrategyName(name) {
 		http.Error(w, "Invalid strategy name", http.StatusBadRequest)
 		return
 	}
 
-	content, err := os.ReadFile(filepath.Join(StrategiesDir, name))
+	s, err := getStrategyStore().Get(r.Context(), name)
 	if err != nil {
-		if os.IsNotExist(err) {
+		if err == errStrategyNotFound {
 			http.Error(w, "Strategy not found", http.StatusNotFound)
 			return
 		}
@@ -106,7 +65,7 @@ func handleStrategyGet(w http.ResponseWriter, r *http.Request) {
 	} else {
 		w.Header().Set("Content-Type", "text/plain")
 	}
-	w.Write(content)
+	w.Write([]byte(s.Content))
 }
 
 func handleStrategySave(w http.ResponseWriter, r *http.Request) {
@@ -115,12 +74,13 @@ func handleStrategySave(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ensureStrategiesDir()
-
 	var req struct {
-		Name    string   `json:"name"`
-		Content string   `json:"content"`
-		Tags    []string `json:"tags"`
+		Name        string                 `json:"name"`
+		Content     string                 `json:"content"`
+		Description *string                `json:"description"` // nil keeps the saved description
+		Tags        []string               `json:"tags"`
+		Params      map[string]interface{} `json:"params"`
+		Note        string                 `json:"note"` // Author note recorded with the new version
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -140,25 +100,71 @@ func handleStrategySave(w http.ResponseWriter, r *http.Request) {
 		req.Name += ".js"
 	}
 
-	if strings.Contains(req.Name, "..") || strings.Contains(req.Name, "/") || strings.Contains(req.Name, "\\") {
+	if !validStrategyName(req.Name) {
 		http.Error(w, "Invalid strategy name", http.StatusBadRequest)
 		return
 	}
 
-	// Save Content
-	path := filepath.Join(StrategiesDir, req.Name)
-	if err := os.WriteFile(path, []byte(req.Content), 0644); err != nil {
-		http.Error(w, "Failed to save strategy", http.StatusInternalServerError)
+	// Reject strategies the bot could not run
+	if strategy.IsDBotXML(req.Content) {
+		if issues := strategy.ValidateDBotXML(req.Content); strategy.HasDBotErrors(issues) {
+			writeDBotIssues(w, http.StatusBadRequest, issues)
+			return
+		}
+	} else if check := checkStrategyContent(req.Content); !check.Valid {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(check)
 		return
 	}
 
-	// Save Metadata
-	meta := loadMeta()
-	meta[req.Name] = StrategyMeta{Tags: req.Tags}
-	saveMeta(meta)
+	store := getStrategyStore()
+	ctx := r.Context()
+	s := &database.Strategy{Name: req.Name, Content: req.Content, Tags: req.Tags, Params: req.Params}
+
+	// Keep the saved description and parameter values unless new ones are
+	// supplied, and the previous content in the version history
+	if prev, err := store.Get(ctx, req.Name); err == nil {
+		if req.Description == nil {
+			s.Description = prev.Description
+		}
+		if req.Params == nil {
+			s.Params = prev.Params
+		}
+		s.RecommendedConfig, s.Backtest = prev.RecommendedConfig, prev.Backtest
+		if _, err := store.AddVersion(ctx, req.Name, prev.Content, "snapshot of existing file"); err != nil {
+			log.Printf("Failed to snapshot strategy %s: %v", req.Name, err)
+		}
+	} else if err != errStrategyNotFound {
+		http.Error(w, "Failed to read strategy", http.StatusInternalServerError)
+		return
+	}
+	if req.Description != nil {
+		s.Description = *req.Description
+	}
+
+	// Drop parameter values the script no longer declares
+	if !strategy.IsDBotXML(req.Content) {
+		params, err := strategy.ResolveScriptParams(req.Content, s.Params)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.Params = params
+	}
+
+	if err := store.Save(ctx, s); err != nil {
+		http.Error(w, "Failed to save strategy", http.StatusInternalServerError)
+		return
+	}
+	version, err := store.AddVersion(ctx, req.Name, req.Content, req.Note)
+	if err != nil {
+		http.Error(w, "Failed to record strategy version", http.StatusInternalServerError)
+		return
+	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "saved", "name": req.Name})
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "saved", "name": req.Name, "version": version})
 }
 
 func handleStrategyDelete(w http.ResponseWriter, r *http.Request) {
@@ -173,22 +179,221 @@ func handleStrategyDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if strings.Contains(name, "..") || strings.Contains(name, "/") || strings.Contains(name, "\\") {
+	if !validStrategyName(name) {
 		http.Error(w, "Invalid strategy name", http.StatusBadRequest)
 		return
 	}
 
-	path := filepath.Join(StrategiesDir, name)
-	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
-		http.Error(w, "Failed to delete file", http.StatusInternalServerError)
-		return
+	// Deleted strategies stay restorable from their version history
+	store := getStrategyStore()
+	if prev, err := store.Get(r.Context(), name); err == nil {
+		if _, err := store.AddVersion(r.Context(), name, prev.Content, "snapshot before delete"); err != nil {
+			log.Printf("Failed to snapshot strategy %s: %v", name, err)
+		}
 	}
 
-	// Remove from metadata
-	meta := loadMeta()
-	delete(meta, name)
-	saveMeta(meta)
+	if err := store.Delete(r.Context(), name); err != nil {
+		http.Error(w, "Failed to delete strategy", http.StatusInternalServerError)
+		return
+	}
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"status": "deleted", "name": name})
 }
+
+// readStrategyRequest returns the content posted to the convert/validate
+// endpoints, either inline or by the name of a saved strategy.
+func readStrategyRequest(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return "", false
+	}
+
+	var req struct {
+		Name    string `json:"name"`
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return "", false
+	}
+
+	if req.Content == "" && req.Name != "" {
+		if !validStrategyName(req.Name) {
+			http.Error(w, "Invalid strategy name", http.StatusBadRequest)
+			return "", false
+		}
+		s, err := getStrategyStore().Get(r.Context(), req.Name)
+		if err != nil {
+			http.Error(w, "Strategy not found", http.StatusNotFound)
+			return "", false
+		}
+		req.Content = s.Content
+	}
+
+	if req.Content == "" {
+		http.Error(w, "Strategy content or name required", http.StatusBadRequest)
+		return "", false
+	}
+	return req.Content, true
+}
+
+func writeDBotIssues(w http.ResponseWriter, status int, issues []strategy.DBotIssue) {
+	if issues == nil {
+		issues = []strategy.DBotIssue{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"valid":  !strategy.HasDBotErrors(issues),
+		"issues": issues,
+	})
+}
+
+func handleStrategyValidate(w http.ResponseWriter, r *http.Request) {
+	content, ok := readStrategyRequest(w, r)
+	if !ok {
+		return
+	}
+	writeDBotIssues(w, http.StatusOK, strategy.ValidateDBotXML(content))
+}
+
+func handleStrategyConvert(w http.ResponseWriter, r *http.Request) {
+	content, ok := readStrategyRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if issues := strategy.ValidateDBotXML(content); strategy.HasDBotErrors(issues) {
+		writeDBotIssues(w, http.StatusUnprocessableEntity, issues)
+		return
+	}
+
+	conv, err := strategy.ConvertDBotToJS(content)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(conv)
+}
+
+// dryRunConfig is the bot configuration scripts are checked against.
+var dryRunConfig = strategy.Config{
+	Symbol:       "R_100",
+	InitialStake: 0.35,
+	Duration:     1,
+	DurationUnit: "t",
+}
+
+// checkStrategyContent lints and dry-runs a strategy. DBot XML is validated
+// and then checked through its JavaScript conversion.
+func checkStrategyContent(content string) strategy.ScriptCheckResult {
+	if !strategy.IsDBotXML(content) {
+		return strategy.CheckScript(content, dryRunConfig)
+	}
+
+	issues := strategy.ValidateDBotXML(content)
+	if strategy.HasDBotErrors(issues) {
+		result := strategy.ScriptCheckResult{Valid: false, Trades: []strategy.DryRunTrade{}, Logs: []string{}}
+		for _, issue := range issues {
+			msg := issue.Message
+			if issue.BlockType != "" {
+				msg = fmt.Sprintf("[%s] %s", issue.BlockType, msg)
+			}
+			result.Issues = append(result.Issues, strategy.ScriptIssue{Severity: issue.Severity, Message: msg})
+		}
+		return result
+	}
+
+	conv, err := strategy.ConvertDBotToJS(content)
+	if err != nil {
+		return strategy.ScriptCheckResult{
+			Issues: []strategy.ScriptIssue{{Severity: "error", Message: err.Error()}},
+			Trades: []strategy.DryRunTrade{},
+			Logs:   []string{},
+		}
+	}
+	return strategy.CheckScript(conv.Script, dryRunConfig)
+}
+
+func handleStrategyCheck(w http.ResponseWriter, r *http.Request) {
+	content, ok := readStrategyRequest(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(checkStrategyContent(content))
+}
+
+// handleStrategyParams returns a saved script's parameter schema with its
+// stored values (GET ?name=), or validates and stores new values (POST).
+func handleStrategyParams(w http.ResponseWriter, r *http.Request) {
+	var name string
+	var values map[string]interface{}
+
+	switch r.Method {
+	case http.MethodGet:
+		name = r.URL.Query().Get("name")
+	case http.MethodPost:
+		var req struct {
+			Name   string                 `json:"name"`
+			Params map[string]interface{} `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		name, values = req.Name, req.Params
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !validStrategyName(name) {
+		http.Error(w, "Invalid strategy name", http.StatusBadRequest)
+		return
+	}
+
+	store := getStrategyStore()
+	s, err := store.Get(r.Context(), name)
+	if err != nil {
+		http.Error(w, "Strategy not found", http.StatusNotFound)
+		return
+	}
+
+	specs, err := strategy.ScriptParams(s.Content)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if specs == nil {
+		specs = []strategy.ParamSpec{}
+	}
+
+	if r.Method == http.MethodGet {
+		values = s.Params
+	}
+	resolved, err := strategy.ResolveParams(specs, values)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		s.Params = resolved
+		if err := store.Save(r.Context(), s); err != nil {
+			http.Error(w, "Failed to save parameters", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"name":   name,
+		"schema": specs,
+		"values": resolved,
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"deriv_trade/strategy"
+
+	"github.com/ksysoev/deriv-api"
+)
+
+// maxRecordTicks caps a single history download.
+const maxRecordTicks = 100000
+
+// newDerivAPI opens a public Deriv API connection for requests the webserver
+// makes itself rather than through the bot process.
+func newDerivAPI() (*deriv.DerivAPI, error) {
+	return deriv.NewDerivAPI("wss://ws.binaryws.com/websockets/v3", 1089, "en", "https://localhost/")
+}
+
+// handleTicksRecord downloads recent tick history for a symbol and stores it
+// for backtests and optimization.
+func handleTicksRecord(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if dbClient == nil {
+		http.Error(w, "Database not connected", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Symbol string `json:"symbol"`
+		Count  int    `json:"count"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Symbol == "" {
+		http.Error(w, "symbol is required", http.StatusBadRequest)
+		return
+	}
+	if req.Count <= 0 || req.Count > maxRecordTicks {
+		http.Error(w, fmt.Sprintf("count must be between 1 and %d", maxRecordTicks), http.StatusBadRequest)
+		return
+	}
+
+	api, err := newDerivAPI()
+	if err != nil {
+		http.Error(w, "Failed to connect to Deriv API: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer api.Disconnect()
+
+	ticks, err := strategy.DownloadTicks(api, req.Symbol, req.Count)
+	if err != nil {
+		http.Error(w, "Failed to download ticks: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	stored, err := dbClient.SaveTicks(r.Context(), ticks)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"symbol":     req.Symbol,
+		"downloaded": len(ticks),
+		"stored":     stored,
+		"from":       ticks[0].Epoch,
+		"to":         ticks[len(ticks)-1].Epoch,
+	})
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"deriv_trade/strategy"
+)
+
+// Session limits for manual trades when the settings leave them unset;
+// they match the bot's command-line defaults.
+const (
+	defaultManualStopLoss     = 20.0
+	defaultManualTargetProfit = 30.0
+)
+
+var (
+	manualTraders  = map[string]*strategy.ManualTrader{} // account name -> trader
+	manualTraderMu sync.Mutex
+)
+
+// getManualTrader returns the trader for /api/trade on the named account
+// ("" is the default account), connecting on first use.
+func getManualTrader(account string) (*strategy.ManualTrader, error) {
+	if account == "" {
+		account = defaultAccountName
+	}
+	manualTraderMu.Lock()
+	defer manualTraderMu.Unlock()
+	if trader, ok := manualTraders[account]; ok {
+		return trader, nil
+	}
+
+	token, err := accountToken(account)
+	if err != nil {
+		return nil, err
+	}
+	sysConfigMu.RLock()
+	config := strategy.Config{
+		ApiToken:         token,
+		StopLoss:         sysConfig.ManualStopLoss,
+		TargetProfit:     sysConfig.ManualTargetProfit,
+		MaxOpenPositions: sysConfig.ManualMaxOpen,
+		MartingaleMulti:  1,
+		UseTrailingStop:  true,
+		DB:               dbClient,
+	}
+	sysConfigMu.RUnlock()
+	if config.StopLoss <= 0 {
+		config.StopLoss = defaultManualStopLoss
+	}
+	if config.TargetProfit <= 0 {
+		config.TargetProfit = defaultManualTargetProfit
+	}
+
+	api, err := newDerivAPI()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Deriv API: %w", err)
+	}
+	login, err := strategy.AuthorizeAccount(api, config.ApiToken)
+	if err != nil {
+		api.Disconnect()
+		return nil, fmt.Errorf("authorization failed: %w", err)
+	}
+	config.LoginID = login.LoginID
+
+	trader := strategy.NewManualTrader(api, config, func(msg string) {
+		broadcast(fmt.Sprintf("[%s] %s", account, msg), "info")
+	})
+	go trader.MonitorBalance(context.Background())
+	manualTraders[account] = trader
+	return trader, nil
+}
+
+// manualTradeError writes err with the status matching its cause.
+func manualTradeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, strategy.ErrManualLimit):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, strategy.ErrManualNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	}
+}
+
+// handleTradeProposal prices a manual order.
+func handleTradeProposal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		strategy.ManualOrder
+		Account string `json:"account"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := strategy.ValidateManualOrder(req.ManualOrder); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	trader, err := getManualTrader(req.Account)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	quote, err := trader.Proposal(req.ManualOrder)
+	if err != nil {
+		manualTradeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quote)
+}
+
+// handleTradeBuy buys a quote from /api/trade/proposal on the account it
+// was priced on.
+func handleTradeBuy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		ProposalID string `json:"proposal_id"`
+		Account    string `json:"account"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.ProposalID == "" {
+		http.Error(w, "proposal_id is required", http.StatusBadRequest)
+		return
+	}
+
+	trader, err := getManualTrader(req.Account)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	position, err := trader.Buy(r.Context(), req.ProposalID)
+	if err != nil {
+		manualTradeError(w, err)
+		return
+	}
+	setContractOwner(position.ContractID, strategy.ManualStrategyName)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(position)
+}
+
+// handleTradeSell sells an open manual contract at market.
+func handleTradeSell(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		ContractID int    `json:"contract_id"`
+		Account    string `json:"account"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.ContractID <= 0 {
+		http.Error(w, "contract_id is required", http.StatusBadRequest)
+		return
+	}
+
+	trader, err := getManualTrader(req.Account)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	sale, err := trader.Sell(req.ContractID)
+	if err != nil {
+		manualTradeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sale)
+}
+
+// handleTradeLimits moves the take profit and/or stop loss of an open
+// multiplier contract on an account, whether a bot or a manual trade opened
+// it. A limit of 0 is left unchanged.
+func handleTradeLimits(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		ContractID int     `json:"contract_id"`
+		Account    string  `json:"account"`
+		TakeProfit float64 `json:"take_profit"`
+		StopLoss   float64 `json:"stop_loss"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.ContractID <= 0 {
+		http.Error(w, "contract_id is required", http.StatusBadRequest)
+		return
+	}
+	if req.TakeProfit < 0 || req.StopLoss < 0 || req.TakeProfit == 0 && req.StopLoss == 0 {
+		http.Error(w, "take_profit or stop_loss must be positive", http.StatusBadRequest)
+		return
+	}
+	token, err := accountToken(req.Account)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	api, err := newDerivAPI()
+	if err != nil {
+		http.Error(w, "Failed to connect to Deriv API: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer api.Disconnect()
+	if _, err := strategy.AuthorizeAccount(api, token); err != nil {
+		http.Error(w, "Authorization failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	if err := strategy.UpdateLimitOrder(api, req.ContractID, req.TakeProfit, req.StopLoss); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"contract_id": req.ContractID,
+		"take_profit": req.TakeProfit,
+		"stop_loss":   req.StopLoss,
+	})
+}
+
+// handleTradeOpen lists the open manual contracts and the session PnL of
+// one account, given by the account query parameter.
+func handleTradeOpen(w http.ResponseWriter, r *http.Request) {
+	account := r.URL.Query().Get("account")
+	if account == "" {
+		account = defaultAccountName
+	}
+	status := strategy.ManualStatus{Positions: []strategy.ManualPosition{}}
+	manualTraderMu.Lock()
+	trader := manualTraders[account]
+	manualTraderMu.Unlock()
+	if trader != nil {
+		status = trader.Status()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"deriv_trade/database"
+)
+
+func handleStrategyVersions(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if !validStrategyName(name) {
+		http.Error(w, "Invalid strategy name", http.StatusBadRequest)
+		return
+	}
+
+	versions, err := getStrategyStore().Versions(r.Context(), name)
+	if err != nil {
+		http.Error(w, "Failed to read versions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+// DiffLine is one line of a line-based diff; Op is " ", "-" or "+".
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// maxDiffLines caps the changed lines diffLines compares: its table grows
+// with the product of both sides.
+const maxDiffLines = 4000
+
+var errDiffTooLarge = fmt.Errorf("versions differ in more than %d lines", maxDiffLines)
+
+// diffLines computes a minimal line diff using the longest common
+// subsequence of the lines between the common prefix and suffix. It fails
+// with errDiffTooLarge when more than maxDiffLines lines remain.
+func diffLines(a, b []string) ([]DiffLine, error) {
+	var out []DiffLine
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		out = append(out, DiffLine{" ", a[0]})
+		a, b = a[1:], b[1:]
+	}
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	common := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+	if len(a)+len(b) > maxDiffLines {
+		return nil, errDiffTooLarge
+	}
+
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, DiffLine{" ", a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, DiffLine{"-", a[i]})
+			i++
+		default:
+			out = append(out, DiffLine{"+", b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		out = append(out, DiffLine{"-", a[i]})
+	}
+	for ; j < len(b); j++ {
+		out = append(out, DiffLine{"+", b[j]})
+	}
+	for _, line := range common {
+		out = append(out, DiffLine{" ", line})
+	}
+	return out, nil
+}
+
+// handleStrategyDiff compares two versions (?name=&from=&to=). "to" defaults
+// to the file currently saved.
+func handleStrategyDiff(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	name := q.Get("name")
+	if !validStrategyName(name) {
+		http.Error(w, "Invalid strategy name", http.StatusBadRequest)
+		return
+	}
+
+	from, err := strconv.Atoi(q.Get("from"))
+	if err != nil {
+		http.Error(w, "Invalid from version", http.StatusBadRequest)
+		return
+	}
+	store := getStrategyStore()
+	fromVersion, err := store.Version(r.Context(), name, from)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	toLabel := "current"
+	var toContent string
+	if q.Get("to") == "" {
+		current, err := store.Get(r.Context(), name)
+		if err != nil {
+			http.Error(w, "Strategy not found", http.StatusNotFound)
+			return
+		}
+		toContent = current.Content
+	} else {
+		to, err := strconv.Atoi(q.Get("to"))
+		if err != nil {
+			http.Error(w, "Invalid to version", http.StatusBadRequest)
+			return
+		}
+		toVersion, err := store.Version(r.Context(), name, to)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		toContent = toVersion.Content
+		toLabel = strconv.Itoa(to)
+	}
+
+	lines, err := diffLines(strings.Split(fromVersion.Content, "\n"), strings.Split(toContent, "\n"))
+	if errors.Is(err, errDiffTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	added, removed := 0, 0
+	for _, l := range lines {
+		switch l.Op {
+		case "+":
+			added++
+		case "-":
+			removed++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"name":    name,
+		"from":    strconv.Itoa(from),
+		"to":      toLabel,
+		"added":   added,
+		"removed": removed,
+		"lines":   lines,
+	})
+}
+
+// handleStrategyRestore writes a previous version back as the current file
+// and records the restore as a new version.
+func handleStrategyRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Name    string `json:"name"`
+		Version int    `json:"version"`
+		Note    string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if !validStrategyName(req.Name) {
+		http.Error(w, "Invalid strategy name", http.StatusBadRequest)
+		return
+	}
+
+	store := getStrategyStore()
+	ctx := r.Context()
+	restored, err := store.Version(ctx, req.Name, req.Version)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	// Keep the current metadata; a deleted strategy comes back without tags
+	s := &database.Strategy{Name: req.Name, Tags: []string{}}
+	if current, err := store.Get(ctx, req.Name); err == nil {
+		s = current
+		if _, err := store.AddVersion(ctx, req.Name, current.Content, "snapshot of existing file"); err != nil {
+			log.Printf("Failed to snapshot strategy %s: %v", req.Name, err)
+		}
+	}
+	s.Content = restored.Content
+	if err := store.Save(ctx, s); err != nil {
+		http.Error(w, "Failed to restore strategy", http.StatusInternalServerError)
+		return
+	}
+
+	note := req.Note
+	if note == "" {
+		note = fmt.Sprintf("restored from version %d", req.Version)
+	}
+	v, err := store.AddVersion(ctx, req.Name, restored.Content, note)
+	if err != nil {
+		http.Error(w, "Failed to record version", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "restored", "name": req.Name, "version": v})
+}
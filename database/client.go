@@ -25,6 +25,12 @@ type Client struct {
 	trades   *mongo.Collection
 	sessions *mongo.Collection
 	journals *mongo.Collection
+
+	strategies       *mongo.Collection
+	strategyVersions *mongo.Collection
+	ticks            *mongo.Collection
+	optimizations    *mongo.Collection
+	reconciliations  *mongo.Collection
 }
 
 // NewClient creates a new MongoDB client
@@ -57,6 +63,12 @@ func NewClient(mongoURI string) (*Client, error) {
 		trades:   db.Collection(TradesCollection),
 		sessions: db.Collection(SessionsCollection),
 		journals: db.Collection("journals"),
+
+		strategies:       db.Collection("strategies"),
+		strategyVersions: db.Collection("strategy_versions"),
+		ticks:            db.Collection("ticks"),
+		optimizations:    db.Collection("optimizations"),
+		reconciliations:  db.Collection("reconciliations"),
 	}, nil
 }
 
@@ -101,6 +113,15 @@ func (c *Client) GetTrades(ctx context.Context, filter bson.M, limit int64) ([]T
 	return trades, nil
 }
 
+// UpdateTrade updates a trade record
+func (c *Client) UpdateTrade(ctx context.Context, id primitive.ObjectID, update bson.M) error {
+	_, err := c.trades.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": update})
+	if err != nil {
+		return fmt.Errorf("failed to update trade: %w", err)
+	}
+	return nil
+}
+
 // GetTradesByStrategy retrieves trades for a specific strategy
 func (c *Client) GetTradesByStrategy(ctx context.Context, strategy string, limit int64) ([]Trade, error) {
 	filter := bson.M{"strategy": strategy}
@@ -240,3 +261,295 @@ func (c *Client) DeleteJournalEntry(ctx context.Context, id primitive.ObjectID)
 	_, err := c.journals.DeleteOne(ctx, bson.M{"_id": id})
 	return err
 }
+
+// ListStrategies retrieves strategies matching filter, without their content
+func (c *Client) ListStrategies(ctx context.Context, filter bson.M) ([]Strategy, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetProjection(bson.M{"content": 0})
+
+	cursor, err := c.strategies.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find strategies: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var strategies []Strategy
+	if err := cursor.All(ctx, &strategies); err != nil {
+		return nil, fmt.Errorf("failed to decode strategies: %w", err)
+	}
+
+	return strategies, nil
+}
+
+// GetStrategy retrieves a strategy by name, returning nil if it does not exist
+func (c *Client) GetStrategy(ctx context.Context, name string) (*Strategy, error) {
+	var strategy Strategy
+	err := c.strategies.FindOne(ctx, bson.M{"_id": name}).Decode(&strategy)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find strategy: %w", err)
+	}
+	return &strategy, nil
+}
+
+// SaveStrategy creates or replaces a strategy in a single atomic upsert,
+// keeping the original creation time
+func (c *Client) SaveStrategy(ctx context.Context, strategy *Strategy) error {
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"content":     strategy.Content,
+			"description": strategy.Description,
+			"tags":        strategy.Tags,
+			"params":      strategy.Params,
+			"updated_at":  now,
+
+			"recommended_config": strategy.RecommendedConfig,
+			"backtest":           strategy.Backtest,
+		},
+		"$setOnInsert": bson.M{"created_at": now},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	if err := c.strategies.FindOneAndUpdate(ctx, bson.M{"_id": strategy.Name}, update, opts).Decode(strategy); err != nil {
+		return fmt.Errorf("failed to save strategy: %w", err)
+	}
+	return nil
+}
+
+// DeleteStrategy deletes a strategy by name; its versions are kept
+func (c *Client) DeleteStrategy(ctx context.Context, name string) error {
+	_, err := c.strategies.DeleteOne(ctx, bson.M{"_id": name})
+	return err
+}
+
+// InsertStrategyVersion records a new strategy revision
+func (c *Client) InsertStrategyVersion(ctx context.Context, version *StrategyVersion) error {
+	if version.Timestamp.IsZero() {
+		version.Timestamp = time.Now()
+	}
+
+	result, err := c.strategyVersions.InsertOne(ctx, version)
+	if err != nil {
+		return fmt.Errorf("failed to insert strategy version: %w", err)
+	}
+
+	version.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetStrategyVersions retrieves a strategy's revisions, newest first, without their content
+func (c *Client) GetStrategyVersions(ctx context.Context, name string) ([]StrategyVersion, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "version", Value: -1}}).
+		SetProjection(bson.M{"content": 0})
+
+	cursor, err := c.strategyVersions.Find(ctx, bson.M{"name": name}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find strategy versions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var versions []StrategyVersion
+	if err := cursor.All(ctx, &versions); err != nil {
+		return nil, fmt.Errorf("failed to decode strategy versions: %w", err)
+	}
+
+	return versions, nil
+}
+
+// GetStrategyVersion retrieves one revision with its content, returning nil if it does not exist
+func (c *Client) GetStrategyVersion(ctx context.Context, name string, version int) (*StrategyVersion, error) {
+	var v StrategyVersion
+	err := c.strategyVersions.FindOne(ctx, bson.M{"name": name, "version": version}).Decode(&v)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find strategy version: %w", err)
+	}
+	return &v, nil
+}
+
+// SaveTicks stores recorded ticks, skipping any already stored for the same
+// symbol and epoch, and returns how many were new
+func (c *Client) SaveTicks(ctx context.Context, ticks []Tick) (int, error) {
+	if len(ticks) == 0 {
+		return 0, nil
+	}
+
+	models := make([]mongo.WriteModel, 0, len(ticks))
+	for _, t := range ticks {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"symbol": t.Symbol, "epoch": t.Epoch}).
+			SetUpdate(bson.M{"$setOnInsert": t}).
+			SetUpsert(true))
+	}
+
+	result, err := c.ticks.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return 0, fmt.Errorf("failed to save ticks: %w", err)
+	}
+	return int(result.UpsertedCount), nil
+}
+
+// GetTicks retrieves recorded ticks for a symbol, oldest first. Zero from/to
+// leave that end of the range open; limit keeps the most recent ticks.
+func (c *Client) GetTicks(ctx context.Context, symbol string, from, to time.Time, limit int64) ([]Tick, error) {
+	filter := bson.M{"symbol": symbol}
+	epoch := bson.M{}
+	if !from.IsZero() {
+		epoch["$gte"] = from.Unix()
+	}
+	if !to.IsZero() {
+		epoch["$lte"] = to.Unix()
+	}
+	if len(epoch) > 0 {
+		filter["epoch"] = epoch
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "epoch", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := c.ticks.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find ticks: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var ticks []Tick
+	if err := cursor.All(ctx, &ticks); err != nil {
+		return nil, fmt.Errorf("failed to decode ticks: %w", err)
+	}
+
+	// Newest first keeps the limit on the recent end; callers want oldest first
+	for i, j := 0, len(ticks)-1; i < j; i, j = i+1, j-1 {
+		ticks[i], ticks[j] = ticks[j], ticks[i]
+	}
+	return ticks, nil
+}
+
+// CreateOptimization inserts a new optimization run
+func (c *Client) CreateOptimization(ctx context.Context, run *OptimizationRun) error {
+	if run.CreatedAt.IsZero() {
+		run.CreatedAt = time.Now()
+	}
+
+	result, err := c.optimizations.InsertOne(ctx, run)
+	if err != nil {
+		return fmt.Errorf("failed to insert optimization: %w", err)
+	}
+
+	run.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// UpdateOptimization updates an optimization run
+func (c *Client) UpdateOptimization(ctx context.Context, id primitive.ObjectID, update bson.M) error {
+	_, err := c.optimizations.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": update})
+	if err != nil {
+		return fmt.Errorf("failed to update optimization: %w", err)
+	}
+	return nil
+}
+
+// GetOptimizations retrieves recent optimization runs without their results
+func (c *Client) GetOptimizations(ctx context.Context, limit int64) ([]OptimizationRun, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetProjection(bson.M{"results": 0})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := c.optimizations.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find optimizations: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var runs []OptimizationRun
+	if err := cursor.All(ctx, &runs); err != nil {
+		return nil, fmt.Errorf("failed to decode optimizations: %w", err)
+	}
+
+	return runs, nil
+}
+
+// GetOptimization retrieves one optimization run with its results, returning nil if it does not exist
+func (c *Client) GetOptimization(ctx context.Context, id primitive.ObjectID) (*OptimizationRun, error) {
+	var run OptimizationRun
+	err := c.optimizations.FindOne(ctx, bson.M{"_id": id}).Decode(&run)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find optimization: %w", err)
+	}
+	return &run, nil
+}
+
+// CreateReconciliation inserts a new reconciliation report
+func (c *Client) CreateReconciliation(ctx context.Context, report *ReconciliationReport) error {
+	if report.CreatedAt.IsZero() {
+		report.CreatedAt = time.Now()
+	}
+
+	result, err := c.reconciliations.InsertOne(ctx, report)
+	if err != nil {
+		return fmt.Errorf("failed to insert reconciliation: %w", err)
+	}
+
+	report.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// UpdateReconciliation updates a reconciliation report
+func (c *Client) UpdateReconciliation(ctx context.Context, id primitive.ObjectID, update bson.M) error {
+	_, err := c.reconciliations.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": update})
+	if err != nil {
+		return fmt.Errorf("failed to update reconciliation: %w", err)
+	}
+	return nil
+}
+
+// GetReconciliations retrieves recent reconciliation reports without their items
+func (c *Client) GetReconciliations(ctx context.Context, limit int64) ([]ReconciliationReport, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetProjection(bson.M{"items": 0})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := c.reconciliations.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find reconciliations: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var reports []ReconciliationReport
+	if err := cursor.All(ctx, &reports); err != nil {
+		return nil, fmt.Errorf("failed to decode reconciliations: %w", err)
+	}
+
+	return reports, nil
+}
+
+// GetReconciliation retrieves one reconciliation report with its items, returning nil if it does not exist
+func (c *Client) GetReconciliation(ctx context.Context, id primitive.ObjectID) (*ReconciliationReport, error) {
+	var report ReconciliationReport
+	err := c.reconciliations.FindOne(ctx, bson.M{"_id": id}).Decode(&report)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find reconciliation: %w", err)
+	}
+	return &report, nil
+}
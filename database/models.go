@@ -23,8 +23,28 @@ type Trade struct {
 	Prediction   int                `bson:"prediction,omitempty" json:"prediction,omitempty"`
 	Timestamp    time.Time          `bson:"timestamp" json:"timestamp"`
 	ContractID   string             `bson:"contract_id,omitempty" json:"contract_id,omitempty"`
+	LoginID      string             `bson:"login_id,omitempty" json:"login_id,omitempty"` // Deriv account the trade was placed on
+	// Early exit: why the contract was sold before expiry, the sale price
+	// minus the bid it was sold on, how many sell attempts failed and the
+	// last failure
+	ExitReason   string  `bson:"exit_reason,omitempty" json:"exit_reason,omitempty"`
+	ExitSlippage float64 `bson:"exit_slippage,omitempty" json:"exit_slippage,omitempty"`
+	SellFailures int     `bson:"sell_failures,omitempty" json:"sell_failures,omitempty"`
+	SellError    string  `bson:"sell_error,omitempty" json:"sell_error,omitempty"`
+	// Reconciliation against the account's profit table: ReconcileInserted
+	// for trades recovered from Deriv, ReconcileMismatch with the profit
+	// Deriv reported when it differs from Profit
+	Reconciliation string  `bson:"reconciliation,omitempty" json:"reconciliation,omitempty"`
+	DerivProfit    float64 `bson:"deriv_profit,omitempty" json:"deriv_profit,omitempty"`
 }
 
+// Trade reconciliation flags and the strategy recorded on recovered trades
+const (
+	ReconcileInserted  = "inserted"
+	ReconcileMismatch  = "mismatch"
+	ReconciledStrategy = "reconciled"
+)
+
 // TradingSession represents a trading session summary
 type TradingSession struct {
 	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
@@ -39,6 +59,10 @@ type TradingSession struct {
 	InitialStake  float64            `bson:"initial_stake" json:"initial_stake"`
 	FinalBalance  float64            `bson:"final_balance" json:"final_balance"`
 	StopReason    string             `bson:"stop_reason,omitempty" json:"stop_reason,omitempty"`
+	LoginID       string             `bson:"login_id,omitempty" json:"login_id,omitempty"` // Deriv account the session traded on
+	// Saved script name and content hash the session ran (custom and dbot strategies)
+	ScriptName string `bson:"script_name,omitempty" json:"script_name,omitempty"`
+	ScriptHash string `bson:"script_hash,omitempty" json:"script_hash,omitempty"`
 }
 
 // JournalEntry represents a user's journal entry regarding their trading activity
@@ -50,3 +74,115 @@ type JournalEntry struct {
 	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
 }
+
+// Strategy represents a saved strategy script (JavaScript or DBot XML) and its metadata
+type Strategy struct {
+	Name        string                 `bson:"_id" json:"name"` // File name, e.g. "trend.js"
+	Content     string                 `bson:"content" json:"content,omitempty"`
+	Description string                 `bson:"description,omitempty" json:"description,omitempty"`
+	Tags        []string               `bson:"tags" json:"tags"`
+	Params      map[string]interface{} `bson:"params,omitempty" json:"params,omitempty"` // Values for the script's declared parameters
+	// Bot settings the author recommends, and the backtest that supports them
+	RecommendedConfig map[string]interface{} `bson:"recommended_config,omitempty" json:"recommended_config,omitempty"`
+	Backtest          *BacktestSummary       `bson:"backtest,omitempty" json:"backtest,omitempty"`
+	CreatedAt         time.Time              `bson:"created_at" json:"created_at"`
+	UpdatedAt         time.Time              `bson:"updated_at" json:"updated_at"`
+}
+
+// BacktestSummary summarizes a strategy's simulated performance over recorded ticks
+type BacktestSummary struct {
+	Symbol       string    `bson:"symbol" json:"symbol"`
+	From         time.Time `bson:"from" json:"from"`
+	To           time.Time `bson:"to" json:"to"`
+	Ticks        int       `bson:"ticks" json:"ticks"`
+	Trades       int       `bson:"trades" json:"trades"`
+	Wins         int       `bson:"wins" json:"wins"`
+	Losses       int       `bson:"losses" json:"losses"`
+	NetPnL       float64   `bson:"net_pnl" json:"net_pnl"`
+	ProfitFactor float64   `bson:"profit_factor" json:"profit_factor"`
+	MaxDrawdown  float64   `bson:"max_drawdown" json:"max_drawdown"`
+	Sharpe       float64   `bson:"sharpe" json:"sharpe"`
+}
+
+// StrategyVersion represents one saved revision of a strategy's content
+type StrategyVersion struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	Name      string             `bson:"name" json:"-"`
+	Version   int                `bson:"version" json:"version"`
+	Hash      string             `bson:"hash" json:"hash"` // SHA-256 of Content
+	Timestamp time.Time          `bson:"timestamp" json:"timestamp"`
+	Note      string             `bson:"note,omitempty" json:"note,omitempty"`
+	Size      int                `bson:"size" json:"size"`
+	Content   string             `bson:"content,omitempty" json:"-"`
+}
+
+// Tick is one recorded price quote, used to backtest and optimize strategies
+type Tick struct {
+	Symbol string  `bson:"symbol" json:"symbol"`
+	Epoch  int64   `bson:"epoch" json:"epoch"`
+	Quote  float64 `bson:"quote" json:"quote"`
+	// Decimal places the symbol is quoted with; the last digit is read at this precision
+	PipSize int `bson:"pip_size,omitempty" json:"pip_size,omitempty"`
+}
+
+// OptimizationRun records a parameter search over recorded ticks and its ranked results
+type OptimizationRun struct {
+	ID           primitive.ObjectID     `bson:"_id,omitempty" json:"id"`
+	Strategy     string                 `bson:"strategy" json:"strategy"`
+	Symbol       string                 `bson:"symbol" json:"symbol"`
+	Mode         string                 `bson:"mode" json:"mode"`     // "grid" or "random"
+	Metric       string                 `bson:"metric" json:"metric"` // Ranking metric, e.g. "net_pnl"
+	Ranges       map[string][]float64   `bson:"ranges" json:"ranges"` // Values tried per parameter
+	Base         map[string]interface{} `bson:"base,omitempty" json:"base,omitempty"`
+	Status       string                 `bson:"status" json:"status"` // "running", "completed" or "failed"
+	Error        string                 `bson:"error,omitempty" json:"error,omitempty"`
+	Combinations int                    `bson:"combinations" json:"combinations"`
+	From         time.Time              `bson:"from" json:"from"`
+	To           time.Time              `bson:"to" json:"to"`
+	Ticks        int                    `bson:"ticks" json:"ticks"`
+	Results      []OptimizationResult   `bson:"results,omitempty" json:"results,omitempty"`
+	CreatedAt    time.Time              `bson:"created_at" json:"created_at"`
+	CompletedAt  *time.Time             `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+}
+
+// OptimizationResult is one backtested parameter combination
+type OptimizationResult struct {
+	Rank       int                `bson:"rank" json:"rank"`
+	Params     map[string]float64 `bson:"params" json:"params"`
+	Summary    BacktestSummary    `bson:"summary" json:"summary"`
+	StopReason string             `bson:"stop_reason,omitempty" json:"stop_reason,omitempty"`
+}
+
+// ReconciliationReport compares the trades stored for a time range with the
+// contracts the account's profit table reports as settled
+type ReconciliationReport struct {
+	ID           primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Account      string               `bson:"account" json:"account"`
+	LoginID      string               `bson:"login_id,omitempty" json:"login_id,omitempty"`
+	From         time.Time            `bson:"from" json:"from"`
+	To           time.Time            `bson:"to" json:"to"`
+	Status       string               `bson:"status" json:"status"` // "running", "completed" or "failed"
+	Error        string               `bson:"error,omitempty" json:"error,omitempty"`
+	Contracts    int                  `bson:"contracts" json:"contracts"` // Settled contracts reported by Deriv
+	Matched      int                  `bson:"matched" json:"matched"`
+	Inserted     int                  `bson:"inserted" json:"inserted"`
+	Mismatched   int                  `bson:"mismatched" json:"mismatched"`
+	Tagged       int                  `bson:"tagged" json:"tagged"`               // Trades without a contract id matched to a contract and given its id
+	DatabaseOnly int                  `bson:"database_only" json:"database_only"` // Stored trades Deriv did not report
+	DerivPnL     float64              `bson:"deriv_pnl" json:"deriv_pnl"`
+	DatabasePnL  float64              `bson:"database_pnl" json:"database_pnl"` // Stored PnL for the range before reconciling
+	Items        []ReconciliationItem `bson:"items,omitempty" json:"items,omitempty"`
+	CreatedAt    time.Time            `bson:"created_at" json:"created_at"`
+	CompletedAt  *time.Time           `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+}
+
+// ReconciliationItem is one contract a reconciliation inserted or flagged
+type ReconciliationItem struct {
+	ContractID     string  `bson:"contract_id" json:"contract_id"`
+	Action         string  `bson:"action" json:"action"` // "inserted", "mismatch" or "database_only"
+	Strategy       string  `bson:"strategy,omitempty" json:"strategy,omitempty"`
+	Symbol         string  `bson:"symbol,omitempty" json:"symbol,omitempty"`
+	ContractType   string  `bson:"contract_type,omitempty" json:"contract_type,omitempty"`
+	DerivProfit    float64 `bson:"deriv_profit" json:"deriv_profit"`
+	DatabaseProfit float64 `bson:"database_profit" json:"database_profit"`
+}
@@ -2,9 +2,13 @@ const { app, BrowserWindow, dialog } = require('electron');
 const path = require('path');
 const { spawn } = require('child_process');
 const fs = require('fs');
+const crypto = require('crypto');
 
 let mainWindow;
 let serverProcess;
+// Lets the window create the first dashboard admin; the server only
+// accepts it while no users exist
+const setupToken = crypto.randomBytes(32).toString('hex');
 
 function createWindow() {
     mainWindow = new BrowserWindow({
@@ -21,7 +25,7 @@ function createWindow() {
     // We'll wait a bit or retry connection
     const loadURL = async () => {
         const port = process.env.PORT || '8080';
-        const url = `http://localhost:${port}`;
+        const url = `http://localhost:${port}/?setup_token=${setupToken}`;
 
         // Simple retry loop
         const maxRetries = 20;
@@ -71,7 +75,8 @@ function startServer() {
     console.log("CWD:", cwd);
 
     const env = Object.assign({}, process.env, {
-        PORT: '8080' // Enforce specific port or use dynamic if we wanted
+        PORT: '8080', // Enforce specific port or use dynamic if we wanted
+        DERIV_TRADER_SETUP_TOKEN: setupToken
     });
 
     serverProcess = spawn(backendPath, [], {
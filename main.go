@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
@@ -28,11 +29,20 @@ const (
 func main() {
 	// Parse Flags
 	// Parse Flags
-	stratName := flag.String("strategy", "even_odd", "Strategy to run: even_odd, rise_fall, differs, higher_lower, multiplier")
+	stratName := flag.String("strategy", "even_odd", "Strategy to run: even_odd, rise_fall, differs, over_under, higher_lower, touch_no_touch, ends_in_out, stays_in_out, multiplier, custom, dbot")
 	duration := flag.Int("duration", 0, "Duration of the trade (ticks or seconds)")
 	durationUnit := flag.String("unit", "t", "Duration unit: t (ticks), s (seconds), m (minutes)")
 	barrier := flag.String("barrier", "", "Barrier offset (e.g., +0.5, -0.5)")
 	multiplier := flag.Int("multiplier", 100, "Multiplier value (e.g., 100, 200, 500)")
+	takeProfit := flag.Float64("take_profit", 0, "Per-trade take profit for multipliers (0 disables)")
+	tradeStopLoss := flag.Float64("trade_stop_loss", 0, "Per-trade stop loss for multipliers (0 disables)")
+	trailActivation := flag.Float64("trail_activation", 0, "Profit at which a multiplier's trailing take profit arms (0 arms once in profit)")
+	trailDistance := flag.Float64("trail_distance", 0, "Distance of a multiplier's trailing take profit below its peak profit (0 disables)")
+	cancellation := flag.String("cancellation", "", "Deal cancellation window for multipliers: 5m, 10m, 15m, 30m or 60m")
+	exitBidPercent := flag.Float64("exit_bid_percent", 0, "Sell a contract early once its bid reaches this % of the payout (0 disables)")
+	exitAdverseTicks := flag.Int("exit_adverse_ticks", 0, "Sell a contract early after its bid falls this many updates in a row (0 disables)")
+	exitSellTolerance := flag.Float64("exit_sell_tolerance", 0, "How far in % below the observed bid an early sale may fill (0 uses 1%)")
+	prediction := flag.Int("prediction", -1, "Digit prediction for digit contracts (0-9, -1 lets the strategy choose)")
 
 	// New Flags
 	symbol := flag.String("symbol", "R_10", "Symbol to trade")
@@ -42,9 +52,42 @@ func main() {
 	martingale := flag.Float64("martingale", 1.0, "Martingale multiplier")
 	streakThreshold := flag.Int("streak", 1, "Streak threshold for some strategies")
 	trailingStop := flag.Bool("trailing_stop", true, "Enable trailing stop loss")
+	warmupTicks := flag.Int("warmup", 0, "Ticks of history to replay before trading starts (0 disables)")
+	maxOpen := flag.Int("max_open", 1, "Maximum contracts open at once")
+	minTicks := flag.Int("min_ticks", 0, "Minimum ticks between entries")
+	minSeconds := flag.Int("min_seconds", 0, "Minimum seconds between entries")
+
+	// Monte Carlo simulation (no trading)
+	simulate := flag.Bool("simulate", false, "Run a Monte Carlo risk-of-ruin simulation of the stake settings and exit")
+	winProb := flag.Float64("win_prob", 0.5, "Simulated probability of winning a trade")
+	payout := flag.Float64("payout", 0.95, "Simulated profit ratio of a winning trade")
+	sessions := flag.Int("sessions", 10000, "Number of simulated sessions")
+	maxTrades := flag.Int("max_trades", 10000, "Trades per simulated session before it counts as unfinished")
+	seed := flag.Int64("seed", 1, "Simulation random seed")
 
 	flag.Parse()
 
+	if *simulate {
+		report, err := strategy.Simulate(context.Background(), strategy.SimulationOptions{
+			WinProbability:  *winProb,
+			Payout:          *payout,
+			InitialStake:    *initialStake,
+			MartingaleMulti: *martingale,
+			StopLoss:        *stopLoss,
+			TargetProfit:    *targetProfit,
+			UseTrailingStop: *trailingStop,
+			Sessions:        *sessions,
+			MaxTrades:       *maxTrades,
+			Seed:            *seed,
+		})
+		if err != nil {
+			log.Fatalf("Simulation failed: %v", err)
+		}
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+
 	// Get API Token
 	apiToken := os.Getenv("DERIV_API_TOKEN")
 	if apiToken == "" {
@@ -71,6 +114,20 @@ func main() {
 		}()
 	}
 
+	// Connect to Deriv API
+	api, err := deriv.NewDerivAPI(DerivWSEndpoint, AppID, Language, Origin)
+	if err != nil {
+		log.Fatalf("Failed to connect to Deriv API: %v", err)
+	}
+	defer api.Disconnect()
+
+	// The login id tags the session and its trades with the account they ran on
+	account, err := strategy.AuthorizeAccount(api, apiToken)
+	if err != nil {
+		log.Fatalf("Authorization failed: %v", err)
+	}
+	log.Printf("Trading on account %s (%s)", account.LoginID, account.Currency)
+
 	// Create Trading Session
 	var sessionID primitive.ObjectID
 	if dbClient != nil {
@@ -78,6 +135,14 @@ func main() {
 			Strategy:     *stratName,
 			StartTime:    time.Now(),
 			InitialStake: *initialStake,
+			LoginID:      account.LoginID,
+		}
+		// Attribute script-driven sessions to the exact code they ran
+		if *stratName == "custom" || *stratName == "dbot" {
+			session.ScriptName = os.Getenv("STRATEGY_NAME")
+			if script := os.Getenv("STRATEGY_SCRIPT"); script != "" {
+				session.ScriptHash = strategy.ScriptHash(script)
+			}
 		}
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		if err := dbClient.CreateSession(ctx, session); err != nil {
@@ -91,21 +156,34 @@ func main() {
 
 	// Base Configuration
 	config := strategy.Config{
-		ApiToken:        apiToken,
-		Symbol:          *symbol,
-		Duration:        2,
-		DurationUnit:    "t",
-		InitialStake:    *initialStake,
-		TargetProfit:    *targetProfit,
-		StopLoss:        *stopLoss,
-		StreakThreshold: *streakThreshold,
-		Prediction:      -1,
-		Multiplier:      100,
-		DB:              dbClient,
-		SessionID:       sessionID,
-		StrategyName:    *stratName,
-		MartingaleMulti: *martingale,
-		UseTrailingStop: *trailingStop,
+		ApiToken:          apiToken,
+		LoginID:           account.LoginID,
+		Symbol:            *symbol,
+		Duration:          2,
+		DurationUnit:      "t",
+		InitialStake:      *initialStake,
+		TargetProfit:      *targetProfit,
+		StopLoss:          *stopLoss,
+		StreakThreshold:   *streakThreshold,
+		Prediction:        *prediction,
+		Multiplier:        100,
+		DB:                dbClient,
+		SessionID:         sessionID,
+		StrategyName:      *stratName,
+		MartingaleMulti:   *martingale,
+		UseTrailingStop:   *trailingStop,
+		WarmupTicks:       *warmupTicks,
+		TakeProfit:        *takeProfit,
+		TradeStopLoss:     *tradeStopLoss,
+		DealCancellation:  *cancellation,
+		TrailActivation:   *trailActivation,
+		TrailDistance:     *trailDistance,
+		ExitBidPercent:    *exitBidPercent,
+		ExitAdverseTicks:  *exitAdverseTicks,
+		ExitSellTolerance: *exitSellTolerance,
+		MaxOpenPositions:  *maxOpen,
+		MinEntryTicks:     *minTicks,
+		MinEntrySeconds:   *minSeconds,
 	}
 
 	// Apply Flags (Overrides if explicitly set, though we used defaults in flags now)
@@ -122,6 +200,10 @@ func main() {
 		config.Multiplier = *multiplier
 	}
 
+	if err := strategy.ValidateEarlyExit(config.ExitBidPercent, config.ExitAdverseTicks, config.ExitSellTolerance); err != nil {
+		log.Fatalf("Invalid early exit rules: %v", err)
+	}
+
 	// Strategy Specific Tweaks
 	switch *stratName {
 	case "even_odd":
@@ -134,26 +216,33 @@ func main() {
 	case "differs":
 		// config.MartingaleMulti = 11.0 // Removing override
 		// config.TargetProfit = 5.0 // Removing override
+	case "over_under":
+		if config.Prediction < -1 || config.Prediction > 9 {
+			log.Fatalf("Prediction must be between 0 and 9 (or -1 to let the strategy choose), got %d", config.Prediction)
+		}
 	case "higher_lower":
 		// config.MartingaleMulti = 2.1 // Removing override
 		if config.Barrier == "" {
 			log.Fatal("Barrier must be specified for higher_lower strategy (e.g., -barrier +0.1)")
 		}
+	case "touch_no_touch", "ends_in_out", "stays_in_out":
+		// Barriers follow recent volatility unless -barrier fixes the offset
 	case "multiplier":
 		// config.MartingaleMulti = 1.0 // Removing override
+		if err := strategy.ValidateMultiplierLimits(config.TakeProfit, config.TradeStopLoss, config.DealCancellation); err != nil {
+			log.Fatalf("Invalid multiplier limits: %v", err)
+		}
+		if err := strategy.ValidateTrailingTakeProfit(config.TrailActivation, config.TrailDistance); err != nil {
+			log.Fatalf("Invalid trailing take profit: %v", err)
+		}
 	case "custom":
 		// No specific tweaks needed for custom strategy yet
+	case "dbot":
+		// Symbol and trade type come from the workspace's trade_definition
 	default:
 		log.Fatalf("Unknown strategy: %s", *stratName)
 	}
 
-	// Connect to Deriv API
-	api, err := deriv.NewDerivAPI(DerivWSEndpoint, AppID, Language, Origin)
-	if err != nil {
-		log.Fatalf("Failed to connect to Deriv API: %v", err)
-	}
-	defer api.Disconnect()
-
 	// Create Strategy Instance
 	var strat interface {
 		Execute(context.Context) error
@@ -166,8 +255,16 @@ func main() {
 		strat = strategy.NewRiseFallStrategy(api, config)
 	case "differs":
 		strat = strategy.NewDigitDiffersStrategy(api, config)
+	case "over_under":
+		strat = strategy.NewDigitOverUnderStrategy(api, config)
 	case "higher_lower":
 		strat = strategy.NewHigherLowerStrategy(api, config)
+	case "touch_no_touch", "ends_in_out", "stays_in_out":
+		barrierStrat, err := strategy.NewBarrierStrategy(api, config)
+		if err != nil {
+			log.Fatalf("Invalid %s configuration: %v", *stratName, err)
+		}
+		strat = barrierStrat
 	case "multiplier":
 		strat = strategy.NewMultiplierStrategy(api, config)
 	case "custom":
@@ -180,7 +277,21 @@ func main() {
 			log.Fatal("Custom strategy selected but STRATEGY_SCRIPT environment variable is empty.")
 		}
 		config.Script = scriptContent
+		// Parameter values arrive as a JSON object alongside the script
+		if raw := os.Getenv("STRATEGY_PARAMS"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &config.Params); err != nil {
+				log.Fatalf("Invalid STRATEGY_PARAMS: %v", err)
+			}
+		}
 		strat = strategy.NewCustomStrategy(api, config)
+	case "dbot":
+		// DBot XML workspaces are passed the same way as custom scripts
+		scriptContent := os.Getenv("STRATEGY_SCRIPT")
+		if scriptContent == "" {
+			log.Fatal("DBot strategy selected but STRATEGY_SCRIPT environment variable is empty.")
+		}
+		config.Script = scriptContent
+		strat = strategy.NewDBotStrategy(api, config)
 	}
 
 	// Context and Signal Handling
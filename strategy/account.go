@@ -0,0 +1,39 @@
+package strategy
+
+import (
+	"fmt"
+
+	"github.com/ksysoev/deriv-api"
+	"github.com/ksysoev/deriv-api/schema"
+)
+
+// Account is the Deriv account an API token trades on.
+type Account struct {
+	LoginID   string  `json:"login_id"`
+	Currency  string  `json:"currency"`
+	Balance   float64 `json:"balance"`
+	IsVirtual bool    `json:"is_virtual"`
+}
+
+// AuthorizeAccount authorizes the connection with token and returns the
+// account it opened.
+func AuthorizeAccount(api *deriv.DerivAPI, token string) (Account, error) {
+	resp, err := api.Authorize(schema.Authorize{Authorize: token})
+	if err != nil {
+		return Account{}, err
+	}
+	auth := resp.Authorize
+	if auth == nil || auth.Loginid == nil {
+		return Account{}, fmt.Errorf("authorize returned no account")
+	}
+
+	account := Account{LoginID: *auth.Loginid}
+	if auth.Currency != nil {
+		account.Currency = *auth.Currency
+	}
+	if auth.Balance != nil {
+		account.Balance = *auth.Balance
+	}
+	account.IsVirtual = auth.IsVirtual != nil && *auth.IsVirtual == 1
+	return account, nil
+}
@@ -0,0 +1,380 @@
+package strategy
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"deriv_trade/database"
+)
+
+// backtestPayouts approximates the profit ratio of a winning contract for
+// each built-in strategy when the caller does not supply one.
+var backtestPayouts = map[string]float64{
+	"even_odd":     0.95,
+	"rise_fall":    0.95,
+	"higher_lower": 0.95,
+	"differs":      0.095,
+}
+
+// BacktestStrategies lists the strategies Backtest can replay.
+var BacktestStrategies = []string{"even_odd", "rise_fall", "higher_lower", "differs"}
+
+// BacktestTrade is one simulated contract.
+type BacktestTrade struct {
+	Tick         int     `json:"tick"`
+	Epoch        int64   `json:"epoch"`
+	ContractType string  `json:"contract_type"`
+	Stake        float64 `json:"stake"`
+	EntryQuote   float64 `json:"entry_quote"`
+	ExitQuote    float64 `json:"exit_quote"`
+	Profit       float64 `json:"profit"`
+	Status       string  `json:"status"` // "won" or "lost"
+}
+
+// BacktestResult is the outcome of replaying a strategy over recorded ticks.
+type BacktestResult struct {
+	Summary    database.BacktestSummary `json:"summary"`
+	StopReason string                   `json:"stop_reason,omitempty"` // empty when the ticks ran out first
+	Trades     []BacktestTrade          `json:"trades"`
+}
+
+// backtestOrder is an entry signal produced by a strategy's rules.
+type backtestOrder struct {
+	contractType string
+	barrier      float64 // offset from the entry quote (higher_lower)
+	prediction   int     // digit (differs)
+}
+
+// backtestSignal is a built-in strategy's entry rules. next feeds it one
+// quote and returns the order it signals, if any, without side effects;
+// entered resets its state once the order was placed, as the live loops do
+// after a successful entry.
+type backtestSignal struct {
+	next    func(quote float64, pipSize int) *backtestOrder
+	entered func()
+}
+
+// openTrade is a simulated contract waiting for its exit tick.
+type openTrade struct {
+	order      backtestOrder
+	ticket     orderTicket
+	trade      BacktestTrade
+	entryQuote float64
+	exitIndex  int
+}
+
+// Backtest replays a built-in strategy's entry rules over recorded ticks
+// and sizes and stops the session with the same rules as handleTradeResult.
+// Entries are gated like the live bot's: at most Config.MaxOpenPositions
+// contracts (default 1) at a time, spaced by Config.MinEntryTicks ticks and
+// Config.MinEntrySeconds of tick time, each staked at the stake left by the
+// settlements before it.
+//
+// A signal on tick i buys at the next tick. Digit contracts settle on the
+// last digit of tick i+Duration; rise/fall and higher/lower compare the
+// quote Duration ticks after the entry tick against the entry. Second,
+// minute and hour durations settle on the first tick at or after the
+// expiry time. A winning contract pays stake*payout; payout <= 0 uses the
+// strategy's typical payout. Contracts still open when the ticks run out
+// are left out of the summary.
+func Backtest(config Config, ticks []database.Tick, payout float64) (*BacktestResult, error) {
+	signal, err := newBacktestSignal(config)
+	if err != nil {
+		return nil, err
+	}
+	if payout <= 0 {
+		payout = backtestPayouts[config.StrategyName]
+	}
+	expiry, err := durationSeconds(config)
+	if err != nil {
+		return nil, err
+	}
+	duration := config.Duration
+	if duration <= 0 {
+		duration = 1
+	}
+	if digitBacktests[config.StrategyName] {
+		for _, tick := range ticks {
+			if tick.PipSize <= 0 {
+				return nil, fmt.Errorf("ticks of %s have no pip size, so their last digits cannot be told", config.Symbol)
+			}
+		}
+	}
+
+	result := &BacktestResult{Trades: []BacktestTrade{}}
+	// Entries and settlements go through the live bot's order manager, so
+	// positions are capped and spaced, and stakes follow settlements, just
+	// as when trading. Its clock is the epoch of the tick being replayed.
+	var epoch int64
+	settled := map[uint64]BacktestTrade{}
+	orders := newOrderManager(config, func(_ context.Context, st settlement) {
+		trade := settled[st.ticket.seq]
+		delete(settled, st.ticket.seq)
+		if result.StopReason != "" {
+			return // settled after the session stopped
+		}
+		result.Trades = append(result.Trades, trade)
+		result.StopReason = st.reason
+	})
+	orders.now = func() time.Time { return time.Unix(epoch, 0) }
+	ctx := context.Background()
+	var open []openTrade
+
+	for i, tick := range ticks {
+		epoch = tick.Epoch
+		orders.tick()
+
+		// Settle contracts expiring on this tick before the strategy sees it
+		var still []openTrade
+		for _, t := range open {
+			if t.exitIndex > i {
+				still = append(still, t)
+				continue
+			}
+			trade := settleBacktest(t, tick, payout)
+			settled[t.ticket.seq] = trade
+			orders.settle(ctx, t.ticket, database.Trade{Profit: trade.Profit})
+		}
+		open = still
+		if result.StopReason != "" {
+			break
+		}
+
+		order := signal.next(tick.Quote, tick.PipSize)
+		if order == nil {
+			continue
+		}
+
+		digit := strings.HasPrefix(order.contractType, "DIGIT")
+		entry := i + 1
+		if entry >= len(ticks) {
+			break
+		}
+		var exitIndex int
+		switch {
+		case expiry > 0:
+			exitIndex = indexAtOrAfter(ticks, entry, ticks[entry].Epoch+expiry)
+		case digit:
+			exitIndex = i + duration
+		default:
+			exitIndex = entry + duration
+		}
+		if exitIndex >= len(ticks) {
+			continue // would settle after the recorded ticks end
+		}
+
+		// The live bot skips signals while positions are full or the last
+		// entry is too recent
+		ticket, err := orders.enter()
+		if err != nil {
+			continue
+		}
+		signal.entered()
+		open = append(open, openTrade{
+			order:  *order,
+			ticket: ticket,
+			trade: BacktestTrade{
+				Tick:         i,
+				Epoch:        tick.Epoch,
+				ContractType: order.contractType,
+				Stake:        ticket.stake,
+			},
+			entryQuote: ticks[entry].Quote,
+			exitIndex:  exitIndex,
+		})
+	}
+
+	result.Summary = summarizeTrades(result.Trades)
+	result.Summary.Symbol = config.Symbol
+	result.Summary.Ticks = len(ticks)
+	if len(ticks) > 0 {
+		result.Summary.From = time.Unix(ticks[0].Epoch, 0).UTC()
+		result.Summary.To = time.Unix(ticks[len(ticks)-1].Epoch, 0).UTC()
+	}
+	return result, nil
+}
+
+// digitBacktests are the strategies that trade on last digits and so need
+// the pip size of every tick.
+var digitBacktests = map[string]bool{"even_odd": true, "differs": true}
+
+// newBacktestSignal returns the entry rules of a built-in strategy,
+// mirroring the live Execute loops.
+func newBacktestSignal(config Config) (backtestSignal, error) {
+	switch config.StrategyName {
+	case "even_odd":
+		evenStreak, oddStreak := 0, 0
+		next := func(quote float64, pipSize int) *backtestOrder {
+			if LastDigit(quote, pipSize)%2 == 0 {
+				evenStreak++
+				oddStreak = 0
+			} else {
+				oddStreak++
+				evenStreak = 0
+			}
+			if evenStreak >= config.StreakThreshold {
+				return &backtestOrder{contractType: "DIGITODD"}
+			} else if oddStreak >= config.StreakThreshold {
+				return &backtestOrder{contractType: "DIGITEVEN"}
+			}
+			return nil
+		}
+		// Streaks are kept while entries are held back
+		return backtestSignal{next: next, entered: func() { evenStreak, oddStreak = 0, 0 }}, nil
+
+	case "rise_fall", "higher_lower":
+		barrier := 0.0
+		if config.StrategyName == "higher_lower" {
+			b, err := strconv.ParseFloat(strings.TrimLeft(config.Barrier, "+-"), 64)
+			if err != nil {
+				return backtestSignal{}, fmt.Errorf("higher_lower needs a numeric barrier, got %q", config.Barrier)
+			}
+			barrier = b
+		}
+		var quotes []float64
+		next := func(quote float64, _ int) *backtestOrder {
+			quotes = append(quotes, quote)
+			if len(quotes) > config.StreakThreshold+1 {
+				quotes = quotes[1:]
+			}
+			if len(quotes) < config.StreakThreshold+1 {
+				return nil
+			}
+			isUp, isDown := true, true
+			for i := 0; i < len(quotes)-1; i++ {
+				if quotes[i] >= quotes[i+1] {
+					isUp = false
+				}
+				if quotes[i] <= quotes[i+1] {
+					isDown = false
+				}
+			}
+			switch {
+			case isUp:
+				return &backtestOrder{contractType: "CALL", barrier: barrier}
+			case isDown:
+				return &backtestOrder{contractType: "PUT", barrier: -barrier}
+			}
+			return nil
+		}
+		return backtestSignal{next: next, entered: func() { quotes = nil }}, nil
+
+	case "differs":
+		next := func(quote float64, pipSize int) *backtestOrder {
+			prediction := LastDigit(quote, pipSize)
+			if config.Prediction >= 0 && config.Prediction <= 9 {
+				prediction = config.Prediction
+			}
+			return &backtestOrder{contractType: "DIGITDIFF", prediction: prediction}
+		}
+		return backtestSignal{next: next, entered: func() {}}, nil
+	}
+	return backtestSignal{}, fmt.Errorf("backtesting is not supported for strategy %q (supported: %s)",
+		config.StrategyName, strings.Join(BacktestStrategies, ", "))
+}
+
+// durationSeconds converts time-based durations to seconds; tick durations return 0.
+func durationSeconds(config Config) (int64, error) {
+	d := int64(config.Duration)
+	switch config.DurationUnit {
+	case "", "t":
+		return 0, nil
+	case "s":
+		return d, nil
+	case "m":
+		return d * 60, nil
+	case "h":
+		return d * 3600, nil
+	}
+	return 0, fmt.Errorf("backtesting does not support duration unit %q", config.DurationUnit)
+}
+
+// indexAtOrAfter returns the first tick from start whose epoch is >= epoch,
+// or len(ticks) when there is none.
+func indexAtOrAfter(ticks []database.Tick, start int, epoch int64) int {
+	for i := start; i < len(ticks); i++ {
+		if ticks[i].Epoch >= epoch {
+			return i
+		}
+	}
+	return len(ticks)
+}
+
+// settleBacktest decides a simulated contract against the exit tick.
+func settleBacktest(t openTrade, tick database.Tick, payout float64) BacktestTrade {
+	exit := tick.Quote
+	digit := LastDigit(exit, tick.PipSize)
+	trade := t.trade
+	trade.EntryQuote = t.entryQuote
+	trade.ExitQuote = exit
+
+	won := false
+	switch t.order.contractType {
+	case "CALL":
+		won = exit > t.entryQuote+t.order.barrier
+	case "PUT":
+		won = exit < t.entryQuote+t.order.barrier
+	case "DIGITEVEN":
+		won = digit%2 == 0
+	case "DIGITODD":
+		won = digit%2 == 1
+	case "DIGITDIFF":
+		won = digit != t.order.prediction
+	}
+
+	if won {
+		trade.Status = "won"
+		trade.Profit = math.Round(trade.Stake*payout*100) / 100
+	} else {
+		trade.Status = "lost"
+		trade.Profit = -trade.Stake
+	}
+	return trade
+}
+
+// summarizeTrades computes net PnL, profit factor, max drawdown and a
+// per-trade Sharpe ratio (mean over standard deviation of trade profits).
+func summarizeTrades(trades []BacktestTrade) database.BacktestSummary {
+	var s database.BacktestSummary
+	s.Trades = len(trades)
+
+	grossProfit, grossLoss := 0.0, 0.0
+	equity, peak := 0.0, 0.0
+	for _, t := range trades {
+		if t.Profit > 0 {
+			s.Wins++
+			grossProfit += t.Profit
+		} else {
+			s.Losses++
+			grossLoss -= t.Profit
+		}
+		equity += t.Profit
+		if equity > peak {
+			peak = equity
+		}
+		if peak-equity > s.MaxDrawdown {
+			s.MaxDrawdown = peak - equity
+		}
+	}
+
+	s.NetPnL = math.Round(equity*100) / 100
+	s.MaxDrawdown = math.Round(s.MaxDrawdown*100) / 100
+	if grossLoss > 0 {
+		s.ProfitFactor = grossProfit / grossLoss
+	} else {
+		s.ProfitFactor = grossProfit // Infinite effectively
+	}
+
+	profits := make([]float64, len(trades))
+	for i, t := range trades {
+		profits[i] = t.Profit
+	}
+	if mean, std := meanStd(profits); std > 0 {
+		s.Sharpe = mean / std
+	}
+	return s
+}
@@ -0,0 +1,63 @@
+package strategy
+
+import (
+	"reflect"
+	"testing"
+
+	"deriv_trade/database"
+)
+
+// evenTicks returns n ticks whose last digits are all even.
+func evenTicks(n int) []database.Tick {
+	ticks := make([]database.Tick, n)
+	for i := range ticks {
+		ticks[i] = database.Tick{Epoch: int64(1700000000 + i), Quote: 100 + 0.02*float64(i+1), PipSize: 2}
+	}
+	return ticks
+}
+
+func TestBacktestEntryTicks(t *testing.T) {
+	base := Config{
+		StrategyName:    "even_odd",
+		Symbol:          "R_100",
+		Duration:        1,
+		InitialStake:    1,
+		MartingaleMulti: 1,
+		StreakThreshold: 2,
+		StopLoss:        1000,
+		TargetProfit:    1000,
+	}
+	tests := []struct {
+		name   string
+		config func(*Config)
+		want   []int
+	}{
+		// The streak resets after each entry, so it takes two ticks to
+		// signal again; the signal on the last tick has no tick to buy at
+		{"ungated", func(*Config) {}, []int{1, 3, 5, 7}},
+		// A signal held back by the gates is kept, as in the live loop, and
+		// enters on the first tick the gates allow
+		{"min entry ticks", func(c *Config) { c.MinEntryTicks = 3 }, []int{1, 4, 7}},
+		{"min entry seconds", func(c *Config) { c.MinEntrySeconds = 4 }, []int{1, 5}},
+		// The contract entered on tick 1 settles on tick 4, after the
+		// signal on tick 3 is refused
+		{"max open positions", func(c *Config) { c.Duration = 3 }, []int{1, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := base
+			tt.config(&config)
+			result, err := Backtest(config, evenTicks(10), 0.9)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int
+			for _, trade := range result.Trades {
+				got = append(got, trade.Tick)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries on ticks %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
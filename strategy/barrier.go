@@ -0,0 +1,475 @@
+package strategy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"deriv_trade/database"
+
+	"github.com/ksysoev/deriv-api"
+	"github.com/ksysoev/deriv-api/schema"
+)
+
+const (
+	// barrierLookback is how many contract horizons of ticks the average
+	// range is measured over.
+	barrierLookback = 20
+	// expandRatio and contractRatio classify the latest horizon's range
+	// against the average: above expandRatio volatility is expanding, below
+	// contractRatio it is contracting, and in between nothing is traded.
+	expandRatio   = 1.25
+	contractRatio = 0.75
+	// defaultTickInterval is the assumed seconds between ticks until the
+	// live feed has shown the real spacing.
+	defaultTickInterval = 2.0
+)
+
+// BarrierStrategies maps the barrier strategy names to the contracts each
+// trades when volatility is expanding and contracting.
+var BarrierStrategies = map[string][2]schema.ProposalContractType{
+	"touch_no_touch": {schema.ProposalContractTypeONETOUCH, schema.ProposalContractTypeNOTOUCH},
+	"ends_in_out":    {schema.ProposalContractTypeEXPIRYMISS, schema.ProposalContractTypeEXPIRYRANGE},
+	"stays_in_out":   {schema.ProposalContractTypeUPORDOWN, schema.ProposalContractTypeRANGE},
+}
+
+// NeedsTwoBarriers reports whether contractType is priced between a high
+// and a low barrier.
+func NeedsTwoBarriers(contractType string) bool {
+	switch contractType {
+	case "EXPIRYRANGE", "EXPIRYMISS", "RANGE", "UPORDOWN":
+		return true
+	}
+	return false
+}
+
+// ValidateBarriers checks the barriers a contract needs: one for
+// touch/no touch and higher/lower, and a high and a low for the in/out
+// types. Relative barriers ("+0.5", "-0.5") are compared as offsets.
+func ValidateBarriers(contractType, barrier, barrier2 string) error {
+	switch contractType {
+	case "ONETOUCH", "NOTOUCH":
+		if barrier == "" {
+			return fmt.Errorf("%s needs a barrier", contractType)
+		}
+		if barrier2 != "" {
+			return fmt.Errorf("%s takes a single barrier", contractType)
+		}
+	case "EXPIRYRANGE", "EXPIRYMISS", "RANGE", "UPORDOWN":
+		if barrier == "" || barrier2 == "" {
+			return fmt.Errorf("%s needs a high and a low barrier", contractType)
+		}
+		high, err1 := strconv.ParseFloat(barrier, 64)
+		low, err2 := strconv.ParseFloat(barrier2, 64)
+		if err1 != nil || err2 != nil {
+			return fmt.Errorf("%s barriers must be numeric, got %q and %q", contractType, barrier, barrier2)
+		}
+		if high <= low {
+			return fmt.Errorf("%s high barrier %s must be above low barrier %s", contractType, barrier, barrier2)
+		}
+	}
+	return nil
+}
+
+// proposalDurationUnit maps a Config duration unit to the proposal schema.
+func proposalDurationUnit(unit string) schema.ProposalDurationUnit {
+	switch unit {
+	case "s":
+		return schema.ProposalDurationUnitS
+	case "m":
+		return schema.ProposalDurationUnitM
+	case "h":
+		return schema.ProposalDurationUnitH
+	case "d":
+		return schema.ProposalDurationUnitD
+	}
+	return schema.ProposalDurationUnitT
+}
+
+// barrierProposal builds a stake-based proposal for a barrier contract.
+// barrier2 is only sent when set.
+func barrierProposal(config Config, contractType schema.ProposalContractType, stake float64, barrier, barrier2 string) schema.Proposal {
+	amount := stake
+	duration := config.Duration
+	basis := schema.ProposalBasisStake
+	req := schema.Proposal{
+		Proposal:     1,
+		Amount:       &amount,
+		Basis:        &basis,
+		ContractType: contractType,
+		Currency:     "USD",
+		Duration:     &duration,
+		DurationUnit: proposalDurationUnit(config.DurationUnit),
+		Symbol:       config.Symbol,
+		Barrier:      &barrier,
+	}
+	if barrier2 != "" {
+		req.Barrier2 = &barrier2
+	}
+	return req
+}
+
+// tickRange is the high-low range of quotes.
+func tickRange(quotes []float64) float64 {
+	if len(quotes) == 0 {
+		return 0
+	}
+	lo, hi := quotes[0], quotes[0]
+	for _, q := range quotes[1:] {
+		lo = math.Min(lo, q)
+		hi = math.Max(hi, q)
+	}
+	return hi - lo
+}
+
+// meanTickRange averages the range of every run of n+1 consecutive quotes,
+// i.e. how far the price typically travels over n ticks.
+func meanTickRange(quotes []float64, n int) float64 {
+	if n < 1 || len(quotes) < n+1 {
+		return 0
+	}
+	sum := 0.0
+	windows := len(quotes) - n
+	for i := 0; i < windows; i++ {
+		sum += tickRange(quotes[i : i+n+1])
+	}
+	return sum / float64(windows)
+}
+
+// formatOffset renders a relative barrier at the symbol's precision, e.g.
+// "+0.52". It returns "" when the offset rounds to zero.
+func formatOffset(offset float64, pipSize int) string {
+	var s string
+	if pipSize > 0 {
+		s = strconv.FormatFloat(math.Abs(offset), 'f', pipSize, 64)
+	} else {
+		s = strconv.FormatFloat(math.Abs(offset), 'f', -1, 64)
+	}
+	if v, _ := strconv.ParseFloat(s, 64); v == 0 {
+		return ""
+	}
+	if offset < 0 {
+		return "-" + s
+	}
+	return "+" + s
+}
+
+// BarrierStrategy trades touch/no touch or ends/stays in/out contracts,
+// choosing between the pair by whether the latest contract horizon's tick
+// range is expanding or contracting against its recent average. Barriers
+// sit the average range away from the spot unless Config.Barrier fixes the
+// offset. Touch contracts follow the StreakThreshold trend: ONETOUCH in its
+// direction when volatility expands, NOTOUCH against it when it contracts.
+type BarrierStrategy struct {
+	api       *deriv.DerivAPI
+	config    Config
+	expanding schema.ProposalContractType
+	quiet     schema.ProposalContractType
+
+	orders *orderManager
+
+	mu      sync.Mutex
+	balance float64
+}
+
+// NewBarrierStrategy creates the strategy named by config.StrategyName,
+// one of the BarrierStrategies keys.
+func NewBarrierStrategy(api *deriv.DerivAPI, config Config) (*BarrierStrategy, error) {
+	pair, ok := BarrierStrategies[config.StrategyName]
+	if !ok {
+		return nil, fmt.Errorf("unknown barrier strategy %q", config.StrategyName)
+	}
+	if config.Barrier != "" {
+		if _, err := strconv.ParseFloat(strings.TrimLeft(config.Barrier, "+-"), 64); err != nil {
+			return nil, fmt.Errorf("barrier must be a numeric offset, got %q", config.Barrier)
+		}
+	}
+	s := &BarrierStrategy{
+		api:       api,
+		config:    config,
+		expanding: pair[0],
+		quiet:     pair[1],
+	}
+	s.orders = newOrderManager(config, s.handleSettlement)
+	return s, nil
+}
+
+// horizonTicks is the contract duration in ticks, converting time units
+// with the observed tick interval. Long durations are capped so the
+// lookback fits in one page of tick history.
+func (s *BarrierStrategy) horizonTicks(interval float64) int {
+	seconds, err := durationSeconds(s.config)
+	if err != nil && s.config.DurationUnit == "d" {
+		seconds, err = int64(s.config.Duration)*86400, nil
+	}
+	n := s.config.Duration
+	if err == nil && seconds > 0 {
+		n = int(math.Round(float64(seconds) / interval))
+	}
+	if n < 1 {
+		n = 1
+	}
+	if limit := (maxHistoryPage - 1) / barrierLookback; n > limit {
+		n = limit
+	}
+	return n
+}
+
+func (s *BarrierStrategy) Execute(ctx context.Context) error {
+	log.Printf("Starting %s Barrier Strategy for %s...", s.config.StrategyName, s.config.Symbol)
+
+	// 1. Authorize
+	if err := s.authorize(); err != nil {
+		return fmt.Errorf("authorization failed: %w", err)
+	}
+
+	// 2. Monitor Balance
+	go s.monitorBalance(ctx)
+
+	// 3. Seed the range history; at least the lookback is replayed so the
+	// first signal does not wait for it to fill
+	interval := defaultTickInterval
+	horizon := s.horizonTicks(interval)
+	keep := func() int {
+		n := barrierLookback*horizon + 1
+		if n < s.config.StreakThreshold+1 {
+			n = s.config.StreakThreshold + 1
+		}
+		return n
+	}
+	var quotes []float64
+	push := func(quote float64) {
+		quotes = append(quotes, quote)
+		if over := len(quotes) - keep(); over > 0 {
+			quotes = quotes[over:]
+		}
+	}
+	seed := s.config
+	if seed.WarmupTicks < keep() {
+		seed.WarmupTicks = keep()
+	}
+	digits := DigitStatsFor(s.config.Symbol)
+	warmUp(s.api, seed, push)
+
+	// 4. Subscribe to Ticks
+	reqTicks := schema.Ticks{Ticks: s.config.Symbol}
+	_, tickSub, err := s.api.SubscribeTicks(reqTicks)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to ticks: %w", err)
+	}
+	defer tickSub.Forget()
+
+	lastEpoch := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case tick, ok := <-tickSub.Stream:
+			if !ok {
+				return fmt.Errorf("tick stream closed")
+			}
+
+			quote := *tick.Tick.Quote
+			digits.Add(quote, int(tick.Tick.PipSize))
+			if tick.Tick.Epoch != nil {
+				if lastEpoch > 0 && *tick.Tick.Epoch > lastEpoch {
+					// Smooth the spacing so one late tick does not resize the horizon
+					interval = 0.9*interval + 0.1*float64(*tick.Tick.Epoch-lastEpoch)
+					horizon = s.horizonTicks(interval)
+				}
+				lastEpoch = *tick.Tick.Epoch
+			}
+			push(quote)
+			s.orders.tick()
+			if s.orders.ready() != nil || len(quotes) < keep() {
+				continue
+			}
+
+			mean := meanTickRange(quotes, horizon)
+			recent := tickRange(quotes[len(quotes)-horizon-1:])
+			if mean == 0 {
+				continue
+			}
+			ratio := recent / mean
+			log.Printf("Quote: %.4f | Range over %d ticks: %.4f (avg %.4f, x%.2f)", quote, horizon, recent, mean, ratio)
+
+			var contractType schema.ProposalContractType
+			var regime string
+			switch {
+			case ratio >= expandRatio:
+				contractType, regime = s.expanding, "expanding"
+			case ratio <= contractRatio:
+				contractType, regime = s.quiet, "contracting"
+			default:
+				continue
+			}
+
+			offset := mean
+			if NeedsTwoBarriers(string(contractType)) {
+				offset = mean / 2
+			}
+			if s.config.Barrier != "" {
+				offset, _ = strconv.ParseFloat(strings.TrimLeft(s.config.Barrier, "+-"), 64)
+			}
+
+			var barrier, barrier2 string
+			if NeedsTwoBarriers(string(contractType)) {
+				barrier = formatOffset(offset, digits.PipSize())
+				barrier2 = formatOffset(-offset, digits.PipSize())
+			} else {
+				trend := quotes[len(quotes)-s.config.StreakThreshold-1:]
+				direction := trendDirection(trend)
+				if direction == 0 {
+					continue
+				}
+				if contractType == schema.ProposalContractTypeNOTOUCH {
+					direction = -direction
+				}
+				barrier = formatOffset(float64(direction)*offset, digits.PipSize())
+			}
+			if barrier == "" {
+				continue
+			}
+
+			log.Printf("Volatility %s. Buying %s (barrier %s %s)...", regime, contractType, barrier, barrier2)
+			ticket, err := s.orders.enter()
+			if err != nil {
+				log.Printf("Trade skipped: %v", err)
+				continue
+			}
+			go s.placeTrade(ctx, contractType, ticket, barrier, barrier2)
+		}
+	}
+}
+
+// trendDirection is 1 when quotes rise on every tick, -1 when they fall on
+// every tick and 0 otherwise.
+func trendDirection(quotes []float64) int {
+	isUp, isDown := true, true
+	for i := 0; i < len(quotes)-1; i++ {
+		if quotes[i] >= quotes[i+1] {
+			isUp = false
+		}
+		if quotes[i] <= quotes[i+1] {
+			isDown = false
+		}
+	}
+	switch {
+	case isUp:
+		return 1
+	case isDown:
+		return -1
+	}
+	return 0
+}
+
+func (s *BarrierStrategy) authorize() error {
+	reqAuth := schema.Authorize{Authorize: s.config.ApiToken}
+	_, err := s.api.Authorize(reqAuth)
+	return err
+}
+
+func (s *BarrierStrategy) monitorBalance(ctx context.Context) {
+	sub := schema.BalanceSubscribe(1)
+	req := schema.Balance{Subscribe: &sub}
+	_, balanceSub, err := s.api.SubscribeBalance(req)
+	if err != nil {
+		log.Printf("Failed to subscribe to balance: %v", err)
+		return
+	}
+	defer balanceSub.Forget()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case b, ok := <-balanceSub.Stream:
+			if !ok {
+				return
+			}
+			s.mu.Lock()
+			s.balance = b.Balance.Balance
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *BarrierStrategy) placeTrade(ctx context.Context, contractType schema.ProposalContractType, ticket orderTicket, barrier, barrier2 string) {
+	stake := ticket.stake
+	if err := ValidateBarriers(string(contractType), barrier, barrier2); err != nil {
+		log.Printf("Invalid barriers: %v", err)
+		s.orders.release(ctx, ticket)
+		return
+	}
+
+	propResp, err := s.api.Proposal(barrierProposal(s.config, contractType, stake, barrier, barrier2))
+	if err != nil {
+		log.Printf("Proposal error: %v", err)
+		s.orders.release(ctx, ticket)
+		return
+	}
+
+	buyReq := schema.Buy{
+		Buy:   propResp.Proposal.Id,
+		Price: stake,
+	}
+
+	buyResp, buySub, err := s.api.SubscribeBuy(buyReq)
+	if err != nil {
+		log.Printf("Buy error: %v", err)
+		s.orders.release(ctx, ticket)
+		return
+	}
+	defer buySub.Forget()
+	exit := newEarlyExit(s.api, s.config, buyResp.Buy.ContractId)
+	logContractOpened(buyResp.Buy.ContractId)
+
+	barriers := barrier
+	if barrier2 != "" {
+		barriers += "," + barrier2
+	}
+	log.Printf("Trade placed (%s %s). Stake: %.2f.", contractType, barriers, stake)
+
+	for contract := range buySub.Stream {
+		if *contract.ProposalOpenContract.IsSold == 1 {
+			profit := *contract.ProposalOpenContract.Profit
+			status := fmt.Sprintf("%v", contract.ProposalOpenContract.Status.Value)
+			s.handleTradeResult(ctx, ticket, string(contractType), barriers, profit, status, exit)
+			return
+		}
+		exit.observe(contract.ProposalOpenContract)
+	}
+	// The stream ended without a settlement
+	s.orders.release(ctx, ticket)
+}
+
+func (s *BarrierStrategy) handleTradeResult(ctx context.Context, ticket orderTicket, contractType, barriers string, profit float64, status string, exit *earlyExit) {
+	trade := database.Trade{
+		Strategy:     s.config.StrategyName,
+		Symbol:       s.config.Symbol,
+		ContractType: contractType,
+		Profit:       profit,
+		Status:       status,
+		Duration:     s.config.Duration,
+		DurationUnit: s.config.DurationUnit,
+		Barrier:      barriers,
+	}
+	exit.annotate(&trade)
+	s.orders.settle(ctx, ticket, trade)
+}
+
+// handleSettlement logs a settlement in entry order and stops the bot when
+// it ended the session.
+func (s *BarrierStrategy) handleSettlement(ctx context.Context, st settlement) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	log.Printf("Result: %s | Profit: %.2f | Total PnL: %.2f | Balance: %.2f", st.trade.Status, st.trade.Profit, st.totalProfit, s.balance)
+	saveSettlement(ctx, s.config, st, s.balance)
+	stopOnReason(s.config, st)
+	log.Printf("Next Stake: %.2f", st.nextStake)
+}
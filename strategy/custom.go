@@ -2,9 +2,12 @@ package strategy
 
 import (
 	"context"
+	"crypto/sha256"
 	"deriv_trade/database"
+	"encoding/hex"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/dop251/goja"
@@ -16,6 +19,10 @@ type CustomStrategy struct {
 	api    *deriv.DerivAPI
 	config Config
 	vm     *goja.Runtime
+	vmMu   sync.Mutex // goja runtimes are not safe for concurrent use
+	orders *orderManager
+
+	warmingUp bool // buy() is a no-op while history is replayed
 }
 
 func NewCustomStrategy(api *deriv.DerivAPI, config Config) *CustomStrategy {
@@ -23,6 +30,7 @@ func NewCustomStrategy(api *deriv.DerivAPI, config Config) *CustomStrategy {
 		api:    api,
 		config: config,
 		vm:     goja.New(),
+		orders: newOrderManager(config, nil),
 	}
 }
 
@@ -34,13 +42,23 @@ func (s *CustomStrategy) Execute(ctx context.Context) error {
 		return fmt.Errorf("authorization failed: %w", err)
 	}
 
-	// 2. Setup JS Environment
+	// 2. Resolve declared parameters against the configured values
+	params, err := ResolveScriptParams(s.config.Script, s.config.Params)
+	if err != nil {
+		return fmt.Errorf("invalid strategy parameters: %w", err)
+	}
+	s.config.Params = params
+	if len(params) > 0 {
+		log.Printf("Strategy parameters: %v", params)
+	}
+
+	// 3. Setup JS Environment
 	if err := s.setupEnvironment(ctx); err != nil {
 		return fmt.Errorf("failed to setup JS environment: %w", err)
 	}
 
-	// 3. Run the User Script
-	_, err := s.vm.RunString(s.config.Script)
+	// 4. Run the User Script
+	_, err = s.vm.RunString(s.config.Script)
 	if err != nil {
 		return fmt.Errorf("JS execution error: %w", err)
 	}
@@ -51,7 +69,16 @@ func (s *CustomStrategy) Execute(ctx context.Context) error {
 		log.Printf("Warning: onTick function not found or invalid signature. Strategy might not react to ticks.")
 	}
 
-	// 4. Subscribe to Ticks
+	// 5. Warm up the script with recent history (trades suppressed)
+	if onTick != nil {
+		s.warmingUp = true
+		warmUp(s.api, s.config, func(quote float64) {
+			s.callOnTick(onTick, quote)
+		})
+		s.warmingUp = false
+	}
+
+	// 6. Subscribe to Ticks
 	reqTicks := schema.Ticks{Ticks: s.config.Symbol}
 	_, tickSub, err := s.api.SubscribeTicks(reqTicks)
 	if err != nil {
@@ -68,22 +95,66 @@ func (s *CustomStrategy) Execute(ctx context.Context) error {
 				return fmt.Errorf("tick stream closed")
 			}
 			quote := *tick.Tick.Quote
+			DigitStatsFor(s.config.Symbol).Add(quote, int(tick.Tick.PipSize))
+			s.orders.tick()
 			// Call onTick
 			if onTick != nil {
-				// Execute safely
-				func() {
-					defer func() {
-						if r := recover(); r != nil {
-							log.Printf("JS Runtime panic: %v", r)
-						}
-					}()
-					onTick(quote)
-				}()
+				s.callOnTick(onTick, quote)
 			}
 		}
 	}
 }
 
+// callOnTick executes the script's onTick handler, recovering from JS panics.
+func (s *CustomStrategy) callOnTick(onTick func(float64), quote float64) {
+	s.vmMu.Lock()
+	defer s.vmMu.Unlock()
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("JS Runtime panic: %v", r)
+		}
+	}()
+	onTick(quote)
+}
+
+// notifyResult calls the script's optional onTradeResult(result) handler once a
+// contract settles, fails to open (status "error") or is held back by the
+// position limits (status "skipped"). exit, nil unless the contract opened,
+// adds its early exit and failed sells.
+func (s *CustomStrategy) notifyResult(contractType string, prediction int, stake, profit float64, status string, exit *earlyExit) {
+	s.vmMu.Lock()
+	defer s.vmMu.Unlock()
+
+	onTradeResult, ok := goja.AssertFunction(s.vm.Get("onTradeResult"))
+	if !ok {
+		return
+	}
+	result := map[string]interface{}{
+		"contract_type": contractType,
+		"stake":         stake,
+		"profit":        profit,
+		"status":        status,
+	}
+	if NeedsPrediction(contractType) {
+		result["prediction"] = prediction
+	}
+	if exit != nil {
+		var trade database.Trade
+		exit.annotate(&trade)
+		if trade.ExitReason != "" {
+			result["exit_reason"] = trade.ExitReason
+			result["exit_slippage"] = trade.ExitSlippage
+		}
+		if trade.SellFailures > 0 {
+			result["sell_failures"] = trade.SellFailures
+			result["sell_error"] = trade.SellError
+		}
+	}
+	if _, err := onTradeResult(goja.Undefined(), s.vm.ToValue(result)); err != nil {
+		log.Printf("JS onTradeResult error: %v", err)
+	}
+}
+
 func (s *CustomStrategy) authorize() error {
 	reqAuth := schema.Authorize{Authorize: s.config.ApiToken}
 	_, err := s.api.Authorize(reqAuth)
@@ -91,43 +162,103 @@ func (s *CustomStrategy) authorize() error {
 }
 
 func (s *CustomStrategy) setupEnvironment(ctx context.Context) error {
+	bindScriptGlobals(s.vm, s.config, DigitStatsFor(s.config.Symbol),
+		func(contractType string, amount float64, prediction int) {
+			if s.warmingUp {
+				return
+			}
+			// Scripts choose their own stakes, so the order manager only
+			// limits how many contracts are open and how often they start
+			ticket, err := s.orders.enter()
+			if err != nil {
+				log.Printf("buy() skipped: %v", err)
+				go s.notifyResult(contractType, prediction, amount, 0, "skipped", nil)
+				return
+			}
+			go s.placeTrade(ctx, contractType, amount, prediction, ticket)
+		},
+		func(msg interface{}) { log.Printf("[JS] %v", msg) },
+		func() bool { return s.warmingUp },
+	)
+	return nil
+}
+
+// bindScriptGlobals installs the strategy script API. The live strategy and
+// the dry-run checker share it so scripts see the same globals in both.
+//
+// buy(contractType, amount[, prediction]) passes -1 when no prediction is
+// given; digit contracts check it when the trade is placed.
+func bindScriptGlobals(vm *goja.Runtime, config Config, digits *DigitStats, buy func(string, float64, int), logFn func(interface{}), warmingUp func() bool) {
 	// Console Log
-	s.vm.Set("log", func(msg interface{}) {
-		log.Printf("[JS] %v", msg)
-	})
+	vm.Set("log", logFn)
 
 	// Buy Function
-	s.vm.Set("buy", func(contractType string, amount float64) {
-		go s.placeTrade(ctx, contractType, amount)
+	vm.Set("buy", func(call goja.FunctionCall) goja.Value {
+		prediction := -1
+		if p := call.Argument(2); !goja.IsUndefined(p) && !goja.IsNull(p) {
+			prediction = int(p.ToInteger())
+		}
+		buy(call.Argument(0).String(), call.Argument(1).ToFloat(), prediction)
+		return goja.Undefined()
 	})
 
 	// Helpers
-	s.vm.Set("getInitialStake", func() float64 { return s.config.InitialStake })
-	s.vm.Set("getSymbol", func() string { return s.config.Symbol })
+	vm.Set("getInitialStake", func() float64 { return config.InitialStake })
+	vm.Set("getSymbol", func() string { return config.Symbol })
+	vm.Set("isWarmingUp", warmingUp)
 
-	return nil
+	// Rolling last-digit statistics for the symbol: digitStats(window)
+	vm.Set("digitStats", func(window int) map[string]interface{} {
+		return digits.Snapshot(window).toMap()
+	})
+
+	// Parameter values, and the object scripts declare their schema on
+	params := config.Params
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	vm.Set("params", params)
+	vm.Set("exports", vm.NewObject())
+}
+
+// ScriptHash identifies a script version by the SHA-256 of its content.
+func ScriptHash(script string) string {
+	sum := sha256.Sum256([]byte(script))
+	return hex.EncodeToString(sum[:])
+}
+
+// scriptContractTypes maps the contract types accepted by buy() to proposal types.
+var scriptContractTypes = map[string]schema.ProposalContractType{
+	"CALL":       schema.ProposalContractTypeCALL,
+	"PUT":        schema.ProposalContractTypePUT,
+	"DIGITODD":   schema.ProposalContractTypeDIGITODD,
+	"DIGITEVEN":  schema.ProposalContractTypeDIGITEVEN,
+	"DIGITMATCH": schema.ProposalContractTypeDIGITMATCH,
+	"DIGITDIFF":  schema.ProposalContractTypeDIGITDIFF,
+	"DIGITOVER":  schema.ProposalContractTypeDIGITOVER,
+	"DIGITUNDER": schema.ProposalContractTypeDIGITUNDER,
 }
 
-func (s *CustomStrategy) placeTrade(ctx context.Context, contractTypeStr string, stake float64) {
+func (s *CustomStrategy) placeTrade(ctx context.Context, contractTypeStr string, stake float64, prediction int, ticket orderTicket) {
+	defer s.orders.release(ctx, ticket)
+
 	// Limit stake check?
 	if stake <= 0 {
 		log.Printf("Invalid stake: %.2f", stake)
+		s.notifyResult(contractTypeStr, prediction, stake, 0, "error", nil)
 		return
 	}
 
 	// Map string to Contract type
-	var contractType schema.ProposalContractType
-	switch contractTypeStr {
-	case "CALL":
-		contractType = schema.ProposalContractTypeCALL
-	case "PUT":
-		contractType = schema.ProposalContractTypePUT
-	case "DIGITODD":
-		contractType = schema.ProposalContractTypeDIGITODD
-	case "DIGITEVEN":
-		contractType = schema.ProposalContractTypeDIGITEVEN
-	default:
+	contractType, ok := scriptContractTypes[contractTypeStr]
+	if !ok {
 		log.Printf("Unknown contract type in script: %s", contractTypeStr)
+		s.notifyResult(contractTypeStr, prediction, stake, 0, "error", nil)
+		return
+	}
+	if err := ValidateDigitPrediction(contractTypeStr, prediction); err != nil {
+		log.Printf("Invalid buy() in script: %v", err)
+		s.notifyResult(contractTypeStr, prediction, stake, 0, "error", nil)
 		return
 	}
 
@@ -146,10 +277,15 @@ func (s *CustomStrategy) placeTrade(ctx context.Context, contractTypeStr string,
 		DurationUnit: schema.ProposalDurationUnitT,
 		Symbol:       s.config.Symbol,
 	}
+	if NeedsPrediction(contractTypeStr) {
+		barrier := fmt.Sprintf("%d", prediction)
+		reqProp.Barrier = &barrier
+	}
 
 	propResp, err := s.api.Proposal(reqProp)
 	if err != nil {
 		log.Printf("Proposal error: %v", err)
+		s.notifyResult(contractTypeStr, prediction, stake, 0, "error", nil)
 		return
 	}
 
@@ -158,12 +294,15 @@ func (s *CustomStrategy) placeTrade(ctx context.Context, contractTypeStr string,
 		Price: amount,
 	}
 
-	_, buySub, err := s.api.SubscribeBuy(buyReq)
+	buyResp, buySub, err := s.api.SubscribeBuy(buyReq)
 	if err != nil {
 		log.Printf("Buy error: %v", err)
+		s.notifyResult(contractTypeStr, prediction, stake, 0, "error", nil)
 		return
 	}
 	defer buySub.Forget()
+	exit := newEarlyExit(s.api, s.config, buyResp.Buy.ContractId)
+	logContractOpened(buyResp.Buy.ContractId)
 
 	log.Printf("Trade placed [Custom]. Stake: %.2f. Type: %s", amount, contractTypeStr)
 
@@ -174,13 +313,18 @@ func (s *CustomStrategy) placeTrade(ctx context.Context, contractTypeStr string,
 			status := fmt.Sprintf("%v", statusRaw)
 
 			log.Printf("Trade Result: %s | Profit: %.2f", status, profit)
-			s.saveTrade(ctx, contractTypeStr, stake, profit, status)
+			s.saveTrade(ctx, contractTypeStr, prediction, stake, profit, status, exit)
+			s.notifyResult(contractTypeStr, prediction, stake, profit, status, exit)
 			return
 		}
+		exit.observe(contract.ProposalOpenContract)
 	}
+	// The stream ended without a settlement; let the script trade again
+	log.Printf("Contract %d stream closed before settlement", buyResp.Buy.ContractId)
+	s.notifyResult(contractTypeStr, prediction, stake, 0, "error", exit)
 }
 
-func (s *CustomStrategy) saveTrade(ctx context.Context, contractType string, stake, profit float64, status string) {
+func (s *CustomStrategy) saveTrade(ctx context.Context, contractType string, prediction int, stake, profit float64, status string, exit *earlyExit) {
 	if s.config.DB != nil {
 		trade := &database.Trade{
 			Strategy:     "custom",
@@ -194,6 +338,11 @@ func (s *CustomStrategy) saveTrade(ctx context.Context, contractType string, sta
 			Duration:  s.config.Duration,
 			Timestamp: time.Now(),
 		}
+		if NeedsPrediction(contractType) {
+			trade.Prediction = prediction
+		}
+		trade.LoginID = s.config.LoginID
+		exit.annotate(trade)
 		if err := s.config.DB.InsertTrade(ctx, trade); err != nil {
 			log.Printf("Failed to save trade: %v", err)
 		}
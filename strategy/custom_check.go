@@ -0,0 +1,272 @@
+package strategy
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja/parser"
+)
+
+const (
+	// dryRunTicks is the length of the synthetic tick sequence used by CheckScript.
+	dryRunTicks = 100
+	// dryRunPayout approximates the profit ratio of a winning digit/rise-fall contract.
+	dryRunPayout = 0.95
+	// dryRunTimeout aborts scripts that loop forever.
+	dryRunTimeout = 2 * time.Second
+	// maxTickErrors caps the runtime errors reported from onTick.
+	maxTickErrors = 5
+	// dryRunPipSize is the precision of the synthetic quotes.
+	dryRunPipSize = 2
+)
+
+// ScriptIssue is a problem found while checking a strategy script.
+type ScriptIssue struct {
+	Severity string `json:"severity"` // "error" or "warning"
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Message  string `json:"message"`
+}
+
+// DryRunTrade is a trade the script would have placed during the dry run.
+type DryRunTrade struct {
+	Tick         int     `json:"tick"`
+	Quote        float64 `json:"quote"`
+	ContractType string  `json:"contract_type"`
+	Prediction   *int    `json:"prediction,omitempty"`
+	Stake        float64 `json:"stake"`
+	Status       string  `json:"status"`
+	Profit       float64 `json:"profit"`
+}
+
+// ScriptCheckResult is the outcome of CheckScript.
+type ScriptCheckResult struct {
+	Valid  bool          `json:"valid"`
+	Issues []ScriptIssue `json:"issues"`
+	Trades []DryRunTrade `json:"trades"`
+	Logs   []string      `json:"logs"`
+}
+
+func (r *ScriptCheckResult) add(severity string, line, column int, format string, args ...interface{}) {
+	issue := ScriptIssue{
+		Severity: severity,
+		Line:     line,
+		Column:   column,
+		Message:  fmt.Sprintf(format, args...),
+	}
+	for _, existing := range r.Issues {
+		if existing == issue {
+			return
+		}
+	}
+	r.Issues = append(r.Issues, issue)
+	if severity == "error" {
+		r.Valid = false
+	}
+}
+
+// CheckScript compiles a custom strategy script, verifies it defines onTick,
+// and runs it against a short synthetic tick sequence with a mocked buy().
+// Mocked contracts settle after config.Duration ticks and are reported back
+// through onTradeResult, so martingale-style scripts are exercised too.
+func CheckScript(script string, config Config) ScriptCheckResult {
+	result := ScriptCheckResult{Valid: true, Issues: []ScriptIssue{}, Trades: []DryRunTrade{}, Logs: []string{}}
+
+	// 1. Syntax, with every parser error and its position
+	if _, err := parser.ParseFile(nil, "strategy.js", script, 0); err != nil {
+		var list parser.ErrorList
+		if errors.As(err, &list) {
+			for _, e := range list {
+				result.add("error", e.Position.Line, e.Position.Column, "SyntaxError: %s", e.Message)
+			}
+		} else {
+			result.add("error", 0, 0, "SyntaxError: %v", err)
+		}
+		return result
+	}
+
+	// 2. Parameter schema; the dry run uses the configured values or defaults
+	params, err := ResolveScriptParams(script, config.Params)
+	if err != nil {
+		result.add("error", 0, 0, "%v", err)
+		return result
+	}
+	config.Params = params
+
+	// 3. Load the script with a mocked environment
+	vm := goja.New()
+	timer := time.AfterFunc(dryRunTimeout, func() {
+		vm.Interrupt(fmt.Sprintf("script exceeded %s", dryRunTimeout))
+	})
+	defer timer.Stop()
+
+	tick := 0
+	quote := 0.0
+	var pending []int // indexes into result.Trades awaiting settlement
+	warned := make(map[string]bool)
+	digits := NewDigitStats(config.Symbol)
+
+	bindScriptGlobals(vm, config, digits,
+		func(contractType string, amount float64, prediction int) {
+			trade := DryRunTrade{Tick: tick, Quote: quote, ContractType: contractType, Stake: amount, Status: "open"}
+			if NeedsPrediction(contractType) {
+				trade.Prediction = &prediction
+			}
+			switch {
+			case amount <= 0:
+				trade.Status = "error"
+				result.add("warning", 0, 0, "tick %d: buy(%q, %.2f) has an invalid stake", tick, contractType, amount)
+			case scriptContractTypes[contractType] == "":
+				trade.Status = "error"
+				if !warned[contractType] {
+					warned[contractType] = true
+					result.add("warning", 0, 0, "tick %d: buy() called with unsupported contract type %q", tick, contractType)
+				}
+			case ValidateDigitPrediction(contractType, prediction) != nil:
+				trade.Status = "error"
+				if !warned[contractType] {
+					warned[contractType] = true
+					result.add("warning", 0, 0, "tick %d: %v", tick, ValidateDigitPrediction(contractType, prediction))
+				}
+			}
+			result.Trades = append(result.Trades, trade)
+			pending = append(pending, len(result.Trades)-1)
+		},
+		func(msg interface{}) {
+			result.Logs = append(result.Logs, fmt.Sprintf("%v", msg))
+		},
+		func() bool { return false },
+	)
+
+	if _, err := vm.RunString(script); err != nil {
+		line, column := exceptionPosition(err)
+		result.add("error", line, column, "%v", exceptionMessage(err))
+		return result
+	}
+
+	onTick, ok := goja.AssertFunction(vm.Get("onTick"))
+	if !ok {
+		result.add("error", 0, 0, "required callback onTick(quote) is not defined")
+		return result
+	}
+	onTradeResult, hasResult := goja.AssertFunction(vm.Get("onTradeResult"))
+	if v := vm.Get("onTradeResult"); v != nil && !goja.IsUndefined(v) && !hasResult {
+		result.add("warning", 0, 0, "onTradeResult is defined but is not a function")
+	}
+
+	// 4. Run the synthetic ticks
+	duration := config.Duration
+	if duration <= 0 {
+		duration = 1
+	}
+	tickErrors := 0
+	for i, q := range syntheticTicks(dryRunTicks) {
+		tick, quote = i, q
+		digits.Add(q, dryRunPipSize)
+
+		// Settle contracts whose duration has elapsed before the script sees the tick
+		var still []int
+		for _, idx := range pending {
+			t := &result.Trades[idx]
+			if t.Status == "open" && tick-t.Tick < duration {
+				still = append(still, idx)
+				continue
+			}
+			if t.Status == "open" {
+				settleDryRun(t, q)
+			}
+			if hasResult {
+				res := map[string]interface{}{
+					"contract_type": t.ContractType,
+					"stake":         t.Stake,
+					"profit":        t.Profit,
+					"status":        t.Status,
+				}
+				if t.Prediction != nil {
+					res["prediction"] = *t.Prediction
+				}
+				if _, err := onTradeResult(goja.Undefined(), vm.ToValue(res)); err != nil && tickErrors < maxTickErrors {
+					tickErrors++
+					line, column := exceptionPosition(err)
+					result.add("error", line, column, "onTradeResult: %v", exceptionMessage(err))
+				}
+			}
+		}
+		pending = still
+
+		if _, err := onTick(goja.Undefined(), vm.ToValue(q)); err != nil {
+			if _, interrupted := err.(*goja.InterruptedError); interrupted {
+				result.add("error", 0, 0, "%v", err)
+				break
+			}
+			if tickErrors < maxTickErrors {
+				tickErrors++
+				line, column := exceptionPosition(err)
+				result.add("error", line, column, "onTick at tick %d: %v", tick, exceptionMessage(err))
+			}
+		}
+	}
+
+	if len(result.Trades) == 0 {
+		result.add("warning", 0, 0, "script placed no trades during the %d-tick dry run", dryRunTicks)
+	}
+	return result
+}
+
+// syntheticTicks returns a deterministic random walk so dry runs are repeatable.
+func syntheticTicks(n int) []float64 {
+	rng := rand.New(rand.NewSource(42))
+	quotes := make([]float64, n)
+	q := 1000.0
+	for i := range quotes {
+		q += rng.NormFloat64() * 0.5
+		quotes[i] = math.Round(q*100) / 100
+	}
+	return quotes
+}
+
+// settleDryRun decides a mocked contract against the exit quote.
+func settleDryRun(t *DryRunTrade, exit float64) {
+	won := false
+	switch t.ContractType {
+	case "CALL":
+		won = exit > t.Quote
+	case "PUT":
+		won = exit < t.Quote
+	default:
+		prediction := -1
+		if t.Prediction != nil {
+			prediction = *t.Prediction
+		}
+		won = digitWins(t.ContractType, prediction, LastDigit(exit, dryRunPipSize))
+	}
+	if won {
+		t.Status = "won"
+		t.Profit = math.Round(t.Stake*dryRunPayout*100) / 100
+	} else {
+		t.Status = "lost"
+		t.Profit = -t.Stake
+	}
+}
+
+func exceptionPosition(err error) (int, int) {
+	if ex, ok := err.(*goja.Exception); ok {
+		for _, frame := range ex.Stack() {
+			if pos := frame.Position(); pos.Line > 0 {
+				return pos.Line, pos.Column
+			}
+		}
+	}
+	return 0, 0
+}
+
+func exceptionMessage(err error) string {
+	if ex, ok := err.(*goja.Exception); ok {
+		return ex.Value().String()
+	}
+	return err.Error()
+}
@@ -0,0 +1,602 @@
+package strategy
+
+import (
+	"context"
+	"deriv_trade/database"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ksysoev/deriv-api"
+	"github.com/ksysoev/deriv-api/schema"
+)
+
+// maxDBotSteps bounds a single run of a block stack so a runaway loop
+// (e.g. controls_repeat_ext without a purchase) cannot hang the tick loop.
+const maxDBotSteps = 100000
+
+// dbotFlow tells the caller how a statement stack finished.
+type dbotFlow int
+
+const (
+	dbotFlowNormal     dbotFlow = iota
+	dbotFlowPurchase            // a purchase block ran; before_purchase ends
+	dbotFlowTradeAgain          // trade_again ran; after_purchase ends and the bot continues
+	dbotFlowStop                // controls_stop ran; the bot stops
+)
+
+// dbotPurchase is the contract requested by a purchase block.
+type dbotPurchase struct {
+	contractType string
+	stake        float64
+}
+
+// dbotInterpreter evaluates the core DBot block set against its own variable scope.
+type dbotInterpreter struct {
+	ws        *DBotWorkspace
+	tradeType string
+	vars      map[string]interface{}
+	quote     float64
+	result    string // "win" or "loss" for the last settled contract
+	steps     int
+	purchase  *dbotPurchase
+	print     func(msg string)
+}
+
+func newDBotInterpreter(ws *DBotWorkspace) *dbotInterpreter {
+	return &dbotInterpreter{
+		ws:        ws,
+		tradeType: ws.TradeDefinition().TradeType,
+		vars:      make(map[string]interface{}),
+		print:     func(msg string) { log.Printf("[DBot] %s", msg) },
+	}
+}
+
+// run executes a block stack from b, following next links.
+func (in *dbotInterpreter) run(b *DBotBlock) (dbotFlow, error) {
+	for ; b != nil; b = b.NextBlock() {
+		flow, err := in.exec(b)
+		if err != nil || flow != dbotFlowNormal {
+			return flow, err
+		}
+	}
+	return dbotFlowNormal, nil
+}
+
+// start resets the step budget and runs a root block's statement input.
+func (in *dbotInterpreter) start(root *DBotBlock, statement string) (dbotFlow, error) {
+	if root == nil {
+		return dbotFlowNormal, nil
+	}
+	in.steps = 0
+	in.purchase = nil
+	return in.run(root.Statement(statement))
+}
+
+func (in *dbotInterpreter) step() error {
+	in.steps++
+	if in.steps > maxDBotSteps {
+		return fmt.Errorf("block execution exceeded %d steps", maxDBotSteps)
+	}
+	return nil
+}
+
+func (in *dbotInterpreter) exec(b *DBotBlock) (dbotFlow, error) {
+	if err := in.step(); err != nil {
+		return dbotFlowNormal, err
+	}
+
+	switch b.Type {
+	case "purchase":
+		contractType := DBotContractType(b.Field("PURCHASE_LIST"))
+		if contractType == "" {
+			contractType = DBotContractType(in.tradeType)
+		}
+		if contractType == "" {
+			return dbotFlowNormal, fmt.Errorf("purchase: unsupported trade type %q", in.tradeType)
+		}
+		stake := 0.0
+		if bet := b.Input("BET"); bet != nil {
+			v, err := in.eval(bet)
+			if err != nil {
+				return dbotFlowNormal, err
+			}
+			stake = toNumber(v)
+		}
+		in.purchase = &dbotPurchase{contractType: contractType, stake: stake}
+		return dbotFlowPurchase, nil
+
+	case "trade_again":
+		return dbotFlowTradeAgain, nil
+
+	case "controls_stop":
+		return dbotFlowStop, nil
+
+	case "text_print":
+		v, err := in.eval(b.Input("TEXT"))
+		if err != nil {
+			return dbotFlowNormal, err
+		}
+		in.print(toText(v))
+
+	case "variables_set":
+		v, err := in.eval(b.Input("VALUE"))
+		if err != nil {
+			return dbotFlowNormal, err
+		}
+		in.vars[in.ws.varName(b)] = v
+
+	case "math_change":
+		delta, err := in.eval(b.Input("DELTA"))
+		if err != nil {
+			return dbotFlowNormal, err
+		}
+		name := in.ws.varName(b)
+		in.vars[name] = toNumber(in.vars[name]) + toNumber(delta)
+
+	case "controls_if":
+		for i := 0; ; i++ {
+			cond := b.Input(fmt.Sprintf("IF%d", i))
+			if cond == nil {
+				break
+			}
+			v, err := in.eval(cond)
+			if err != nil {
+				return dbotFlowNormal, err
+			}
+			if toBool(v) {
+				return in.run(b.Statement(fmt.Sprintf("DO%d", i)))
+			}
+		}
+		return in.run(b.Statement("ELSE"))
+
+	case "controls_repeat_ext", "controls_repeat":
+		times := 0.0
+		if b.Type == "controls_repeat" {
+			times, _ = strconv.ParseFloat(b.Field("TIMES"), 64)
+		} else {
+			v, err := in.eval(b.Input("TIMES"))
+			if err != nil {
+				return dbotFlowNormal, err
+			}
+			times = toNumber(v)
+		}
+		for i := 0; i < int(times); i++ {
+			flow, err := in.run(b.Statement("DO"))
+			if err != nil || flow != dbotFlowNormal {
+				return flow, err
+			}
+		}
+
+	default:
+		return dbotFlowNormal, fmt.Errorf("unsupported statement block %q", b.Type)
+	}
+
+	return dbotFlowNormal, nil
+}
+
+func (in *dbotInterpreter) eval(b *DBotBlock) (interface{}, error) {
+	if b == nil {
+		return nil, nil
+	}
+	if err := in.step(); err != nil {
+		return nil, err
+	}
+
+	switch b.Type {
+	case "math_number":
+		return strconv.ParseFloat(b.Field("NUM"), 64)
+
+	case "text":
+		return b.Field("TEXT"), nil
+
+	case "logic_boolean":
+		return b.Field("BOOL") == "TRUE", nil
+
+	case "variables_get":
+		return in.vars[in.ws.varName(b)], nil
+
+	case "check_result":
+		return in.result == strings.ToLower(b.Field("CHECK_RESULT")), nil
+
+	case "tick":
+		return in.quote, nil
+
+	case "logic_negate":
+		v, err := in.eval(b.Input("BOOL"))
+		return !toBool(v), err
+
+	case "math_arithmetic", "logic_compare", "logic_operation":
+		a, err := in.eval(b.Input("A"))
+		if err != nil {
+			return nil, err
+		}
+		c, err := in.eval(b.Input("B"))
+		if err != nil {
+			return nil, err
+		}
+		return dbotBinary(b.Type, b.Field("OP"), a, c)
+	}
+
+	return nil, fmt.Errorf("unsupported value block %q", b.Type)
+}
+
+func dbotBinary(blockType, op string, a, b interface{}) (interface{}, error) {
+	switch blockType {
+	case "logic_operation":
+		switch op {
+		case "AND":
+			return toBool(a) && toBool(b), nil
+		case "OR":
+			return toBool(a) || toBool(b), nil
+		}
+	case "logic_compare":
+		if op == "EQ" || op == "NEQ" {
+			eq := toText(a) == toText(b)
+			if _, ok := a.(float64); ok {
+				eq = toNumber(a) == toNumber(b)
+			}
+			return eq == (op == "EQ"), nil
+		}
+		x, y := toNumber(a), toNumber(b)
+		switch op {
+		case "LT":
+			return x < y, nil
+		case "LTE":
+			return x <= y, nil
+		case "GT":
+			return x > y, nil
+		case "GTE":
+			return x >= y, nil
+		}
+	case "math_arithmetic":
+		x, y := toNumber(a), toNumber(b)
+		switch op {
+		case "ADD":
+			return x + y, nil
+		case "MINUS":
+			return x - y, nil
+		case "MULTIPLY":
+			return x * y, nil
+		case "DIVIDE":
+			if y == 0 {
+				return 0.0, nil
+			}
+			return x / y, nil
+		case "POWER":
+			return math.Pow(x, y), nil
+		}
+	}
+	return nil, fmt.Errorf("%s: unsupported operator %q", blockType, op)
+}
+
+func toNumber(v interface{}) float64 {
+	switch t := v.(type) {
+	case float64:
+		return t
+	case bool:
+		if t {
+			return 1
+		}
+	case string:
+		f, _ := strconv.ParseFloat(t, 64)
+		return f
+	}
+	return 0
+}
+
+func toBool(v interface{}) bool {
+	switch t := v.(type) {
+	case bool:
+		return t
+	case float64:
+		return t != 0
+	case string:
+		return t != ""
+	}
+	return false
+}
+
+func toText(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// DBotStrategy runs a Deriv DBot XML workspace: before_purchase is evaluated on
+// each tick until it purchases, after_purchase runs once the contract settles,
+// and the bot keeps trading only while after_purchase reaches trade_again.
+type DBotStrategy struct {
+	api    *deriv.DerivAPI
+	config Config
+
+	orders      *orderManager
+	mu          sync.Mutex
+	interp      *dbotInterpreter
+	inTrade     bool
+	totalProfit float64
+	balance     float64
+	done        chan error
+}
+
+func NewDBotStrategy(api *deriv.DerivAPI, config Config) *DBotStrategy {
+	return &DBotStrategy{
+		api:    api,
+		config: config,
+		orders: newOrderManager(config, nil),
+		done:   make(chan error, 1),
+	}
+}
+
+func (s *DBotStrategy) Execute(ctx context.Context) error {
+	ws, err := ParseDBotXML(s.config.Script)
+	if err != nil {
+		return err
+	}
+	if ws.Root("before_purchase") == nil {
+		return fmt.Errorf("DBot workspace has no before_purchase block")
+	}
+
+	def := ws.TradeDefinition()
+	if def.Market != "" {
+		s.config.Symbol = DBotSymbol(def.Market)
+	}
+	s.interp = newDBotInterpreter(ws)
+	s.interp.vars["TOTAL_PROFIT_LOSS"] = 0.0
+
+	log.Printf("Starting DBot Strategy for %s (trade type: %s)...", s.config.Symbol, def.TradeType)
+
+	if err := s.authorize(); err != nil {
+		return fmt.Errorf("authorization failed: %w", err)
+	}
+
+	go s.monitorBalance(ctx)
+
+	// Trade options may carry an INITIALIZATION statement run once at start
+	if flow, err := s.interp.start(ws.Root("trade_definition"), "INITIALIZATION"); err != nil {
+		return fmt.Errorf("DBot initialization error: %w", err)
+	} else if flow == dbotFlowStop {
+		return nil
+	}
+
+	warmUp(s.api, s.config, func(quote float64) {
+		s.interp.quote = quote
+	})
+
+	reqTicks := schema.Ticks{Ticks: s.config.Symbol}
+	_, tickSub, err := s.api.SubscribeTicks(reqTicks)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to ticks: %w", err)
+	}
+	defer tickSub.Forget()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-s.done:
+			return err
+		case tick, ok := <-tickSub.Stream:
+			if !ok {
+				return fmt.Errorf("tick stream closed")
+			}
+
+			s.orders.tick()
+			s.mu.Lock()
+			s.interp.quote = *tick.Tick.Quote
+			if s.inTrade || s.orders.ready() != nil {
+				s.mu.Unlock()
+				continue
+			}
+
+			flow, err := s.interp.start(ws.Root("before_purchase"), "statement")
+			purchase := s.interp.purchase
+			if flow == dbotFlowPurchase && err == nil {
+				s.inTrade = true
+			}
+			s.mu.Unlock()
+
+			if err != nil {
+				return fmt.Errorf("DBot before_purchase error: %w", err)
+			}
+			switch flow {
+			case dbotFlowStop:
+				log.Printf("DBot strategy stopped by controls_stop")
+				return nil
+			case dbotFlowPurchase:
+				stake := purchase.stake
+				if stake <= 0 {
+					stake = s.config.InitialStake
+				}
+				// The workspace sizes its own stakes; the order manager only
+				// spaces the entries
+				ticket, err := s.orders.enter()
+				if err != nil {
+					log.Printf("Purchase skipped: %v", err)
+					s.mu.Lock()
+					s.inTrade = false
+					s.mu.Unlock()
+					continue
+				}
+				go s.placeTrade(ctx, purchase.contractType, stake, ticket)
+			}
+		}
+	}
+}
+
+func (s *DBotStrategy) authorize() error {
+	reqAuth := schema.Authorize{Authorize: s.config.ApiToken}
+	_, err := s.api.Authorize(reqAuth)
+	return err
+}
+
+func (s *DBotStrategy) monitorBalance(ctx context.Context) {
+	sub := schema.BalanceSubscribe(1)
+	req := schema.Balance{Subscribe: &sub}
+	_, balanceSub, err := s.api.SubscribeBalance(req)
+	if err != nil {
+		log.Printf("Failed to subscribe to balance: %v", err)
+		return
+	}
+	defer balanceSub.Forget()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case b, ok := <-balanceSub.Stream:
+			if !ok {
+				return
+			}
+			s.mu.Lock()
+			s.balance = b.Balance.Balance
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *DBotStrategy) placeTrade(ctx context.Context, contractTypeStr string, stake float64, ticket orderTicket) {
+	defer s.orders.release(ctx, ticket)
+
+	amount := math.Round(stake*100) / 100
+	duration := s.config.Duration
+	basis := schema.ProposalBasisStake
+	currency := "USD"
+
+	reqProp := schema.Proposal{
+		Proposal:     1,
+		Amount:       &amount,
+		Basis:        &basis,
+		ContractType: schema.ProposalContractType(contractTypeStr),
+		Currency:     currency,
+		Duration:     &duration,
+		DurationUnit: proposalDurationUnit(s.config.DurationUnit),
+		Symbol:       s.config.Symbol,
+	}
+
+	propResp, err := s.api.Proposal(reqProp)
+	if err != nil {
+		log.Printf("Proposal error: %v", err)
+		s.purchaseFailed()
+		return
+	}
+
+	buyReq := schema.Buy{
+		Buy:   propResp.Proposal.Id,
+		Price: amount,
+	}
+
+	buyResp, buySub, err := s.api.SubscribeBuy(buyReq)
+	if err != nil {
+		log.Printf("Buy error: %v", err)
+		s.purchaseFailed()
+		return
+	}
+	defer buySub.Forget()
+	exit := newEarlyExit(s.api, s.config, buyResp.Buy.ContractId)
+	logContractOpened(buyResp.Buy.ContractId)
+
+	log.Printf("Trade placed [DBot] (%s). Stake: %.2f.", contractTypeStr, amount)
+
+	for contract := range buySub.Stream {
+		if *contract.ProposalOpenContract.IsSold == 1 {
+			profit := *contract.ProposalOpenContract.Profit
+			status := fmt.Sprintf("%v", contract.ProposalOpenContract.Status.Value)
+			s.finishTrade(ctx, contractTypeStr, amount, profit, status, exit)
+			return
+		}
+		exit.observe(contract.ProposalOpenContract)
+	}
+	// The stream ended without a settlement
+	log.Printf("Contract %d stream closed before settlement", buyResp.Buy.ContractId)
+	s.purchaseFailed()
+}
+
+// purchaseFailed lets before_purchase try again on the next tick. No
+// contract was bought, so there is no result for after_purchase: running it
+// would drive the script's martingale as if a contract had been lost.
+func (s *DBotStrategy) purchaseFailed() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inTrade = false
+}
+
+// finishTrade records the settled contract and runs after_purchase to decide
+// whether the bot trades again.
+func (s *DBotStrategy) finishTrade(ctx context.Context, contractType string, stake, profit float64, status string, exit *earlyExit) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.totalProfit += profit
+	log.Printf("Result: %s | Profit: %.2f | Total PnL: %.2f | Balance: %.2f", status, profit, s.totalProfit, s.balance)
+
+	if s.config.DB != nil {
+		trade := &database.Trade{
+			Strategy:     s.config.StrategyName,
+			Symbol:       s.config.Symbol,
+			ContractType: contractType,
+			Stake:        stake,
+			Profit:       profit,
+			Status:       status,
+			Balance:      s.balance,
+			TotalPnL:     s.totalProfit,
+			Duration:     s.config.Duration,
+			DurationUnit: s.config.DurationUnit,
+			LoginID:      s.config.LoginID,
+			Timestamp:    time.Now(),
+		}
+		exit.annotate(trade)
+		if err := s.config.DB.InsertTrade(ctx, trade); err != nil {
+			log.Printf("Failed to save trade to database: %v", err)
+		}
+	}
+
+	if s.config.StopLoss > 0 && s.totalProfit <= -s.config.StopLoss {
+		s.stop(fmt.Errorf("stop loss hit: total PnL %.2f", s.totalProfit))
+		return
+	}
+	if s.config.TargetProfit > 0 && s.totalProfit >= s.config.TargetProfit {
+		log.Printf("Target Profit Hit! Total PnL: %.2f. Stopping...", s.totalProfit)
+		s.stop(nil)
+		return
+	}
+
+	s.interp.result = "loss"
+	if profit > 0 {
+		s.interp.result = "win"
+	}
+	s.interp.vars["TOTAL_PROFIT_LOSS"] = s.totalProfit
+
+	root := s.interp.ws.Root("after_purchase")
+	if root == nil {
+		// Without an after_purchase block DBot keeps trading
+		s.inTrade = false
+		return
+	}
+
+	flow, err := s.interp.start(root, "statement")
+	switch {
+	case err != nil:
+		s.stop(fmt.Errorf("DBot after_purchase error: %w", err))
+	case flow == dbotFlowTradeAgain:
+		s.inTrade = false
+	default:
+		log.Printf("after_purchase finished without trade_again. Stopping...")
+		s.stop(nil)
+	}
+}
+
+func (s *DBotStrategy) stop(err error) {
+	select {
+	case s.done <- err:
+	default:
+	}
+}
@@ -0,0 +1,276 @@
+package strategy
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DBotConversion is the result of transpiling a DBot workspace to JavaScript.
+type DBotConversion struct {
+	Script    string `json:"script"`
+	Symbol    string `json:"symbol,omitempty"`
+	TradeType string `json:"trade_type,omitempty"`
+}
+
+// dbotJSContext selects what purchase/trade_again/controls_stop compile to.
+type dbotJSContext int
+
+const (
+	dbotJSBefore dbotJSContext = iota
+	dbotJSAfter
+	dbotJSInit
+)
+
+var jsIdentUnsafe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// ConvertDBotToJS transpiles a DBot XML workspace into a script for
+// CustomStrategy. The generated onTick runs before_purchase until it buys,
+// and onTradeResult runs after_purchase, stopping unless it reaches trade_again.
+func ConvertDBotToJS(content string) (*DBotConversion, error) {
+	ws, err := ParseDBotXML(content)
+	if err != nil {
+		return nil, err
+	}
+	if issues := ValidateDBotXML(content); HasDBotErrors(issues) {
+		for _, issue := range issues {
+			if issue.Severity == "error" {
+				return nil, fmt.Errorf("cannot convert: %s", issue.Message)
+			}
+		}
+	}
+
+	def := ws.TradeDefinition()
+	g := &dbotJSGen{ws: ws, tradeType: def.TradeType, vars: make(map[string]string)}
+
+	initBody := ""
+	if root := ws.Root("trade_definition"); root != nil {
+		initBody = g.stack(root.Statement("INITIALIZATION"), dbotJSInit, 1)
+	}
+	beforeBody := g.stack(ws.Root("before_purchase").Statement("statement"), dbotJSBefore, 1)
+	afterRoot := ws.Root("after_purchase")
+	afterBody := "\treturn true;\n"
+	if afterRoot != nil {
+		afterBody = g.stack(afterRoot.Statement("statement"), dbotJSAfter, 1) + "\treturn false;\n"
+	}
+	if g.err != nil {
+		return nil, g.err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("// Converted from DBot XML")
+	if def.TradeType != "" || def.Market != "" {
+		sb.WriteString(fmt.Sprintf(" (trade type: %s, market: %s)", def.TradeType, def.Market))
+	}
+	sb.WriteString("\n\nvar __dbot = { inTrade: false, stopped: false, result: \"\", quote: 0 };\n")
+	sb.WriteString("var TOTAL_PROFIT_LOSS = 0;\n")
+	// Division by zero gives 0, as in the DBot interpreter
+	sb.WriteString("function __divide(a, b) { var d = Number(b); return d === 0 || isNaN(d) ? 0 : a / d; }\n")
+
+	names := make([]string, 0, len(g.vars))
+	for name := range g.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if g.vars[name] != "TOTAL_PROFIT_LOSS" {
+			sb.WriteString(fmt.Sprintf("var %s = null; // %s\n", g.vars[name], name))
+		}
+	}
+
+	sb.WriteString("\nfunction __init() {\n" + initBody + "}\n")
+	sb.WriteString("\nfunction __beforePurchase() {\n" + beforeBody + "}\n")
+	sb.WriteString("\n// Returns true when the bot should trade again\nfunction __afterPurchase() {\n" + afterBody + "}\n")
+	sb.WriteString(`
+function onTick(quote) {
+	__dbot.quote = quote;
+	if (__dbot.inTrade || __dbot.stopped || isWarmingUp()) return;
+	__beforePurchase();
+}
+
+function onTradeResult(result) {
+	__dbot.inTrade = false;
+	// The contract never opened: try again on the next tick, as the
+	// interpreter does
+	if (result.status === "error" || result.status === "skipped") return;
+	TOTAL_PROFIT_LOSS += result.profit;
+	__dbot.result = result.profit > 0 ? "win" : "loss";
+	if (!__afterPurchase()) {
+		__dbot.stopped = true;
+		log("DBot strategy finished");
+	}
+}
+
+__init();
+`)
+
+	return &DBotConversion{
+		Script:    sb.String(),
+		Symbol:    DBotSymbol(def.Market),
+		TradeType: def.TradeType,
+	}, nil
+}
+
+type dbotJSGen struct {
+	ws        *DBotWorkspace
+	tradeType string
+	vars      map[string]string // DBot name -> JS identifier
+	err       error
+}
+
+func (g *dbotJSGen) fail(format string, args ...interface{}) string {
+	if g.err == nil {
+		g.err = fmt.Errorf(format, args...)
+	}
+	return ""
+}
+
+func (g *dbotJSGen) ident(b *DBotBlock) string {
+	name := g.ws.varName(b)
+	if id, ok := g.vars[name]; ok {
+		return id
+	}
+	id := "TOTAL_PROFIT_LOSS"
+	if name != "TOTAL_PROFIT_LOSS" {
+		id = "v_" + jsIdentUnsafe.ReplaceAllString(name, "_")
+	}
+	g.vars[name] = id
+	return id
+}
+
+func (g *dbotJSGen) stack(b *DBotBlock, ctx dbotJSContext, depth int) string {
+	var sb strings.Builder
+	for ; b != nil; b = b.NextBlock() {
+		sb.WriteString(g.statement(b, ctx, depth))
+	}
+	return sb.String()
+}
+
+func (g *dbotJSGen) statement(b *DBotBlock, ctx dbotJSContext, depth int) string {
+	indent := strings.Repeat("\t", depth)
+
+	switch b.Type {
+	case "purchase":
+		if ctx != dbotJSBefore {
+			return g.fail("purchase is only allowed in before_purchase")
+		}
+		contractType := DBotContractType(b.Field("PURCHASE_LIST"))
+		if contractType == "" {
+			contractType = DBotContractType(g.tradeType)
+		}
+		bet := "0"
+		if in := b.Input("BET"); in != nil {
+			bet = g.expr(in)
+		}
+		return fmt.Sprintf("%svar __bet = %s;\n%s__dbot.inTrade = true;\n%sbuy(%q, __bet > 0 ? __bet : getInitialStake());\n%sreturn;\n",
+			indent, bet, indent, indent, contractType, indent)
+
+	case "trade_again":
+		if ctx == dbotJSAfter {
+			return indent + "return true;\n"
+		}
+		return ""
+
+	case "controls_stop":
+		if ctx == dbotJSAfter {
+			return indent + "return false;\n"
+		}
+		return indent + "__dbot.stopped = true;\n" + indent + "return;\n"
+
+	case "text_print":
+		return fmt.Sprintf("%slog(%s);\n", indent, g.expr(b.Input("TEXT")))
+
+	case "variables_set":
+		return fmt.Sprintf("%s%s = %s;\n", indent, g.ident(b), g.expr(b.Input("VALUE")))
+
+	case "math_change":
+		id := g.ident(b)
+		return fmt.Sprintf("%s%s = (Number(%s) || 0) + %s;\n", indent, id, id, g.expr(b.Input("DELTA")))
+
+	case "controls_if":
+		var sb strings.Builder
+		for i := 0; ; i++ {
+			cond := b.Input(fmt.Sprintf("IF%d", i))
+			if cond == nil {
+				break
+			}
+			keyword := "if"
+			if i > 0 {
+				keyword = " else if"
+			}
+			if i == 0 {
+				sb.WriteString(indent)
+			}
+			sb.WriteString(fmt.Sprintf("%s (%s) {\n", keyword, g.expr(cond)))
+			sb.WriteString(g.stack(b.Statement(fmt.Sprintf("DO%d", i)), ctx, depth+1))
+			sb.WriteString(indent + "}")
+		}
+		if elseBlock := b.Statement("ELSE"); elseBlock != nil {
+			sb.WriteString(" else {\n")
+			sb.WriteString(g.stack(elseBlock, ctx, depth+1))
+			sb.WriteString(indent + "}")
+		}
+		sb.WriteString("\n")
+		return sb.String()
+
+	case "controls_repeat", "controls_repeat_ext":
+		times := b.Field("TIMES")
+		if b.Type == "controls_repeat_ext" {
+			times = g.expr(b.Input("TIMES"))
+		}
+		loopVar := fmt.Sprintf("__i%d", depth)
+		return fmt.Sprintf("%sfor (var %s = 0; %s < %s; %s++) {\n%s%s}\n",
+			indent, loopVar, loopVar, times, loopVar, g.stack(b.Statement("DO"), ctx, depth+1), indent)
+	}
+
+	return g.fail("unsupported statement block %q", b.Type)
+}
+
+func (g *dbotJSGen) expr(b *DBotBlock) string {
+	if b == nil {
+		return "null"
+	}
+
+	switch b.Type {
+	case "math_number":
+		if _, err := strconv.ParseFloat(b.Field("NUM"), 64); err != nil {
+			return g.fail("math_number: invalid number %q", b.Field("NUM"))
+		}
+		return b.Field("NUM")
+	case "text":
+		return strconv.Quote(b.Field("TEXT"))
+	case "logic_boolean":
+		return strconv.FormatBool(b.Field("BOOL") == "TRUE")
+	case "variables_get":
+		return g.ident(b)
+	case "check_result":
+		return fmt.Sprintf("(__dbot.result === %q)", strings.ToLower(b.Field("CHECK_RESULT")))
+	case "tick":
+		return "__dbot.quote"
+	case "logic_negate":
+		return fmt.Sprintf("!(%s)", g.expr(b.Input("BOOL")))
+	case "math_arithmetic", "logic_compare", "logic_operation":
+		ops := map[string]string{
+			"ADD": "+", "MINUS": "-", "MULTIPLY": "*",
+			"EQ": "==", "NEQ": "!=", "LT": "<", "LTE": "<=", "GT": ">", "GTE": ">=",
+			"AND": "&&", "OR": "||",
+		}
+		a, c := g.expr(b.Input("A")), g.expr(b.Input("B"))
+		op := b.Field("OP")
+		if op == "POWER" {
+			return fmt.Sprintf("Math.pow(%s, %s)", a, c)
+		}
+		if op == "DIVIDE" {
+			return fmt.Sprintf("__divide(%s, %s)", a, c)
+		}
+		jsOp, ok := ops[op]
+		if !ok {
+			return g.fail("%s: unsupported operator %q", b.Type, op)
+		}
+		return fmt.Sprintf("(%s %s %s)", a, jsOp, c)
+	}
+
+	return g.fail("unsupported value block %q", b.Type)
+}
@@ -0,0 +1,135 @@
+package strategy
+
+import (
+	"testing"
+
+	"github.com/dop251/goja"
+)
+
+// martingaleWorkspace doubles the stake after a loss, resets it after a win
+// and stops once the stake would exceed 4.
+const martingaleWorkspace = `<xml xmlns="http://www.w3.org/1999/xhtml" collection="false">
+  <variables>
+    <variable id="stakeVar">stake</variable>
+  </variables>
+  <block type="trade_definition" id="def" x="0" y="0">
+    <value name="TRADETYPE"><shadow type="text"><field name="TEXT">rise</field></shadow></value>
+    <value name="MARKET"><shadow type="text"><field name="TEXT">v100</field></shadow></value>
+    <statement name="INITIALIZATION">
+      <block type="variables_set" id="init">
+        <field name="VAR" id="stakeVar">stake</field>
+        <value name="VALUE"><block type="math_number" id="one"><field name="NUM">1</field></block></value>
+      </block>
+    </statement>
+  </block>
+  <block type="before_purchase" id="before" x="0" y="200">
+    <statement name="statement">
+      <block type="purchase" id="buy">
+        <field name="PURCHASE_LIST">CALL</field>
+        <value name="BET"><block type="variables_get" id="bet"><field name="VAR" id="stakeVar">stake</field></block></value>
+      </block>
+    </statement>
+  </block>
+  <block type="after_purchase" id="after" x="0" y="400">
+    <statement name="statement">
+      <block type="controls_if" id="result">
+        <mutation else="1"></mutation>
+        <value name="IF0"><block type="check_result" id="won"><field name="CHECK_RESULT">win</field></block></value>
+        <statement name="DO0">
+          <block type="variables_set" id="reset">
+            <field name="VAR" id="stakeVar">stake</field>
+            <value name="VALUE"><block type="math_number" id="one2"><field name="NUM">1</field></block></value>
+          </block>
+        </statement>
+        <statement name="ELSE">
+          <block type="variables_set" id="double">
+            <field name="VAR" id="stakeVar">stake</field>
+            <value name="VALUE">
+              <block type="math_arithmetic" id="times">
+                <field name="OP">MULTIPLY</field>
+                <value name="A"><block type="variables_get" id="cur"><field name="VAR" id="stakeVar">stake</field></block></value>
+                <value name="B"><block type="math_number" id="two"><field name="NUM">2</field></block></value>
+              </block>
+            </value>
+          </block>
+        </statement>
+        <next>
+          <block type="controls_if" id="limit">
+            <value name="IF0">
+              <block type="logic_compare" id="gt">
+                <field name="OP">GT</field>
+                <value name="A"><block type="variables_get" id="cur2"><field name="VAR" id="stakeVar">stake</field></block></value>
+                <value name="B"><block type="math_number" id="four"><field name="NUM">4</field></block></value>
+              </block>
+            </value>
+            <statement name="DO0"><block type="controls_stop" id="stop"></block></statement>
+            <next><block type="trade_again" id="again"></block></next>
+          </block>
+        </next>
+      </block>
+    </statement>
+  </block>
+</xml>`
+
+func TestConvertedMartingale(t *testing.T) {
+	conv, err := ConvertDBotToJS(martingaleWorkspace)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := goja.New()
+	var bought []float64
+	vm.Set("buy", func(contractType string, amount float64) { bought = append(bought, amount) })
+	vm.Set("log", func(string) {})
+	vm.Set("getInitialStake", func() float64 { return 1 })
+	vm.Set("isWarmingUp", func() bool { return false })
+	if _, err := vm.RunString(conv.Script); err != nil {
+		t.Fatalf("converted script: %v\n%s", err, conv.Script)
+	}
+	var onTick, onTradeResult func(interface{})
+	if err := vm.ExportTo(vm.Get("onTick"), &onTick); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.ExportTo(vm.Get("onTradeResult"), &onTradeResult); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each step ticks once, expects a purchase at the stake (0 for none) and
+	// reports its result
+	steps := []struct {
+		wantStake float64
+		status    string
+		profit    float64
+	}{
+		{1, "lost", -1},
+		{2, "error", 0},
+		{2, "skipped", 0},
+		{2, "won", 1.9},
+		{1, "lost", -1},
+		{2, "lost", -2},
+		{4, "lost", -4},
+		{0, "", 0},
+	}
+	for i, s := range steps {
+		bought = nil
+		onTick(100.0)
+		onTick(100.1) // still in the trade, so no second purchase
+		switch {
+		case s.wantStake == 0 && len(bought) != 0:
+			t.Fatalf("step %d: bought %v after the strategy stopped", i, bought)
+		case s.wantStake == 0:
+			continue
+		case len(bought) != 1 || bought[0] != s.wantStake:
+			t.Fatalf("step %d: bought %v, want one purchase at %.2f", i, bought, s.wantStake)
+		}
+		onTradeResult(map[string]interface{}{"status": s.status, "profit": s.profit})
+	}
+
+	if stopped := vm.Get("__dbot").ToObject(vm).Get("stopped").ToBoolean(); !stopped {
+		t.Error("strategy did not stop once the stake exceeded 4")
+	}
+	// Failed and skipped purchases are not counted
+	if pnl := vm.Get("TOTAL_PROFIT_LOSS").ToFloat(); pnl != -6.1 {
+		t.Errorf("TOTAL_PROFIT_LOSS = %.2f, want -6.10", pnl)
+	}
+}
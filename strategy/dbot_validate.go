@@ -0,0 +1,149 @@
+package strategy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DBotIssue is a single problem found in a DBot XML workspace.
+type DBotIssue struct {
+	Severity  string `json:"severity"` // "error" or "warning"
+	BlockID   string `json:"block_id,omitempty"`
+	BlockType string `json:"block_type,omitempty"`
+	Message   string `json:"message"`
+}
+
+// dbotSupportedBlocks lists the block types the interpreter and transpiler understand.
+var dbotSupportedBlocks = map[string]bool{
+	// Root and trade option blocks
+	"trade_definition":                true,
+	"trade_definition_market":         true,
+	"trade_definition_tradetype":      true,
+	"trade_definition_contracttype":   true,
+	"trade_definition_candleinterval": true,
+	"trade_definition_restartbuysell": true,
+	"trade_definition_restartonerror": true,
+	"trade_definition_tradeoptions":   true,
+	"before_purchase":                 true,
+	"during_purchase":                 true,
+	"after_purchase":                  true,
+	// Statements
+	"purchase":            true,
+	"trade_again":         true,
+	"controls_stop":       true,
+	"controls_if":         true,
+	"controls_repeat":     true,
+	"controls_repeat_ext": true,
+	"variables_set":       true,
+	"math_change":         true,
+	"text_print":          true,
+	// Values
+	"check_result":    true,
+	"variables_get":   true,
+	"math_number":     true,
+	"math_arithmetic": true,
+	"logic_compare":   true,
+	"logic_operation": true,
+	"logic_boolean":   true,
+	"logic_negate":    true,
+	"text":            true,
+	"tick":            true,
+}
+
+// KnownSymbols are the underlying symbols offered in the dashboard.
+var KnownSymbols = map[string]bool{
+	"R_10": true, "R_25": true, "R_50": true, "R_75": true, "R_100": true,
+	"1HZ10V": true, "1HZ15V": true, "1HZ25V": true, "1HZ30V": true, "1HZ50V": true,
+	"1HZ75V": true, "1HZ90V": true, "1HZ100V": true,
+	"BOOM300": true, "BOOM500": true, "BOOM600": true, "BOOM900": true, "BOOM1000": true,
+	"CRASH300": true, "CRASH500": true, "CRASH600": true, "CRASH900": true, "CRASH1000": true,
+	"JD10": true, "JD25": true, "JD50": true, "JD75": true, "JD100": true,
+	"RDBEAR": true, "RDBULL": true,
+	"STEP": true, "STEP100": true, "STEP200": true,
+	"RANGE100": true, "RANGE200": true,
+}
+
+// ValidateDBotXML checks a workspace for XML errors, unknown block types, a
+// missing purchase block and invalid TRADETYPE/MARKET values.
+func ValidateDBotXML(content string) []DBotIssue {
+	ws, err := ParseDBotXML(content)
+	if err != nil {
+		return []DBotIssue{{Severity: "error", Message: err.Error()}}
+	}
+
+	var issues []DBotIssue
+	add := func(severity string, b *DBotBlock, format string, args ...interface{}) {
+		issue := DBotIssue{Severity: severity, Message: fmt.Sprintf(format, args...)}
+		if b != nil {
+			issue.BlockID = b.ID
+			issue.BlockType = b.Type
+		}
+		issues = append(issues, issue)
+	}
+
+	tradeDef := ws.Root("trade_definition")
+	if tradeDef == nil {
+		add("error", nil, "missing trade_definition block")
+	}
+	before := ws.Root("before_purchase")
+	if before == nil {
+		add("error", nil, "missing before_purchase block")
+	}
+	if ws.Root("after_purchase") == nil {
+		add("warning", nil, "missing after_purchase block; the bot will trade on every tick without result handling")
+	}
+
+	purchases := 0
+	unknown := make(map[string]bool)
+	ws.Walk(func(b *DBotBlock, _ bool) {
+		if !dbotSupportedBlocks[b.Type] && !unknown[b.Type] {
+			unknown[b.Type] = true
+			add("error", b, "unknown block type %q", b.Type)
+		}
+		if b.Type == "purchase" {
+			purchases++
+			if list := b.Field("PURCHASE_LIST"); list != "" && DBotContractType(list) == "" {
+				add("error", b, "invalid PURCHASE_LIST value %q", list)
+			}
+		}
+	})
+	if before != nil {
+		inBefore := false
+		before.walk(func(b *DBotBlock, _ bool) {
+			if b.Type == "purchase" {
+				inBefore = true
+			}
+		}, false)
+		if !inBefore {
+			add("error", before, "before_purchase must contain a purchase block")
+		}
+	} else if purchases == 0 {
+		add("error", nil, "workspace has no purchase block")
+	}
+
+	if tradeDef != nil {
+		def := ws.TradeDefinition()
+		if def.TradeType == "" {
+			add("error", tradeDef, "TRADETYPE is not set")
+		} else if DBotContractType(def.TradeType) == "" {
+			add("error", tradeDef, "invalid TRADETYPE %q", def.TradeType)
+		}
+		if def.Market == "" {
+			add("warning", tradeDef, "MARKET is not set; the bot's configured symbol will be used")
+		} else if !KnownSymbols[strings.ToUpper(DBotSymbol(def.Market))] {
+			add("error", tradeDef, "invalid MARKET %q", def.Market)
+		}
+	}
+
+	return issues
+}
+
+// HasDBotErrors reports whether any issue is an error rather than a warning.
+func HasDBotErrors(issues []DBotIssue) bool {
+	for _, issue := range issues {
+		if issue.Severity == "error" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,251 @@
+package strategy
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// DBotWorkspace is a parsed Deriv DBot (Blockly) XML document.
+type DBotWorkspace struct {
+	XMLName   xml.Name       `xml:"xml"`
+	Variables []DBotVariable `xml:"variables>variable"`
+	Blocks    []*DBotBlock   `xml:"block"`
+}
+
+// DBotVariable is a declared workspace variable (<variables><variable id="..">name</variable>).
+type DBotVariable struct {
+	ID   string `xml:"id,attr"`
+	Name string `xml:",chardata"`
+}
+
+// DBotBlock is a single Blockly block. Shadows share the same shape.
+type DBotBlock struct {
+	Type       string          `xml:"type,attr"`
+	ID         string          `xml:"id,attr"`
+	Fields     []DBotField     `xml:"field"`
+	Values     []DBotValue     `xml:"value"`
+	Statements []DBotStatement `xml:"statement"`
+	Next       *DBotNext       `xml:"next"`
+}
+
+type DBotField struct {
+	Name  string `xml:"name,attr"`
+	ID    string `xml:"id,attr"`
+	Value string `xml:",chardata"`
+}
+
+// DBotValue is a value input. A connected block takes precedence over its shadow.
+type DBotValue struct {
+	Name   string     `xml:"name,attr"`
+	Block  *DBotBlock `xml:"block"`
+	Shadow *DBotBlock `xml:"shadow"`
+}
+
+type DBotStatement struct {
+	Name  string     `xml:"name,attr"`
+	Block *DBotBlock `xml:"block"`
+	Next  *DBotNext  `xml:"next"` // misplaced <next>, seen in hand-written workspaces
+}
+
+type DBotNext struct {
+	Block *DBotBlock `xml:"block"`
+}
+
+// ParseDBotXML parses a DBot XML workspace. Parsing is lenient: block ids
+// exported by DBot often contain bare '&', and a <next> placed directly in a
+// <statement> is chained onto the end of that statement's stack.
+func ParseDBotXML(content string) (*DBotWorkspace, error) {
+	var ws DBotWorkspace
+	dec := xml.NewDecoder(strings.NewReader(strings.TrimSpace(content)))
+	dec.Strict = false
+	if err := dec.Decode(&ws); err != nil {
+		return nil, fmt.Errorf("invalid DBot XML: %w", err)
+	}
+	if len(ws.Blocks) == 0 {
+		return nil, fmt.Errorf("invalid DBot XML: workspace has no blocks")
+	}
+	ws.Walk(func(b *DBotBlock, _ bool) {
+		for i := range b.Statements {
+			st := &b.Statements[i]
+			if st.Next == nil || st.Next.Block == nil {
+				continue
+			}
+			if st.Block == nil {
+				st.Block = st.Next.Block
+			} else {
+				last := st.Block
+				for last.NextBlock() != nil {
+					last = last.NextBlock()
+				}
+				last.Next = st.Next
+			}
+			st.Next = nil
+		}
+	})
+	return &ws, nil
+}
+
+// IsDBotXML reports whether content looks like a DBot XML workspace rather than JavaScript.
+func IsDBotXML(content string) bool {
+	return strings.Contains(content, "<xml") && strings.Contains(content, "<block")
+}
+
+// Root returns the first top-level block of the given type, or nil.
+func (ws *DBotWorkspace) Root(blockType string) *DBotBlock {
+	for _, b := range ws.Blocks {
+		if b.Type == blockType {
+			return b
+		}
+	}
+	return nil
+}
+
+// Walk calls fn for every block in the workspace, including shadows.
+func (ws *DBotWorkspace) Walk(fn func(b *DBotBlock, shadow bool)) {
+	for _, b := range ws.Blocks {
+		b.walk(fn, false)
+	}
+}
+
+func (b *DBotBlock) walk(fn func(b *DBotBlock, shadow bool), shadow bool) {
+	if b == nil {
+		return
+	}
+	fn(b, shadow)
+	for _, v := range b.Values {
+		v.Shadow.walk(fn, true)
+		v.Block.walk(fn, false)
+	}
+	for _, st := range b.Statements {
+		st.Block.walk(fn, false)
+	}
+	if b.Next != nil {
+		b.Next.Block.walk(fn, false)
+	}
+}
+
+// Field returns the text of the named field.
+func (b *DBotBlock) Field(name string) string {
+	for _, f := range b.Fields {
+		if f.Name == name {
+			return strings.TrimSpace(f.Value)
+		}
+	}
+	return ""
+}
+
+// Input returns the block connected to the named value input, falling back to its shadow.
+func (b *DBotBlock) Input(name string) *DBotBlock {
+	for _, v := range b.Values {
+		if v.Name == name {
+			if v.Block != nil {
+				return v.Block
+			}
+			return v.Shadow
+		}
+	}
+	return nil
+}
+
+// Statement returns the first block of the named statement input.
+func (b *DBotBlock) Statement(name string) *DBotBlock {
+	for _, st := range b.Statements {
+		if st.Name == name {
+			return st.Block
+		}
+	}
+	return nil
+}
+
+// NextBlock returns the block chained after b.
+func (b *DBotBlock) NextBlock() *DBotBlock {
+	if b.Next == nil {
+		return nil
+	}
+	return b.Next.Block
+}
+
+// varName resolves a VAR field to a variable name, using the declared
+// variables when the field only carries an id.
+func (ws *DBotWorkspace) varName(b *DBotBlock) string {
+	for _, f := range b.Fields {
+		if f.Name != "VAR" {
+			continue
+		}
+		if name := strings.TrimSpace(f.Value); name != "" {
+			return name
+		}
+		for _, v := range ws.Variables {
+			if v.ID == f.ID {
+				return strings.TrimSpace(v.Name)
+			}
+		}
+		return f.ID
+	}
+	return ""
+}
+
+// DBotTradeDefinition holds the market and contract family declared by trade_definition.
+type DBotTradeDefinition struct {
+	TradeType string
+	Market    string
+}
+
+// TradeDefinition extracts the trade_definition settings from the workspace.
+func (ws *DBotWorkspace) TradeDefinition() DBotTradeDefinition {
+	var def DBotTradeDefinition
+	root := ws.Root("trade_definition")
+	if root == nil {
+		return def
+	}
+	if b := root.Input("TRADETYPE"); b != nil {
+		def.TradeType = strings.ToLower(b.Field("TEXT"))
+	}
+	if b := root.Input("MARKET"); b != nil {
+		def.Market = b.Field("TEXT")
+	}
+	// Newer workspaces nest the market in a trade_definition_market block
+	root.walk(func(b *DBotBlock, _ bool) {
+		if b.Type == "trade_definition_market" && def.Market == "" {
+			def.Market = b.Field("SYMBOL_LIST")
+		}
+		if b.Type == "trade_definition_tradetype" && def.TradeType == "" {
+			def.TradeType = strings.ToLower(b.Field("TRADETYPE_LIST"))
+		}
+	}, false)
+	return def
+}
+
+// dbotMarketAliases maps DBot shorthand market names to Deriv symbols.
+var dbotMarketAliases = map[string]string{
+	"v10":  "R_10",
+	"v25":  "R_25",
+	"v50":  "R_50",
+	"v75":  "R_75",
+	"v100": "R_100",
+}
+
+// DBotSymbol resolves a MARKET value to a Deriv symbol.
+func DBotSymbol(market string) string {
+	if sym, ok := dbotMarketAliases[strings.ToLower(market)]; ok {
+		return sym
+	}
+	return market
+}
+
+// DBotContractType maps a TRADETYPE (or purchase PURCHASE_LIST) value to a
+// contract type understood by the bot. It returns "" for unsupported values.
+func DBotContractType(tradeType string) string {
+	switch strings.ToLower(tradeType) {
+	case "rise", "call", "callput", "risefall", "higher", "high":
+		return "CALL"
+	case "fall", "put", "lower", "low":
+		return "PUT"
+	case "even", "evenodd", "digiteven":
+		return "DIGITEVEN"
+	case "odd", "digitodd":
+		return "DIGITODD"
+	}
+	return ""
+}
@@ -4,10 +4,10 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"math"
-	"strconv"
 	"sync"
 
+	"deriv_trade/database"
+
 	"github.com/ksysoev/deriv-api"
 	"github.com/ksysoev/deriv-api/schema"
 )
@@ -16,20 +16,16 @@ type DigitDiffersStrategy struct {
 	api    *deriv.DerivAPI
 	config Config
 
-	mu           sync.Mutex
-	currentStake float64
-	totalProfit  float64
-	maxPnL       float64
-	balance      float64
+	orders *orderManager
+
+	mu      sync.Mutex
+	balance float64
 }
 
 func NewDigitDiffersStrategy(api *deriv.DerivAPI, config Config) *DigitDiffersStrategy {
-	return &DigitDiffersStrategy{
-		api:          api,
-		config:       config,
-		currentStake: config.InitialStake,
-		maxPnL:       0,
-	}
+	s := &DigitDiffersStrategy{api: api, config: config}
+	s.orders = newOrderManager(config, s.handleSettlement)
+	return s
 }
 
 func (s *DigitDiffersStrategy) Execute(ctx context.Context) error {
@@ -58,9 +54,13 @@ func (s *DigitDiffersStrategy) Execute(ctx context.Context) error {
 			}
 
 			quote := *tick.Tick.Quote
-			lastDigit := s.getLastDigit(quote)
+			lastDigit := DigitStatsFor(s.config.Symbol).Add(quote, int(tick.Tick.PipSize))
+			if lastDigit < 0 {
+				continue // precision unknown, so the digit cannot be told
+			}
 
 			log.Printf("Quote: %.4f | Last Digit: %d", quote, lastDigit)
+			s.orders.tick()
 
 			// Strategy: Bet that the NEXT digit will NOT be 'lastDigit' (Dynamic Differs)
 			// Or if Config.Prediction is set (>=0), use that.
@@ -80,21 +80,15 @@ func (s *DigitDiffersStrategy) Execute(ctx context.Context) error {
 			// To avoid spamming, maybe wait for a specific condition?
 			// E.g. If last digit was 5, bet Differs 5.
 
-			stake := s.getStake()
-			go s.placeTrade(ctx, schema.ProposalContractTypeDIGITDIFF, stake, prediction)
-		}
-	}
-}
-
-func (s *DigitDiffersStrategy) getLastDigit(val float64) int {
-	str := fmt.Sprintf("%.5f", val) // Ensure precision
-	for i := len(str) - 1; i >= 0; i-- {
-		if str[i] >= '0' && str[i] <= '9' {
-			d, _ := strconv.Atoi(string(str[i]))
-			return d
+			// One contract at a time by default, so martingale stakes follow
+			// each settlement instead of piling up on every tick
+			ticket, err := s.orders.enter()
+			if err != nil {
+				continue
+			}
+			go s.placeTrade(ctx, schema.ProposalContractTypeDIGITDIFF, ticket, prediction)
 		}
 	}
-	return 0
 }
 
 func (s *DigitDiffersStrategy) authorize() error {
@@ -128,14 +122,8 @@ func (s *DigitDiffersStrategy) monitorBalance(ctx context.Context) {
 	}
 }
 
-func (s *DigitDiffersStrategy) getStake() float64 {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	return s.currentStake
-}
-
-func (s *DigitDiffersStrategy) placeTrade(ctx context.Context, contractType schema.ProposalContractType, stake float64, prediction int) {
-	amount := stake
+func (s *DigitDiffersStrategy) placeTrade(ctx context.Context, contractType schema.ProposalContractType, ticket orderTicket, prediction int) {
+	amount := ticket.stake
 	duration := s.config.Duration
 	basis := schema.ProposalBasisStake
 	currency := "USD"
@@ -166,8 +154,9 @@ func (s *DigitDiffersStrategy) placeTrade(ctx context.Context, contractType sche
 
 	propResp, err := s.api.Proposal(reqProp)
 	if err != nil {
-		log.Printf("Proposal error: %v. Resetting stake.", err)
-		// Don't reset stake on proposal error (might be market closed or limits), just return
+		log.Printf("Proposal error: %v", err)
+		// Don't reset stake on proposal error (might be market closed or limits), just free the position
+		s.orders.release(ctx, ticket)
 		return
 	}
 
@@ -176,12 +165,15 @@ func (s *DigitDiffersStrategy) placeTrade(ctx context.Context, contractType sche
 		Price: amount,
 	}
 
-	_, buySub, err := s.api.SubscribeBuy(buyReq)
+	buyResp, buySub, err := s.api.SubscribeBuy(buyReq)
 	if err != nil {
 		log.Printf("Buy error: %v", err)
+		s.orders.release(ctx, ticket)
 		return
 	}
 	defer buySub.Forget()
+	exit := newEarlyExit(s.api, s.config, buyResp.Buy.ContractId)
+	logContractOpened(buyResp.Buy.ContractId)
 
 	log.Printf("Trade placed (%s %d). Stake: %.2f.", contractType, prediction, amount)
 
@@ -189,60 +181,28 @@ func (s *DigitDiffersStrategy) placeTrade(ctx context.Context, contractType sche
 		if *contract.ProposalOpenContract.IsSold == 1 {
 			profit := *contract.ProposalOpenContract.Profit
 			status := fmt.Sprintf("%v", contract.ProposalOpenContract.Status.Value)
-			s.handleTradeResult(ctx, profit, status)
+			s.handleTradeResult(ctx, ticket, string(contractType), profit, status, exit)
 			return
 		}
+		exit.observe(contract.ProposalOpenContract)
 	}
+	// The stream ended without a settlement
+	s.orders.release(ctx, ticket)
+}
+
+func (s *DigitDiffersStrategy) handleTradeResult(ctx context.Context, ticket orderTicket, contractType string, profit float64, status string, exit *earlyExit) {
+	trade := database.Trade{ContractType: contractType, Profit: profit, Status: status}
+	exit.annotate(&trade)
+	s.orders.settle(ctx, ticket, trade)
 }
 
-func (s *DigitDiffersStrategy) handleTradeResult(ctx context.Context, profit float64, status string) {
+// handleSettlement logs a settlement in entry order and stops the bot when
+// it ended the session.
+func (s *DigitDiffersStrategy) handleSettlement(ctx context.Context, st settlement) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.totalProfit += profit
-	if s.totalProfit > s.maxPnL {
-		s.maxPnL = s.totalProfit
-	}
-	// Calculate Trailing Stop Level
-	var trailingStopLevel float64
-	if s.config.UseTrailingStop {
-		trailingStopLevel = s.maxPnL - s.config.StopLoss
-	} else {
-		trailingStopLevel = -s.config.StopLoss
-	}
-
-	log.Printf("Result: %s | Profit: %.2f | Total PnL: %.2f | Balance: %.2f", status, profit, s.totalProfit, s.balance)
-
-	stopLossMsg := "Trailing Stop Loss Hit"
-	if !s.config.UseTrailingStop {
-		stopLossMsg = "Stop Loss Hit"
-	}
-
-	if s.totalProfit <= trailingStopLevel {
-		log.Printf("%s! Total PnL: %.2f <= Stop Level: %.2f. Stopping...", stopLossMsg, s.totalProfit, trailingStopLevel)
-		log.Fatalf("%s - Stopping Bot", stopLossMsg)
-	}
-	if s.totalProfit >= s.config.TargetProfit {
-		log.Printf("Target Profit Hit! Total PnL: %.2f. Stopping...", s.totalProfit)
-		log.Fatal("Target Profit Hit - Stopping Bot")
-	}
-
-	if profit > 0 {
-		s.currentStake = s.config.InitialStake
-	} else {
-		// Martingale for Differs needs to be aggressive because payout is small (approx 10% usually).
-		newStake := s.currentStake * s.config.MartingaleMulti
-		newStake = math.Round(newStake*100) / 100
-
-		allowedLoss := s.totalProfit - trailingStopLevel
-		if newStake > allowedLoss {
-			log.Printf("Martingale stake (%.2f) exceeds allowed risk buffer (%.2f). Reverting to Initial Stake.", newStake, allowedLoss)
-			s.currentStake = s.config.InitialStake
-		} else {
-			s.currentStake = newStake
-		}
-	}
-
-	log.Printf("Next Stake: %.2f", s.currentStake)
-
+	log.Printf("Result: %s | Profit: %.2f | Total PnL: %.2f | Balance: %.2f", st.trade.Status, st.trade.Profit, st.totalProfit, s.balance)
+	stopOnReason(s.config, st)
+	log.Printf("Next Stake: %.2f", st.nextStake)
 }
@@ -0,0 +1,384 @@
+package strategy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+
+	"deriv_trade/database"
+
+	"github.com/ksysoev/deriv-api"
+	"github.com/ksysoev/deriv-api/schema"
+)
+
+const (
+	// minDigitSamples is how many digits must be seen before trading.
+	minDigitSamples = 100
+	// minDigitZ is the z-score by which a single digit outcome must beat
+	// the win probability its payout breaks even at before it is traded.
+	// It is raised for the number of contracts compared (see
+	// digitZThreshold).
+	minDigitZ = 2.0
+)
+
+// ValidateDigitPrediction checks the prediction a digit contract needs:
+// 0-9 for matches/differs, 0-8 for over and 1-9 for under. Other contract
+// types take no prediction and always pass.
+func ValidateDigitPrediction(contractType string, prediction int) error {
+	lo, hi := 0, 9
+	switch contractType {
+	case "DIGITMATCH", "DIGITDIFF":
+	case "DIGITOVER":
+		hi = 8
+	case "DIGITUNDER":
+		lo = 1
+	default:
+		return nil
+	}
+	if prediction < lo || prediction > hi {
+		return fmt.Errorf("%s needs a prediction between %d and %d, got %d", contractType, lo, hi, prediction)
+	}
+	return nil
+}
+
+// NeedsPrediction reports whether contractType is settled against a predicted digit.
+func NeedsPrediction(contractType string) bool {
+	switch contractType {
+	case "DIGITMATCH", "DIGITDIFF", "DIGITOVER", "DIGITUNDER":
+		return true
+	}
+	return false
+}
+
+// digitWins reports whether a digit contract wins with the given last digit.
+func digitWins(contractType string, prediction, digit int) bool {
+	switch contractType {
+	case "DIGITMATCH":
+		return digit == prediction
+	case "DIGITDIFF":
+		return digit != prediction
+	case "DIGITOVER":
+		return digit > prediction
+	case "DIGITUNDER":
+		return digit < prediction
+	case "DIGITEVEN":
+		return digit%2 == 0
+	case "DIGITODD":
+		return digit%2 == 1
+	}
+	return false
+}
+
+// digitContract is a Matches/Over/Under contract on one barrier.
+type digitContract struct {
+	contractType string
+	prediction   int
+}
+
+// digitCandidates lists the contracts the strategy weighs. A prediction of
+// 0-9 restricts them to that barrier.
+func digitCandidates(prediction int) []digitContract {
+	var candidates []digitContract
+	for _, contractType := range []string{"DIGITOVER", "DIGITUNDER", "DIGITMATCH"} {
+		for p := 0; p <= 9; p++ {
+			if prediction >= 0 && prediction <= 9 && p != prediction {
+				continue
+			}
+			if ValidateDigitPrediction(contractType, p) != nil {
+				continue
+			}
+			candidates = append(candidates, digitContract{contractType, p})
+		}
+	}
+	return candidates
+}
+
+// digitZThreshold is the z-score the best of m compared contracts must
+// clear: the one-sided significance of minDigitZ split across all of them
+// (Bonferroni), so that scanning more contracts doesn't find more edges by
+// chance.
+func digitZThreshold(m int) float64 {
+	if m <= 1 {
+		return minDigitZ
+	}
+	alpha := math.Erfc(minDigitZ/math.Sqrt2) / 2 / float64(m)
+	return math.Sqrt2 * math.Erfinv(1-2*alpha)
+}
+
+// digitChoice is a candidate digit contract and how far its observed win
+// rate sits above the probability its payout breaks even at.
+type digitChoice struct {
+	digitContract
+	observed  float64
+	breakEven float64 // stake / payout
+	z         float64
+}
+
+// pickDigitContract compares the observed digit frequencies against the
+// win probability each priced contract breaks even at, and returns the
+// contract with the strongest edge. Contracts without a price are skipped.
+// ok is false when nothing clears digitZThreshold for the number of
+// contracts compared.
+func pickDigitContract(snap DigitSnapshot, breakEven map[digitContract]float64) (digitChoice, bool) {
+	var best digitChoice
+	found := false
+	if snap.Samples < minDigitSamples || len(breakEven) == 0 {
+		return best, false
+	}
+	n := float64(snap.Samples)
+	threshold := digitZThreshold(len(breakEven))
+
+	for contract, p := range breakEven {
+		if p <= 0 || p >= 1 {
+			continue
+		}
+		c := digitChoice{digitContract: contract, breakEven: p}
+		for d := 0; d <= 9; d++ {
+			if digitWins(contract.contractType, contract.prediction, d) {
+				c.observed += snap.Frequencies[d]
+			}
+		}
+		c.z = (c.observed - p) / math.Sqrt(p*(1-p)/n)
+		if c.z >= threshold && (!found || c.z > best.z) {
+			best, found = c, true
+		}
+	}
+	return best, found
+}
+
+// DigitOverUnderStrategy trades Matches/Over/Under digit contracts when the
+// symbol's rolling last-digit distribution deviates from uniform.
+type DigitOverUnderStrategy struct {
+	api    *deriv.DerivAPI
+	config Config
+
+	orders *orderManager
+
+	mu        sync.Mutex
+	balance   float64
+	breakEven map[digitContract]float64 // stake / payout from the latest proposals
+}
+
+func NewDigitOverUnderStrategy(api *deriv.DerivAPI, config Config) *DigitOverUnderStrategy {
+	s := &DigitOverUnderStrategy{api: api, config: config}
+	s.orders = newOrderManager(config, s.handleSettlement)
+	return s
+}
+
+func (s *DigitOverUnderStrategy) Execute(ctx context.Context) error {
+	log.Printf("Starting Digit Over/Under Strategy for %s...", s.config.Symbol)
+
+	// 1. Authorize
+	if err := s.authorize(); err != nil {
+		return fmt.Errorf("authorization failed: %w", err)
+	}
+
+	// 2. Monitor Balance
+	go s.monitorBalance(ctx)
+
+	// 3. Seed the digit distribution from recent history; the strategy keeps
+	// no other state, so at least a full statistics window is replayed
+	digits := DigitStatsFor(s.config.Symbol)
+	seed := s.config
+	if seed.WarmupTicks < DefaultDigitWindow {
+		seed.WarmupTicks = DefaultDigitWindow
+	}
+	warmUp(s.api, seed, func(float64) {})
+
+	// 4. Price the candidate contracts; trades refresh their prices
+	s.quoteContracts(digitCandidates(s.config.Prediction))
+
+	// 5. Subscribe to Ticks
+	reqTicks := schema.Ticks{Ticks: s.config.Symbol}
+	_, tickSub, err := s.api.SubscribeTicks(reqTicks)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to ticks: %w", err)
+	}
+	defer tickSub.Forget()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case tick, ok := <-tickSub.Stream:
+			if !ok {
+				return fmt.Errorf("tick stream closed")
+			}
+
+			quote := *tick.Tick.Quote
+			lastDigit := digits.Add(quote, int(tick.Tick.PipSize))
+			s.orders.tick()
+			if s.orders.ready() != nil {
+				continue
+			}
+
+			snap := digits.Snapshot(DefaultDigitWindow)
+			s.mu.Lock()
+			choice, ok := pickDigitContract(snap, s.breakEven)
+			s.mu.Unlock()
+			if !ok {
+				log.Printf("Quote: %.4f | Digit: %d | No digit edge over %d samples", quote, lastDigit, snap.Samples)
+				continue
+			}
+
+			log.Printf("Digit edge: %s %d wins %.1f%% vs %.1f%% to break even (z=%.2f). Placing trade...",
+				choice.contractType, choice.prediction, choice.observed*100, choice.breakEven*100, choice.z)
+			ticket, err := s.orders.enter()
+			if err != nil {
+				log.Printf("Trade skipped: %v", err)
+				continue
+			}
+			go s.placeTrade(ctx, choice.contractType, ticket, choice.prediction)
+		}
+	}
+}
+
+func (s *DigitOverUnderStrategy) authorize() error {
+	reqAuth := schema.Authorize{Authorize: s.config.ApiToken}
+	_, err := s.api.Authorize(reqAuth)
+	return err
+}
+
+func (s *DigitOverUnderStrategy) monitorBalance(ctx context.Context) {
+	sub := schema.BalanceSubscribe(1)
+	req := schema.Balance{Subscribe: &sub}
+	_, balanceSub, err := s.api.SubscribeBalance(req)
+	if err != nil {
+		log.Printf("Failed to subscribe to balance: %v", err)
+		return
+	}
+	defer balanceSub.Forget()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case b, ok := <-balanceSub.Stream:
+			if !ok {
+				return
+			}
+			s.mu.Lock()
+			s.balance = b.Balance.Balance
+			s.mu.Unlock()
+		}
+	}
+}
+
+// proposal requests a price for a digit contract at the given stake.
+func (s *DigitOverUnderStrategy) proposal(contract digitContract, amount float64) (schema.ProposalResp, error) {
+	duration := s.config.Duration
+	basis := schema.ProposalBasisStake
+	barrier := fmt.Sprintf("%d", contract.prediction)
+
+	reqProp := schema.Proposal{
+		Proposal:     1,
+		Amount:       &amount,
+		Basis:        &basis,
+		ContractType: schema.ProposalContractType(contract.contractType),
+		Currency:     "USD",
+		Duration:     &duration,
+		DurationUnit: schema.ProposalDurationUnitT,
+		Symbol:       s.config.Symbol,
+		Barrier:      &barrier,
+	}
+	resp, err := s.api.Proposal(reqProp)
+	if err == nil {
+		s.rememberPrice(contract, resp)
+	}
+	return resp, err
+}
+
+// quoteContracts prices each candidate at the initial stake. Contracts
+// that can't be priced are left out of the search.
+func (s *DigitOverUnderStrategy) quoteContracts(candidates []digitContract) {
+	for _, contract := range candidates {
+		if _, err := s.proposal(contract, s.config.InitialStake); err != nil {
+			log.Printf("Failed to price %s %d: %v", contract.contractType, contract.prediction, err)
+		}
+	}
+	s.mu.Lock()
+	log.Printf("Priced %d of %d digit contracts; an edge needs z >= %.2f", len(s.breakEven), len(candidates), digitZThreshold(len(s.breakEven)))
+	s.mu.Unlock()
+}
+
+// rememberPrice records the win probability a proposal breaks even at.
+func (s *DigitOverUnderStrategy) rememberPrice(contract digitContract, resp schema.ProposalResp) {
+	if resp.Proposal == nil || resp.Proposal.Payout <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.breakEven == nil {
+		s.breakEven = map[digitContract]float64{}
+	}
+	s.breakEven[contract] = resp.Proposal.AskPrice / resp.Proposal.Payout
+}
+
+func (s *DigitOverUnderStrategy) placeTrade(ctx context.Context, contractType string, ticket orderTicket, prediction int) {
+	amount := ticket.stake
+
+	propResp, err := s.proposal(digitContract{contractType, prediction}, amount)
+	if err != nil {
+		log.Printf("Proposal error: %v", err)
+		s.orders.release(ctx, ticket)
+		return
+	}
+
+	buyReq := schema.Buy{
+		Buy:   propResp.Proposal.Id,
+		Price: amount,
+	}
+
+	buyResp, buySub, err := s.api.SubscribeBuy(buyReq)
+	if err != nil {
+		log.Printf("Buy error: %v", err)
+		s.orders.release(ctx, ticket)
+		return
+	}
+	defer buySub.Forget()
+	exit := newEarlyExit(s.api, s.config, buyResp.Buy.ContractId)
+	logContractOpened(buyResp.Buy.ContractId)
+
+	log.Printf("Trade placed (%s %d). Stake: %.2f.", contractType, prediction, amount)
+
+	for contract := range buySub.Stream {
+		if *contract.ProposalOpenContract.IsSold == 1 {
+			profit := *contract.ProposalOpenContract.Profit
+			status := fmt.Sprintf("%v", contract.ProposalOpenContract.Status.Value)
+			s.handleTradeResult(ctx, ticket, contractType, prediction, profit, status, exit)
+			return
+		}
+		exit.observe(contract.ProposalOpenContract)
+	}
+	// The stream ended without a settlement
+	s.orders.release(ctx, ticket)
+}
+
+func (s *DigitOverUnderStrategy) handleTradeResult(ctx context.Context, ticket orderTicket, contractType string, prediction int, profit float64, status string, exit *earlyExit) {
+	trade := database.Trade{
+		Strategy:     s.config.StrategyName,
+		Symbol:       s.config.Symbol,
+		ContractType: contractType,
+		Profit:       profit,
+		Status:       status,
+		Duration:     s.config.Duration,
+		DurationUnit: s.config.DurationUnit,
+		Prediction:   prediction,
+	}
+	exit.annotate(&trade)
+	s.orders.settle(ctx, ticket, trade)
+}
+
+// handleSettlement logs a settlement in entry order and stops the bot when
+// it ended the session.
+func (s *DigitOverUnderStrategy) handleSettlement(ctx context.Context, st settlement) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	log.Printf("Result: %s | Profit: %.2f | Total PnL: %.2f | Balance: %.2f", st.trade.Status, st.trade.Profit, st.totalProfit, s.balance)
+	saveSettlement(ctx, s.config, st, s.balance)
+	stopOnReason(s.config, st)
+	log.Printf("Next Stake: %.2f", st.nextStake)
+}
@@ -0,0 +1,278 @@
+package strategy
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"sync"
+)
+
+const (
+	// DefaultDigitWindow is the number of recent digits statistics cover by default.
+	DefaultDigitWindow = 1000
+	// MaxDigitWindow is the number of digits kept per symbol.
+	MaxDigitWindow = 5000
+	// digitUniformAlpha is the significance level of the uniformity test.
+	digitUniformAlpha = 0.05
+)
+
+// LastDigit returns the last displayed digit of quote. pipSize is the number
+// of decimal places the symbol is quoted with (the pip_size sent with ticks,
+// see SymbolPipSize); formatting to that precision keeps trailing zeros, so
+// 1234.50 with pip size 2 is digit 0. It returns -1 when the pip size is
+// unknown (<= 0), as the displayed digit cannot be told then.
+func LastDigit(quote float64, pipSize int) int {
+	if pipSize <= 0 {
+		return -1
+	}
+	s := strconv.FormatFloat(quote, 'f', pipSize, 64)
+	return int(s[len(s)-1] - '0')
+}
+
+// PipDecimals converts a pip value from active_symbols (e.g. 0.001) to the
+// number of decimal places it implies (3).
+func PipDecimals(pip float64) int {
+	if pip <= 0 || pip >= 1 {
+		return 0
+	}
+	return int(math.Round(-math.Log10(pip)))
+}
+
+// DigitStats keeps the most recent last digits of one symbol and derives
+// frequency, streak and uniformity statistics from them. It is safe for
+// concurrent use.
+type DigitStats struct {
+	mu      sync.Mutex
+	symbol  string
+	pipSize int
+	digits  []int // ring buffer of up to MaxDigitWindow digits
+	next    int
+	full    bool
+}
+
+// DigitSnapshot is a point-in-time view of a symbol's digit statistics.
+type DigitSnapshot struct {
+	Symbol      string      `json:"symbol"`
+	PipSize     int         `json:"pip_size"`
+	Samples     int         `json:"samples"`
+	LastDigit   int         `json:"last_digit"`
+	Counts      [10]int     `json:"counts"`
+	Frequencies [10]float64 `json:"frequencies"`
+	Even        int         `json:"even"`
+	Odd         int         `json:"odd"`
+	// Current run of the same digit and of the same parity, ending at the last tick
+	DigitStreak  int `json:"digit_streak"`
+	ParityStreak int `json:"parity_streak"`
+	// Histograms of completed and current run lengths: length -> number of runs
+	DigitStreaks  map[int]int `json:"digit_streaks"`
+	ParityStreaks map[int]int `json:"parity_streaks"`
+	// Chi-square test of the counts against a uniform distribution (9 degrees of freedom)
+	ChiSquare float64 `json:"chi_square"`
+	PValue    float64 `json:"p_value"`
+	Uniform   bool    `json:"uniform"` // PValue >= 0.05
+}
+
+// NewDigitStats creates an empty tracker for symbol.
+func NewDigitStats(symbol string) *DigitStats {
+	return &DigitStats{symbol: symbol, digits: make([]int, MaxDigitWindow)}
+}
+
+// Add records the last digit of quote and returns it. A positive pipSize
+// updates the precision used for this and later quotes; without one the
+// symbol's known precision is used. While the precision is unknown quotes
+// are not recorded and -1 is returned.
+func (d *DigitStats) Add(quote float64, pipSize int) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if pipSize > 0 {
+		d.pipSize = pipSize
+		rememberPipSize(d.symbol, pipSize)
+	} else if d.pipSize <= 0 {
+		d.pipSize = knownPipSize(d.symbol)
+	}
+	digit := LastDigit(quote, d.pipSize)
+	if digit < 0 {
+		return -1
+	}
+	d.digits[d.next] = digit
+	d.next = (d.next + 1) % len(d.digits)
+	if d.next == 0 {
+		d.full = true
+	}
+	return digit
+}
+
+// PipSize returns the precision last reported for the symbol, or 0 if unknown.
+func (d *DigitStats) PipSize() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.pipSize
+}
+
+// recent returns up to n digits, oldest first. Callers hold d.mu.
+func (d *DigitStats) recent(n int) []int {
+	size := d.next
+	if d.full {
+		size = len(d.digits)
+	}
+	if n <= 0 || n > size {
+		n = size
+	}
+	out := make([]int, n)
+	start := d.next - n
+	if start < 0 {
+		start += len(d.digits)
+	}
+	for i := range out {
+		out[i] = d.digits[(start+i)%len(d.digits)]
+	}
+	return out
+}
+
+// Snapshot computes statistics over the last window digits (0 uses
+// DefaultDigitWindow).
+func (d *DigitStats) Snapshot(window int) DigitSnapshot {
+	if window <= 0 {
+		window = DefaultDigitWindow
+	}
+	d.mu.Lock()
+	digits := d.recent(window)
+	snap := DigitSnapshot{
+		Symbol:        d.symbol,
+		PipSize:       d.pipSize,
+		Samples:       len(digits),
+		DigitStreaks:  map[int]int{},
+		ParityStreaks: map[int]int{},
+	}
+	d.mu.Unlock()
+
+	if len(digits) == 0 {
+		return snap
+	}
+
+	for i, digit := range digits {
+		snap.Counts[digit]++
+		if digit%2 == 0 {
+			snap.Even++
+		} else {
+			snap.Odd++
+		}
+
+		if i > 0 && digits[i-1] == digit {
+			snap.DigitStreak++
+		} else {
+			if snap.DigitStreak > 0 {
+				snap.DigitStreaks[snap.DigitStreak]++
+			}
+			snap.DigitStreak = 1
+		}
+		if i > 0 && digits[i-1]%2 == digit%2 {
+			snap.ParityStreak++
+		} else {
+			if snap.ParityStreak > 0 {
+				snap.ParityStreaks[snap.ParityStreak]++
+			}
+			snap.ParityStreak = 1
+		}
+	}
+	snap.DigitStreaks[snap.DigitStreak]++
+	snap.ParityStreaks[snap.ParityStreak]++
+	snap.LastDigit = digits[len(digits)-1]
+
+	n := float64(len(digits))
+	expected := n / 10
+	for digit, count := range snap.Counts {
+		snap.Frequencies[digit] = float64(count) / n
+		snap.ChiSquare += (float64(count) - expected) * (float64(count) - expected) / expected
+	}
+	snap.PValue = chiSquarePValue(snap.ChiSquare, 9)
+	snap.Uniform = snap.PValue >= digitUniformAlpha
+	return snap
+}
+
+// toMap converts a snapshot to plain values for the script runtime.
+func (s DigitSnapshot) toMap() map[string]interface{} {
+	data, _ := json.Marshal(s)
+	var m map[string]interface{}
+	json.Unmarshal(data, &m)
+	return m
+}
+
+// digitRegistry holds one DigitStats per symbol for the process, shared by
+// the strategies and the web API.
+var digitRegistry = struct {
+	sync.Mutex
+	stats map[string]*DigitStats
+}{stats: map[string]*DigitStats{}}
+
+// DigitStatsFor returns the process-wide tracker for symbol, creating it on first use.
+func DigitStatsFor(symbol string) *DigitStats {
+	digitRegistry.Lock()
+	defer digitRegistry.Unlock()
+	d, ok := digitRegistry.stats[symbol]
+	if !ok {
+		d = NewDigitStats(symbol)
+		digitRegistry.stats[symbol] = d
+	}
+	return d
+}
+
+// chiSquarePValue is the probability of a chi-square statistic at least x
+// with df degrees of freedom.
+func chiSquarePValue(x float64, df int) float64 {
+	if x <= 0 {
+		return 1
+	}
+	return gammaQ(float64(df)/2, x/2)
+}
+
+// gammaQ is the regularized upper incomplete gamma function Q(a, x), using
+// the series expansion below a+1 and a continued fraction above it.
+func gammaQ(a, x float64) float64 {
+	const (
+		eps     = 1e-14
+		tiny    = 1e-300
+		maxIter = 1000
+	)
+	lg, _ := math.Lgamma(a)
+	prefix := math.Exp(-x + a*math.Log(x) - lg)
+
+	if x < a+1 {
+		ap, sum := a, 1/a
+		del := sum
+		for i := 0; i < maxIter; i++ {
+			ap++
+			del *= x / ap
+			sum += del
+			if math.Abs(del) < math.Abs(sum)*eps {
+				break
+			}
+		}
+		return 1 - sum*prefix
+	}
+
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for i := 1; i <= maxIter; i++ {
+		an := -float64(i) * (float64(i) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		del := d * c
+		h *= del
+		if math.Abs(del-1) < eps {
+			break
+		}
+	}
+	return prefix * h
+}
@@ -0,0 +1,75 @@
+package strategy
+
+import "testing"
+
+func TestLastDigit(t *testing.T) {
+	tests := []struct {
+		name    string
+		quote   float64
+		pipSize int
+		want    int
+	}{
+		{"trailing zero", 1234.50, 2, 0},
+		{"trailing zero below one", 0.10, 2, 0},
+		{"round number", 5000.00, 2, 0},
+		{"three decimals", 99.999, 3, 9},
+		{"one decimal", 5000.1, 1, 1},
+		{"four decimals with trailing zero", 1.2340, 4, 0},
+		{"binary rounding", 0.1 + 0.2, 2, 0},
+		{"last digit kept", 6789.12, 2, 2},
+		{"negative quote", -12.35, 2, 5},
+		{"unknown pip size", 1234.5, 0, -1},
+		{"negative pip size", 1234.5, -1, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LastDigit(tt.quote, tt.pipSize); got != tt.want {
+				t.Errorf("LastDigit(%v, %d) = %d, want %d", tt.quote, tt.pipSize, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPipDecimals(t *testing.T) {
+	tests := []struct {
+		pip  float64
+		want int
+	}{
+		{0.01, 2},
+		{0.001, 3},
+		{0.0001, 4},
+		{0.1, 1},
+		{1, 0},
+		{0, 0},
+	}
+	for _, tt := range tests {
+		if got := PipDecimals(tt.pip); got != tt.want {
+			t.Errorf("PipDecimals(%v) = %d, want %d", tt.pip, got, tt.want)
+		}
+	}
+}
+
+func TestDigitStatsAddUsesKnownPipSize(t *testing.T) {
+	const symbol = "TEST_DIGITS"
+	d := NewDigitStats(symbol)
+
+	if got := d.Add(1234.5, 0); got != -1 {
+		t.Fatalf("Add with unknown precision = %d, want -1", got)
+	}
+	if n := d.Snapshot(MaxDigitWindow).Samples; n != 0 {
+		t.Fatalf("recorded %d samples with unknown precision, want 0", n)
+	}
+
+	if got := d.Add(1234.51, 2); got != 1 {
+		t.Fatalf("Add(1234.51, 2) = %d, want 1", got)
+	}
+	// Later quotes without a pip size keep the reported precision
+	if got := d.Add(1234.50, 0); got != 0 {
+		t.Fatalf("Add(1234.50, 0) = %d, want 0", got)
+	}
+
+	// A new tracker for the same symbol picks up the remembered precision
+	if got := NewDigitStats(symbol).Add(1234.50, 0); got != 0 {
+		t.Fatalf("Add on a new tracker = %d, want 0", got)
+	}
+}
@@ -0,0 +1,201 @@
+package strategy
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+
+	"deriv_trade/database"
+
+	"github.com/ksysoev/deriv-api"
+	"github.com/ksysoev/deriv-api/schema"
+)
+
+// Early exit reasons recorded on trades.
+const (
+	ExitReasonBidPercent   = "bid_percent"
+	ExitReasonAdverseTicks = "adverse_ticks"
+	ExitReasonDuration     = "duration"
+	ExitReasonTrailing     = "trailing_take_profit"
+	ExitReasonManual       = "manual"
+)
+
+// DefaultExitSellTolerance is how far, in percent, a sale may fill below
+// the bid it was decided on when Config.ExitSellTolerance is 0.
+const DefaultExitSellTolerance = 1.0
+
+// ValidateEarlyExit checks the early exit rules shared by all strategies.
+// 0 disables a rule, or uses DefaultExitSellTolerance for the tolerance.
+func ValidateEarlyExit(bidPercent float64, adverseTicks int, sellTolerance float64) error {
+	if bidPercent < 0 || bidPercent > 100 {
+		return fmt.Errorf("exit bid percent must be between 0 and 100")
+	}
+	if adverseTicks < 0 {
+		return fmt.Errorf("exit adverse ticks must not be negative")
+	}
+	if sellTolerance < 0 || sellTolerance >= 100 {
+		return fmt.Errorf("exit sell tolerance must be between 0 and 100")
+	}
+	return nil
+}
+
+// earlyExit sells one open contract before expiry. The configured rules are
+// checked on every proposal_open_contract update while the contract is
+// valid to sell: the bid reaching Config.ExitBidPercent of the payout, or
+// the bid falling on Config.ExitAdverseTicks updates in a row. Strategies
+// with their own exit logic call sell directly.
+//
+// Sells are sent without blocking the contract stream, with the bid at the
+// moment of the decision less Config.ExitSellTolerance as the lowest price
+// Deriv may fill them at. The sale price is compared with that bid to
+// report slippage; a failed sell is logged, counted and kept for the
+// settled trade, and lets the rules fire again on a later update.
+type earlyExit struct {
+	api           *deriv.DerivAPI
+	contractID    int
+	bidPercent    float64
+	adverseTicks  int
+	sellTolerance float64 // percent below the bid
+
+	against int // consecutive updates with a falling bid
+	lastBid float64
+
+	mu       sync.Mutex
+	selling  bool
+	reason   string
+	bid      float64 // bid when the last sell was sent
+	soldFor  float64
+	sold     bool
+	failures int
+	lastErr  error // last failed sell
+}
+
+func newEarlyExit(api *deriv.DerivAPI, config Config, contractID int) *earlyExit {
+	tolerance := config.ExitSellTolerance
+	if tolerance <= 0 {
+		tolerance = DefaultExitSellTolerance
+	}
+	return &earlyExit{
+		api:           api,
+		contractID:    contractID,
+		bidPercent:    config.ExitBidPercent,
+		adverseTicks:  config.ExitAdverseTicks,
+		sellTolerance: tolerance,
+	}
+}
+
+// observe checks the exit rules against a contract update and sells when
+// one of them fires.
+func (e *earlyExit) observe(poc *schema.ProposalOpenContractRespProposalOpenContract) {
+	if poc.BidPrice == nil {
+		return
+	}
+	bid := *poc.BidPrice
+	if e.lastBid > 0 {
+		switch {
+		case bid < e.lastBid:
+			e.against++
+		case bid > e.lastBid:
+			e.against = 0
+		}
+	}
+	e.lastBid = bid
+
+	if poc.IsValidToSell == nil || *poc.IsValidToSell != 1 || e.pending() {
+		return
+	}
+	if e.bidPercent > 0 && poc.Payout != nil && *poc.Payout > 0 && bid >= *poc.Payout*e.bidPercent/100 {
+		log.Printf("Early exit on contract %d: bid %.2f >= %.0f%% of payout %.2f. Selling...", e.contractID, bid, e.bidPercent, *poc.Payout)
+		e.sell(ExitReasonBidPercent, bid)
+		return
+	}
+	if e.adverseTicks > 0 && e.against >= e.adverseTicks {
+		log.Printf("Early exit on contract %d: bid fell %d updates in a row to %.2f. Selling...", e.contractID, e.against, bid)
+		e.sell(ExitReasonAdverseTicks, bid)
+	}
+}
+
+// pending reports whether a sell has been sent and not failed.
+func (e *earlyExit) pending() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.selling || e.sold
+}
+
+// sell sends a sell for the contract unless one is already in flight,
+// without waiting for the result. bid is the price the decision was made
+// on.
+func (e *earlyExit) sell(reason string, bid float64) {
+	if !e.begin(reason, bid) {
+		return
+	}
+	go e.send()
+}
+
+// sellNow is sell for callers that need the outcome: it waits for the sale
+// and returns the price the contract was sold for.
+func (e *earlyExit) sellNow(reason string, bid float64) (float64, error) {
+	if !e.begin(reason, bid) {
+		return 0, fmt.Errorf("contract %d is already being sold", e.contractID)
+	}
+	return e.send()
+}
+
+func (e *earlyExit) begin(reason string, bid float64) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.selling || e.sold {
+		return false
+	}
+	e.selling = true
+	e.reason = reason
+	e.bid = bid
+	return true
+}
+
+// minPrice is the lowest sale price accepted for a sell decided on bid,
+// rounded down to cents.
+func (e *earlyExit) minPrice(bid float64) float64 {
+	return math.Max(0, math.Floor(bid*(100-e.sellTolerance))/100)
+}
+
+func (e *earlyExit) send() (float64, error) {
+	e.mu.Lock()
+	price := e.minPrice(e.bid)
+	e.mu.Unlock()
+	resp, err := e.api.Sell(schema.Sell{Sell: e.contractID, Price: price})
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.selling = false
+	if err != nil {
+		e.failures++
+		e.lastErr = err
+		log.Printf("Sell failed for contract %d (%s, attempt %d, min price %.2f): %v", e.contractID, e.reason, e.failures, price, err)
+		return 0, err
+	}
+	e.sold = true
+	if resp.Sell != nil && resp.Sell.SoldFor != nil {
+		e.soldFor = *resp.Sell.SoldFor
+	}
+	log.Printf("Contract %d sold (%s): bid %.2f, sold for %.2f, slippage %.2f", e.contractID, e.reason, e.bid, e.soldFor, e.soldFor-e.bid)
+	return e.soldFor, nil
+}
+
+// annotate records the contract id and the early exit, if any, on the
+// settled trade, including the last failed sell.
+func (e *earlyExit) annotate(trade *database.Trade) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	trade.ContractID = strconv.Itoa(e.contractID)
+	trade.SellFailures = e.failures
+	if e.lastErr != nil {
+		trade.SellError = e.lastErr.Error()
+	}
+	if e.sold {
+		trade.ExitReason = e.reason
+		trade.ExitSlippage = e.soldFor - e.bid
+	}
+}
@@ -4,9 +4,10 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"math"
 	"sync"
 
+	"deriv_trade/database"
+
 	"github.com/ksysoev/deriv-api"
 	"github.com/ksysoev/deriv-api/schema"
 )
@@ -15,20 +16,16 @@ type HigherLowerStrategy struct {
 	api    *deriv.DerivAPI
 	config Config
 
-	mu           sync.Mutex
-	currentStake float64
-	totalProfit  float64
-	maxPnL       float64
-	balance      float64
+	orders *orderManager
+
+	mu      sync.Mutex
+	balance float64
 }
 
 func NewHigherLowerStrategy(api *deriv.DerivAPI, config Config) *HigherLowerStrategy {
-	return &HigherLowerStrategy{
-		api:          api,
-		config:       config,
-		currentStake: config.InitialStake,
-		maxPnL:       0,
-	}
+	s := &HigherLowerStrategy{api: api, config: config}
+	s.orders = newOrderManager(config, s.handleSettlement)
+	return s
 }
 
 func (s *HigherLowerStrategy) Execute(ctx context.Context) error {
@@ -40,6 +37,16 @@ func (s *HigherLowerStrategy) Execute(ctx context.Context) error {
 
 	go s.monitorBalance(ctx)
 
+	// Keep track of quotes for basic trend
+	var quotes []float64
+
+	warmUp(s.api, s.config, func(quote float64) {
+		quotes = append(quotes, quote)
+		if len(quotes) > s.config.StreakThreshold+1 {
+			quotes = quotes[1:]
+		}
+	})
+
 	reqTicks := schema.Ticks{Ticks: s.config.Symbol}
 	_, tickSub, err := s.api.SubscribeTicks(reqTicks)
 	if err != nil {
@@ -47,9 +54,6 @@ func (s *HigherLowerStrategy) Execute(ctx context.Context) error {
 	}
 	defer tickSub.Forget()
 
-	// Keep track of quotes for basic trend
-	var quotes []float64
-
 	for {
 		select {
 		case <-ctx.Done():
@@ -66,6 +70,7 @@ func (s *HigherLowerStrategy) Execute(ctx context.Context) error {
 			}
 
 			log.Printf("Quote: %.4f", quote)
+			s.orders.tick()
 
 			if len(quotes) < s.config.StreakThreshold+1 {
 				continue
@@ -129,19 +134,25 @@ func (s *HigherLowerStrategy) Execute(ctx context.Context) error {
 				}
 			}
 
+			var contractType schema.ProposalContractType
+			var barrier string
 			if isUp {
 				log.Printf("Up Trend. Buying Higher (Barrier +%s)...", barrierVal)
-				stake := s.getStake()
-				barrier := "+" + barrierVal
-				go s.placeTrade(ctx, schema.ProposalContractTypeCALL, stake, barrier)
-				quotes = nil
+				contractType, barrier = schema.ProposalContractTypeCALL, "+"+barrierVal
 			} else if isDown {
 				log.Printf("Down Trend. Buying Lower (Barrier -%s)...", barrierVal)
-				stake := s.getStake()
-				barrier := "-" + barrierVal
-				go s.placeTrade(ctx, schema.ProposalContractTypePUT, stake, barrier)
-				quotes = nil
+				contractType, barrier = schema.ProposalContractTypePUT, "-"+barrierVal
+			} else {
+				continue
 			}
+
+			ticket, err := s.orders.enter()
+			if err != nil {
+				log.Printf("Trade skipped: %v", err)
+				continue
+			}
+			go s.placeTrade(ctx, contractType, ticket, barrier)
+			quotes = nil
 		}
 	}
 }
@@ -177,33 +188,12 @@ func (s *HigherLowerStrategy) monitorBalance(ctx context.Context) {
 	}
 }
 
-func (s *HigherLowerStrategy) getStake() float64 {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	return s.currentStake
-}
-
-func (s *HigherLowerStrategy) placeTrade(ctx context.Context, contractType schema.ProposalContractType, stake float64, barrier string) {
-	amount := stake
+func (s *HigherLowerStrategy) placeTrade(ctx context.Context, contractType schema.ProposalContractType, ticket orderTicket, barrier string) {
+	amount := ticket.stake
 	duration := s.config.Duration
 	basis := schema.ProposalBasisStake
 	currency := "USD"
 
-	// Map Config Unit to Schema Unit
-	var dUnit schema.ProposalDurationUnit
-	switch s.config.DurationUnit {
-	case "s":
-		dUnit = schema.ProposalDurationUnitS
-	case "m":
-		dUnit = schema.ProposalDurationUnitM
-	case "h":
-		dUnit = schema.ProposalDurationUnitH
-	case "d":
-		dUnit = schema.ProposalDurationUnitD
-	default:
-		dUnit = schema.ProposalDurationUnitT
-	}
-
 	reqProp := schema.Proposal{
 		Proposal:     1,
 		Amount:       &amount,
@@ -211,14 +201,15 @@ func (s *HigherLowerStrategy) placeTrade(ctx context.Context, contractType schem
 		ContractType: contractType,
 		Currency:     currency,
 		Duration:     &duration,
-		DurationUnit: dUnit,
+		DurationUnit: proposalDurationUnit(s.config.DurationUnit),
 		Symbol:       s.config.Symbol,
 		Barrier:      &barrier,
 	}
 
 	propResp, err := s.api.Proposal(reqProp)
 	if err != nil {
-		log.Printf("Proposal error: %v. Resetting stake.", err)
+		log.Printf("Proposal error: %v", err)
+		s.orders.release(ctx, ticket)
 		return
 	}
 
@@ -227,12 +218,15 @@ func (s *HigherLowerStrategy) placeTrade(ctx context.Context, contractType schem
 		Price: amount,
 	}
 
-	_, buySub, err := s.api.SubscribeBuy(buyReq)
+	buyResp, buySub, err := s.api.SubscribeBuy(buyReq)
 	if err != nil {
 		log.Printf("Buy error: %v", err)
+		s.orders.release(ctx, ticket)
 		return
 	}
 	defer buySub.Forget()
+	exit := newEarlyExit(s.api, s.config, buyResp.Buy.ContractId)
+	logContractOpened(buyResp.Buy.ContractId)
 
 	log.Printf("Trade placed (%s %s). Stake: %.2f.", contractType, barrier, amount)
 
@@ -240,58 +234,28 @@ func (s *HigherLowerStrategy) placeTrade(ctx context.Context, contractType schem
 		if *contract.ProposalOpenContract.IsSold == 1 {
 			profit := *contract.ProposalOpenContract.Profit
 			status := fmt.Sprintf("%v", contract.ProposalOpenContract.Status.Value)
-			s.handleTradeResult(ctx, profit, status)
+			s.handleTradeResult(ctx, ticket, string(contractType), profit, status, exit)
 			return
 		}
+		exit.observe(contract.ProposalOpenContract)
 	}
+	// The stream ended without a settlement
+	s.orders.release(ctx, ticket)
+}
+
+func (s *HigherLowerStrategy) handleTradeResult(ctx context.Context, ticket orderTicket, contractType string, profit float64, status string, exit *earlyExit) {
+	trade := database.Trade{ContractType: contractType, Profit: profit, Status: status}
+	exit.annotate(&trade)
+	s.orders.settle(ctx, ticket, trade)
 }
 
-func (s *HigherLowerStrategy) handleTradeResult(ctx context.Context, profit float64, status string) {
+// handleSettlement logs a settlement in entry order and stops the bot when
+// it ended the session.
+func (s *HigherLowerStrategy) handleSettlement(ctx context.Context, st settlement) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.totalProfit += profit
-	if s.totalProfit > s.maxPnL {
-		s.maxPnL = s.totalProfit
-	}
-	// Calculate Trailing Stop Level
-	var trailingStopLevel float64
-	if s.config.UseTrailingStop {
-		trailingStopLevel = s.maxPnL - s.config.StopLoss
-	} else {
-		trailingStopLevel = -s.config.StopLoss
-	}
-
-	log.Printf("Result: %s | Profit: %.2f | Total PnL: %.2f | Balance: %.2f", status, profit, s.totalProfit, s.balance)
-
-	stopLossMsg := "Trailing Stop Loss Hit"
-	if !s.config.UseTrailingStop {
-		stopLossMsg = "Stop Loss Hit"
-	}
-
-	if s.totalProfit <= trailingStopLevel {
-		log.Printf("%s! Total PnL: %.2f <= Stop Level: %.2f. Stopping...", stopLossMsg, s.totalProfit, trailingStopLevel)
-		log.Fatalf("%s - Stopping Bot", stopLossMsg)
-	}
-	if s.totalProfit >= s.config.TargetProfit {
-		log.Printf("Target Profit Hit! Total PnL: %.2f. Stopping...", s.totalProfit)
-		log.Fatal("Target Profit Hit - Stopping Bot")
-	}
-
-	if profit > 0 {
-		s.currentStake = s.config.InitialStake
-	} else {
-		newStake := s.currentStake * s.config.MartingaleMulti
-		newStake = math.Round(newStake*100) / 100
-
-		allowedLoss := s.totalProfit - trailingStopLevel
-		if newStake > allowedLoss {
-			log.Printf("Martingale stake (%.2f) exceeds allowed risk buffer (%.2f). Reverting to Initial Stake.", newStake, allowedLoss)
-			s.currentStake = s.config.InitialStake
-		} else {
-			s.currentStake = newStake
-		}
-	}
-
-	log.Printf("Next Stake: %.2f", s.currentStake)
+	log.Printf("Result: %s | Profit: %.2f | Total PnL: %.2f | Balance: %.2f", st.trade.Status, st.trade.Profit, st.totalProfit, s.balance)
+	stopOnReason(s.config, st)
+	log.Printf("Next Stake: %.2f", st.nextStake)
 }
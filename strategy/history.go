@@ -0,0 +1,184 @@
+package strategy
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+
+	"deriv_trade/database"
+
+	"github.com/ksysoev/deriv-api"
+	"github.com/ksysoev/deriv-api/schema"
+)
+
+// fetchTickHistory returns the last count quotes for symbol, oldest first,
+// and the symbol's pip size (decimal places), 0 if not reported.
+func fetchTickHistory(api *deriv.DerivAPI, symbol string, count int) ([]float64, int, error) {
+	req := schema.TicksHistory{
+		TicksHistory: symbol,
+		End:          "latest",
+		Count:        count,
+		Style:        schema.TicksHistoryStyleTicks,
+	}
+
+	resp, err := api.TicksHistory(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.History == nil {
+		return nil, 0, fmt.Errorf("no history returned for %s", symbol)
+	}
+	pipSize := 0
+	if resp.PipSize != nil {
+		pipSize = int(*resp.PipSize)
+		rememberPipSize(symbol, pipSize)
+	} else {
+		pipSize = SymbolPipSize(api, symbol)
+	}
+	return resp.History.Prices, pipSize, nil
+}
+
+// pipSizes holds the decimal places of each symbol seen with ticks or looked
+// up in active_symbols, for quotes that arrive without them (e.g. stored
+// ticks).
+var pipSizes = struct {
+	sync.Mutex
+	m map[string]int
+}{m: map[string]int{}}
+
+func rememberPipSize(symbol string, pipSize int) {
+	if symbol == "" || pipSize <= 0 {
+		return
+	}
+	pipSizes.Lock()
+	pipSizes.m[symbol] = pipSize
+	pipSizes.Unlock()
+}
+
+// knownPipSize returns the remembered decimal places of symbol, 0 if none.
+func knownPipSize(symbol string) int {
+	pipSizes.Lock()
+	defer pipSizes.Unlock()
+	return pipSizes.m[symbol]
+}
+
+// SymbolPipSize returns the decimal places symbol is quoted with, looking
+// them up in active_symbols when they are not known yet; 0 when they
+// cannot be found.
+func SymbolPipSize(api *deriv.DerivAPI, symbol string) int {
+	if pipSize := knownPipSize(symbol); pipSize > 0 {
+		return pipSize
+	}
+	pipSize := symbolPipSize(api, symbol)
+	rememberPipSize(symbol, pipSize)
+	return pipSize
+}
+
+// symbolPipSize looks up the decimal places of symbol in active_symbols,
+// returning 0 when it cannot be found.
+func symbolPipSize(api *deriv.DerivAPI, symbol string) int {
+	resp, err := api.ActiveSymbols(schema.ActiveSymbols{ActiveSymbols: schema.ActiveSymbolsActiveSymbolsBrief})
+	if err != nil {
+		log.Printf("Failed to look up pip size for %s: %v", symbol, err)
+		return 0
+	}
+	for _, s := range resp.ActiveSymbols {
+		if s.Symbol == symbol {
+			return PipDecimals(s.Pip)
+		}
+	}
+	return 0
+}
+
+// TickHistory returns the last count quotes for symbol, oldest first, and
+// the symbol's pip size.
+func TickHistory(api *deriv.DerivAPI, symbol string, count int) ([]float64, int, error) {
+	return fetchTickHistory(api, symbol, count)
+}
+
+// warmUp replays config.WarmupTicks of recent history through feed so the
+// strategy starts with context. No trades are placed while warming up.
+// A failed fetch is logged and the strategy simply starts cold. The
+// symbol's digit statistics are seeded from the same history.
+func warmUp(api *deriv.DerivAPI, config Config, feed func(quote float64)) {
+	if config.WarmupTicks <= 0 {
+		return
+	}
+
+	quotes, pipSize, err := fetchTickHistory(api, config.Symbol, config.WarmupTicks)
+	if err != nil {
+		log.Printf("Warm-up failed, starting without history: %v", err)
+		return
+	}
+	if pipSize <= 0 {
+		log.Printf("Warm-up skipped: pip size of %s is unknown, so its digits cannot be told", config.Symbol)
+		return
+	}
+
+	digits := DigitStatsFor(config.Symbol)
+	for _, quote := range quotes {
+		digits.Add(quote, pipSize)
+		feed(quote)
+	}
+	log.Printf("Warm-up complete: replayed %d ticks of %s history", len(quotes), config.Symbol)
+}
+
+// maxHistoryPage is the most ticks ticks_history returns per request.
+const maxHistoryPage = 5000
+
+// DownloadTicks fetches the last count ticks for symbol, oldest first,
+// paging backwards through ticks_history so counts above one page work.
+func DownloadTicks(api *deriv.DerivAPI, symbol string, count int) ([]database.Tick, error) {
+	var ticks []database.Tick
+	end := "latest"
+	pipSize := -1
+	for len(ticks) < count {
+		page := count - len(ticks)
+		if page > maxHistoryPage {
+			page = maxHistoryPage
+		}
+
+		resp, err := api.TicksHistory(schema.TicksHistory{
+			TicksHistory: symbol,
+			End:          end,
+			Count:        page,
+			Style:        schema.TicksHistoryStyleTicks,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if resp.History == nil || len(resp.History.Times) == 0 {
+			break
+		}
+		if pipSize < 0 {
+			if resp.PipSize != nil {
+				pipSize = int(*resp.PipSize)
+				rememberPipSize(symbol, pipSize)
+			} else {
+				pipSize = SymbolPipSize(api, symbol)
+			}
+			if pipSize <= 0 {
+				return nil, fmt.Errorf("pip size of %s is unknown", symbol)
+			}
+		}
+
+		batch := make([]database.Tick, 0, len(resp.History.Times))
+		for i, epoch := range resp.History.Times {
+			if i >= len(resp.History.Prices) {
+				break
+			}
+			batch = append(batch, database.Tick{Symbol: symbol, Epoch: int64(epoch), Quote: resp.History.Prices[i], PipSize: pipSize})
+		}
+		ticks = append(batch, ticks...)
+
+		if len(resp.History.Times) < page {
+			break // reached the start of the available history
+		}
+		end = strconv.Itoa(resp.History.Times[0] - 1)
+	}
+	if len(ticks) == 0 {
+		return nil, fmt.Errorf("no history returned for %s", symbol)
+	}
+	return ticks, nil
+}
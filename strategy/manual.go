@@ -0,0 +1,434 @@
+package strategy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"deriv_trade/database"
+
+	"github.com/ksysoev/deriv-api"
+	"github.com/ksysoev/deriv-api/schema"
+)
+
+// ManualStrategyName is the strategy recorded on trades placed by hand.
+const ManualStrategyName = "manual"
+
+// manualProposalTTL is how long a quote can be bought after it was priced.
+const manualProposalTTL = time.Minute
+
+// Errors returned by ManualTrader for requests it refuses rather than fails.
+var (
+	ErrManualLimit    = errors.New("session limit")
+	ErrManualNotFound = errors.New("not found")
+)
+
+// ManualContractTypes are the contract types that can be traded by hand.
+var ManualContractTypes = map[string]bool{
+	"CALL": true, "PUT": true,
+	"DIGITEVEN": true, "DIGITODD": true, "DIGITMATCH": true, "DIGITDIFF": true, "DIGITOVER": true, "DIGITUNDER": true,
+	"ONETOUCH": true, "NOTOUCH": true, "EXPIRYMISS": true, "EXPIRYRANGE": true, "UPORDOWN": true, "RANGE": true,
+	"MULTUP": true, "MULTDOWN": true,
+}
+
+// ManualOrder describes a single contract placed by hand.
+type ManualOrder struct {
+	ContractType string  `json:"contract_type"`
+	Symbol       string  `json:"symbol"`
+	Stake        float64 `json:"stake"`
+	Duration     int     `json:"duration,omitempty"` // not used by multipliers
+	DurationUnit string  `json:"duration_unit,omitempty"`
+	Barrier      string  `json:"barrier,omitempty"`
+	Barrier2     string  `json:"barrier2,omitempty"`
+	Prediction   *int    `json:"prediction,omitempty"` // digit contracts
+	Multiplier   int     `json:"multiplier,omitempty"` // MULTUP/MULTDOWN
+}
+
+// ManualQuote is a priced proposal that can be bought until it expires.
+type ManualQuote struct {
+	ProposalID string    `json:"proposal_id"`
+	AskPrice   float64   `json:"ask_price"`
+	Payout     float64   `json:"payout"`
+	Spot       float64   `json:"spot"`
+	Longcode   string    `json:"longcode"`
+	Expires    time.Time `json:"expires"`
+}
+
+// ManualPosition is an open contract placed by hand.
+type ManualPosition struct {
+	ContractID   int       `json:"contract_id"`
+	ContractType string    `json:"contract_type"`
+	Symbol       string    `json:"symbol"`
+	Stake        float64   `json:"stake"`
+	BuyPrice     float64   `json:"buy_price"`
+	BidPrice     float64   `json:"bid_price"`
+	Profit       float64   `json:"profit"`
+	ValidToSell  bool      `json:"valid_to_sell"`
+	OpenedAt     time.Time `json:"opened_at"`
+}
+
+// ManualSale is the outcome of selling a position by hand.
+type ManualSale struct {
+	ContractID int     `json:"contract_id"`
+	BidPrice   float64 `json:"bid_price"`
+	SoldFor    float64 `json:"sold_for"`
+	Slippage   float64 `json:"slippage"`
+}
+
+// ManualStatus summarizes the manual trading session.
+type ManualStatus struct {
+	TotalPnL   float64          `json:"total_pnl"`
+	StopReason string           `json:"stop_reason,omitempty"` // set once the session limits stopped trading
+	Positions  []ManualPosition `json:"positions"`
+}
+
+// ValidateManualOrder checks an order before it is priced.
+func ValidateManualOrder(order ManualOrder) error {
+	if !ManualContractTypes[order.ContractType] {
+		return fmt.Errorf("unsupported contract type %q", order.ContractType)
+	}
+	if !KnownSymbols[order.Symbol] {
+		return fmt.Errorf("unknown symbol %q", order.Symbol)
+	}
+	if order.Stake <= 0 {
+		return fmt.Errorf("stake must be positive")
+	}
+	if isMultiplier(order.ContractType) {
+		if order.Multiplier <= 0 {
+			return fmt.Errorf("%s needs a multiplier", order.ContractType)
+		}
+		return nil
+	}
+	if order.Duration <= 0 {
+		return fmt.Errorf("duration must be positive")
+	}
+	switch order.DurationUnit {
+	case "", "t", "s", "m", "h", "d":
+	default:
+		return fmt.Errorf("invalid duration unit %q", order.DurationUnit)
+	}
+	if NeedsPrediction(order.ContractType) {
+		if order.Prediction == nil {
+			return fmt.Errorf("%s needs a prediction", order.ContractType)
+		}
+		return ValidateDigitPrediction(order.ContractType, *order.Prediction)
+	}
+	return ValidateBarriers(order.ContractType, order.Barrier, order.Barrier2)
+}
+
+func isMultiplier(contractType string) bool {
+	return contractType == "MULTUP" || contractType == "MULTDOWN"
+}
+
+// manualProposal builds the proposal request for an order.
+func manualProposal(order ManualOrder) schema.Proposal {
+	amount := order.Stake
+	basis := schema.ProposalBasisStake
+	req := schema.Proposal{
+		Proposal:     1,
+		Amount:       &amount,
+		Basis:        &basis,
+		ContractType: schema.ProposalContractType(order.ContractType),
+		Currency:     "USD",
+		Symbol:       order.Symbol,
+	}
+	if isMultiplier(order.ContractType) {
+		mult := float64(order.Multiplier)
+		req.Multiplier = &mult
+		return req
+	}
+
+	duration := order.Duration
+	req.Duration = &duration
+	req.DurationUnit = proposalDurationUnit(order.DurationUnit)
+	switch {
+	case NeedsPrediction(order.ContractType):
+		barrier := strconv.Itoa(*order.Prediction)
+		req.Barrier = &barrier
+	case order.Barrier != "":
+		barrier := order.Barrier
+		req.Barrier = &barrier
+		if order.Barrier2 != "" {
+			barrier2 := order.Barrier2
+			req.Barrier2 = &barrier2
+		}
+	}
+	return req
+}
+
+// manualQuote is a proposal waiting to be bought.
+type manualQuote struct {
+	order   ManualOrder
+	price   float64
+	expires time.Time
+}
+
+// manualContract is an open position and its exit.
+type manualContract struct {
+	ticket   orderTicket
+	position ManualPosition
+	order    ManualOrder
+	exit     *earlyExit
+}
+
+// ManualTrader places and closes single contracts on request, next to the
+// bots. Entries go through the same orderManager as the built-in
+// strategies, so Config.MaxOpenPositions and the entry spacing apply, and
+// each settlement counts towards Config.StopLoss and Config.TargetProfit.
+// Once those stop the session no new contracts are bought; open ones can
+// still be sold. Stakes come from the orders, but never exceed the room
+// left above the stop level. Settled trades are saved with Strategy
+// "manual".
+type ManualTrader struct {
+	api    *deriv.DerivAPI
+	config Config
+	orders *orderManager
+	notify func(string)
+
+	mu          sync.Mutex
+	quotes      map[string]manualQuote
+	open        map[int]*manualContract
+	totalProfit float64
+	stopLevel   float64
+	stopReason  string
+	balance     float64
+}
+
+// NewManualTrader creates a trader on an authorized API connection. notify,
+// if set, receives a line for each buy, sale and settlement.
+func NewManualTrader(api *deriv.DerivAPI, config Config, notify func(string)) *ManualTrader {
+	config.StrategyName = ManualStrategyName
+	t := &ManualTrader{
+		api:       api,
+		config:    config,
+		notify:    notify,
+		quotes:    map[string]manualQuote{},
+		open:      map[int]*manualContract{},
+		stopLevel: newMoneyManager(config).stopLevel(),
+	}
+	t.orders = newOrderManager(config, t.handleSettlement)
+	return t
+}
+
+func (t *ManualTrader) logf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	log.Print(msg)
+	if t.notify != nil {
+		t.notify(msg)
+	}
+}
+
+// MonitorBalance keeps the account balance saved with trades current until
+// ctx is done.
+func (t *ManualTrader) MonitorBalance(ctx context.Context) {
+	sub := schema.BalanceSubscribe(1)
+	_, balanceSub, err := t.api.SubscribeBalance(schema.Balance{Subscribe: &sub})
+	if err != nil {
+		log.Printf("Manual trading: failed to subscribe to balance: %v", err)
+		return
+	}
+	defer balanceSub.Forget()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case b, ok := <-balanceSub.Stream:
+			if !ok {
+				return
+			}
+			t.mu.Lock()
+			t.balance = b.Balance.Balance
+			t.mu.Unlock()
+		}
+	}
+}
+
+// Proposal prices an order.
+func (t *ManualTrader) Proposal(order ManualOrder) (ManualQuote, error) {
+	if err := ValidateManualOrder(order); err != nil {
+		return ManualQuote{}, err
+	}
+	resp, err := t.api.Proposal(manualProposal(order))
+	if err != nil {
+		return ManualQuote{}, fmt.Errorf("proposal failed: %w", err)
+	}
+	p := resp.Proposal
+	quote := ManualQuote{
+		ProposalID: p.Id,
+		AskPrice:   p.AskPrice,
+		Payout:     p.Payout,
+		Spot:       p.Spot,
+		Longcode:   p.Longcode,
+		Expires:    time.Now().Add(manualProposalTTL),
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id, q := range t.quotes {
+		if time.Now().After(q.expires) {
+			delete(t.quotes, id)
+		}
+	}
+	t.quotes[p.Id] = manualQuote{order: order, price: p.AskPrice, expires: quote.Expires}
+	return quote, nil
+}
+
+// Buy buys a quote returned by Proposal, checking the session limits first.
+func (t *ManualTrader) Buy(ctx context.Context, proposalID string) (ManualPosition, error) {
+	t.mu.Lock()
+	q, ok := t.quotes[proposalID]
+	if ok {
+		delete(t.quotes, proposalID)
+	}
+	stopReason := t.stopReason
+	room := t.totalProfit - t.stopLevel
+	t.mu.Unlock()
+
+	if !ok || time.Now().After(q.expires) {
+		return ManualPosition{}, fmt.Errorf("%w: unknown or expired proposal %q", ErrManualNotFound, proposalID)
+	}
+	if stopReason != "" {
+		return ManualPosition{}, fmt.Errorf("%w: manual trading stopped (%s)", ErrManualLimit, stopReason)
+	}
+	if q.price > room {
+		return ManualPosition{}, fmt.Errorf("%w: price %.2f exceeds the %.2f left above the stop level", ErrManualLimit, q.price, room)
+	}
+
+	ticket, err := t.orders.enter()
+	if err != nil {
+		return ManualPosition{}, fmt.Errorf("%w: %v", ErrManualLimit, err)
+	}
+	ticket.stake = q.order.Stake
+
+	buyResp, buySub, err := t.api.SubscribeBuy(schema.Buy{Buy: proposalID, Price: q.price})
+	if err != nil {
+		t.orders.release(ctx, ticket)
+		return ManualPosition{}, fmt.Errorf("buy failed: %w", err)
+	}
+
+	c := &manualContract{
+		ticket: ticket,
+		order:  q.order,
+		exit:   newEarlyExit(t.api, Config{}, buyResp.Buy.ContractId),
+		position: ManualPosition{
+			ContractID:   buyResp.Buy.ContractId,
+			ContractType: q.order.ContractType,
+			Symbol:       q.order.Symbol,
+			Stake:        q.order.Stake,
+			BuyPrice:     buyResp.Buy.BuyPrice,
+			OpenedAt:     time.Now(),
+		},
+	}
+	t.mu.Lock()
+	t.open[c.position.ContractID] = c
+	t.mu.Unlock()
+	logContractOpened(c.position.ContractID)
+
+	t.logf("Manual trade placed: %s %s, contract %d, stake %.2f", q.order.ContractType, q.order.Symbol, c.position.ContractID, q.order.Stake)
+
+	// Settlement is tracked beyond the request that placed the trade
+	go t.watch(context.Background(), c, buySub)
+	return c.position, nil
+}
+
+// watch follows an open contract until it settles.
+func (t *ManualTrader) watch(ctx context.Context, c *manualContract, buySub *deriv.Subsciption[schema.BuyResp, schema.ProposalOpenContractResp]) {
+	defer buySub.Forget()
+	defer func() {
+		t.mu.Lock()
+		delete(t.open, c.position.ContractID)
+		t.mu.Unlock()
+	}()
+
+	for contract := range buySub.Stream {
+		poc := contract.ProposalOpenContract
+		if poc.IsSold != nil && *poc.IsSold == 1 {
+			trade := database.Trade{
+				Strategy:     ManualStrategyName,
+				Symbol:       c.order.Symbol,
+				ContractType: c.order.ContractType,
+				Profit:       *poc.Profit,
+				Status:       fmt.Sprintf("%v", poc.Status.Value),
+				Duration:     c.order.Duration,
+				DurationUnit: c.order.DurationUnit,
+				Barrier:      c.order.Barrier,
+				ContractID:   strconv.Itoa(c.position.ContractID),
+			}
+			if c.order.Prediction != nil {
+				trade.Prediction = *c.order.Prediction
+			}
+			c.exit.annotate(&trade)
+			t.orders.settle(ctx, c.ticket, trade)
+			return
+		}
+
+		t.mu.Lock()
+		if poc.BidPrice != nil {
+			c.position.BidPrice = *poc.BidPrice
+		}
+		if poc.Profit != nil {
+			c.position.Profit = *poc.Profit
+		}
+		c.position.ValidToSell = poc.IsValidToSell != nil && *poc.IsValidToSell == 1
+		t.mu.Unlock()
+	}
+	// The stream ended without a settlement
+	t.orders.release(ctx, c.ticket)
+}
+
+// Sell sells an open position at market.
+func (t *ManualTrader) Sell(contractID int) (ManualSale, error) {
+	t.mu.Lock()
+	c, ok := t.open[contractID]
+	var bid float64
+	if ok {
+		bid = c.position.BidPrice
+	}
+	t.mu.Unlock()
+	if !ok {
+		return ManualSale{}, fmt.Errorf("%w: no open manual contract %d", ErrManualNotFound, contractID)
+	}
+
+	soldFor, err := c.exit.sellNow(ExitReasonManual, bid)
+	if err != nil {
+		return ManualSale{}, fmt.Errorf("sell failed: %w", err)
+	}
+	t.logf("Manual sale: contract %d sold for %.2f (bid %.2f)", contractID, soldFor, bid)
+	return ManualSale{ContractID: contractID, BidPrice: bid, SoldFor: soldFor, Slippage: soldFor - bid}, nil
+}
+
+// Status returns the session PnL, why it stopped if it did, and the open
+// positions.
+func (t *ManualTrader) Status() ManualStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	status := ManualStatus{TotalPnL: t.totalProfit, StopReason: t.stopReason, Positions: []ManualPosition{}}
+	for _, c := range t.open {
+		status.Positions = append(status.Positions, c.position)
+	}
+	return status
+}
+
+// handleSettlement saves a settled manual trade and stops new entries once
+// the session limits are reached. Unlike the bots it never exits the process.
+func (t *ManualTrader) handleSettlement(ctx context.Context, st settlement) {
+	t.mu.Lock()
+	t.totalProfit = st.totalProfit
+	t.stopLevel = st.stopLevel
+	if st.reason != "" && t.stopReason == "" {
+		t.stopReason = st.reason
+	}
+	balance := t.balance
+	t.mu.Unlock()
+
+	saveSettlement(ctx, t.config, st, balance)
+	t.logf("Manual result: %s | Contract: %s | Profit: %.2f | Total PnL: %.2f", st.trade.Status, st.trade.ContractID, st.trade.Profit, st.totalProfit)
+	if st.reason != "" {
+		t.logf("Manual trading stopped (%s) at Total PnL %.2f", st.reason, st.totalProfit)
+	}
+}
@@ -0,0 +1,214 @@
+package strategy
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+const (
+	defaultSimSessions  = 10000
+	defaultSimMaxTrades = 10000
+	maxSimSessions      = 1000000
+	maxSimTrades        = 100000
+	simHistogramBuckets = 10
+)
+
+// SimulationOptions describes the sessions Simulate plays: independent
+// trades won with WinProbability and paying Payout times the stake, sized
+// and stopped by the same rules as handleTradeResult.
+type SimulationOptions struct {
+	WinProbability  float64 `json:"win_probability"`
+	Payout          float64 `json:"payout"` // profit ratio of a winning trade, e.g. 0.95
+	InitialStake    float64 `json:"initial_stake"`
+	MartingaleMulti float64 `json:"martingale"`
+	StopLoss        float64 `json:"stop_loss"`
+	TargetProfit    float64 `json:"target_profit"`
+	UseTrailingStop bool    `json:"use_trailing_stop"`
+	Sessions        int     `json:"sessions"`   // default 10000
+	MaxTrades       int     `json:"max_trades"` // per session before it counts as unfinished; default 10000
+	Seed            int64   `json:"seed"`
+}
+
+// HistogramBucket counts sessions whose value fell in [From, To).
+type HistogramBucket struct {
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Count int     `json:"count"`
+}
+
+// Distribution summarizes a per-session quantity across all sessions.
+type Distribution struct {
+	Mean      float64           `json:"mean"`
+	Median    float64           `json:"median"`
+	P90       float64           `json:"p90"`
+	P95       float64           `json:"p95"`
+	P99       float64           `json:"p99"`
+	Max       float64           `json:"max"`
+	Histogram []HistogramBucket `json:"histogram"`
+}
+
+// SimulationReport is the outcome of a Monte Carlo run.
+type SimulationReport struct {
+	Sessions    int     `json:"sessions"`
+	TargetHits  int     `json:"target_hits"`
+	StopHits    int     `json:"stop_hits"`
+	Unfinished  int     `json:"unfinished"` // reached MaxTrades without stopping
+	PTarget     float64 `json:"p_target"`
+	PStop       float64 `json:"p_stop"`
+	PUnfinished float64 `json:"p_unfinished"`
+	// ExpectedPnL is the mean final session PnL
+	ExpectedPnL float64      `json:"expected_pnl"`
+	MaxStake    float64      `json:"max_stake"` // largest stake any session placed
+	Length      Distribution `json:"length"`    // trades per session
+	Drawdown    Distribution `json:"drawdown"`  // peak-to-trough PnL per session
+}
+
+func (o *SimulationOptions) validate() error {
+	if o.Sessions == 0 {
+		o.Sessions = defaultSimSessions
+	}
+	if o.MaxTrades == 0 {
+		o.MaxTrades = defaultSimMaxTrades
+	}
+	switch {
+	case o.WinProbability < 0 || o.WinProbability > 1:
+		return fmt.Errorf("win_probability must be between 0 and 1")
+	case o.Payout <= 0:
+		return fmt.Errorf("payout must be positive")
+	case o.InitialStake <= 0:
+		return fmt.Errorf("initial_stake must be positive")
+	case o.MartingaleMulti <= 0:
+		return fmt.Errorf("martingale must be positive")
+	case o.StopLoss <= 0:
+		return fmt.Errorf("stop_loss must be positive")
+	case o.TargetProfit <= 0:
+		return fmt.Errorf("target_profit must be positive")
+	case o.Sessions < 0 || o.Sessions > maxSimSessions:
+		return fmt.Errorf("sessions must be between 1 and %d", maxSimSessions)
+	case o.MaxTrades < 0 || o.MaxTrades > maxSimTrades:
+		return fmt.Errorf("max_trades must be between 1 and %d", maxSimTrades)
+	}
+	return nil
+}
+
+// Simulate plays opts.Sessions independent sessions and reports how often
+// they reach the target versus the stop, how long they last and how deep
+// they draw down. The same Seed always gives the same report.
+func Simulate(ctx context.Context, opts SimulationOptions) (*SimulationReport, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	config := Config{
+		InitialStake:    opts.InitialStake,
+		MartingaleMulti: opts.MartingaleMulti,
+		StopLoss:        opts.StopLoss,
+		TargetProfit:    opts.TargetProfit,
+		UseTrailingStop: opts.UseTrailingStop,
+	}
+	rng := rand.New(rand.NewSource(opts.Seed))
+	report := &SimulationReport{Sessions: opts.Sessions}
+	lengths := make([]float64, opts.Sessions)
+	drawdowns := make([]float64, opts.Sessions)
+	totalPnL := 0.0
+
+	for i := 0; i < opts.Sessions; i++ {
+		if i%1000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+
+		mm := newMoneyManager(config)
+		reason := ""
+		trades := 0
+		peak, drawdown := 0.0, 0.0
+		for trades < opts.MaxTrades && reason == "" {
+			stake := mm.currentStake
+			if stake > report.MaxStake {
+				report.MaxStake = stake
+			}
+			profit := -stake
+			if rng.Float64() < opts.WinProbability {
+				profit = math.Round(stake*opts.Payout*100) / 100
+			}
+			reason = mm.record(profit)
+			trades++
+
+			if mm.totalProfit > peak {
+				peak = mm.totalProfit
+			}
+			if peak-mm.totalProfit > drawdown {
+				drawdown = peak - mm.totalProfit
+			}
+		}
+
+		switch reason {
+		case StopReasonTargetProfit:
+			report.TargetHits++
+		case StopReasonStopLoss:
+			report.StopHits++
+		default:
+			report.Unfinished++
+		}
+		lengths[i] = float64(trades)
+		drawdowns[i] = math.Round(drawdown*100) / 100
+		totalPnL += mm.totalProfit
+	}
+
+	n := float64(opts.Sessions)
+	report.PTarget = float64(report.TargetHits) / n
+	report.PStop = float64(report.StopHits) / n
+	report.PUnfinished = float64(report.Unfinished) / n
+	report.ExpectedPnL = math.Round(totalPnL/n*100) / 100
+	report.Length = distribution(lengths)
+	report.Drawdown = distribution(drawdowns)
+	return report, nil
+}
+
+// distribution sorts values in place and summarizes them.
+func distribution(values []float64) Distribution {
+	var d Distribution
+	if len(values) == 0 {
+		return d
+	}
+	sort.Float64s(values)
+	d.Mean, _ = meanStd(values)
+	d.Median = percentile(values, 0.5)
+	d.P90 = percentile(values, 0.9)
+	d.P95 = percentile(values, 0.95)
+	d.P99 = percentile(values, 0.99)
+	d.Max = values[len(values)-1]
+
+	lo := values[0]
+	width := (d.Max - lo) / simHistogramBuckets
+	if width == 0 {
+		d.Histogram = []HistogramBucket{{From: lo, To: d.Max, Count: len(values)}}
+		return d
+	}
+	d.Histogram = make([]HistogramBucket, simHistogramBuckets)
+	for i := range d.Histogram {
+		d.Histogram[i].From = lo + float64(i)*width
+		d.Histogram[i].To = lo + float64(i+1)*width
+	}
+	for _, v := range values {
+		b := int((v - lo) / width)
+		if b >= simHistogramBuckets {
+			b = simHistogramBuckets - 1 // the maximum lands in the last bucket
+		}
+		d.Histogram[b].Count++
+	}
+	return d
+}
+
+// percentile returns the nearest-rank percentile of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	idx := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return sorted[idx]
+}
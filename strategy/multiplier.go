@@ -4,9 +4,14 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 
+	"deriv_trade/database"
+
 	"github.com/ksysoev/deriv-api"
 	"github.com/ksysoev/deriv-api/schema"
 )
@@ -14,31 +19,44 @@ import (
 type MultiplierStrategy struct {
 	api    *deriv.DerivAPI
 	config Config
+	orders *orderManager
 
-	mu               sync.Mutex
-	totalProfit      float64
-	maxPnL           float64
-	balance          float64
-	activeContractID int64
+	mu      sync.Mutex
+	balance float64
+	open    map[int]bool // ids of the open contracts
 }
 
 func NewMultiplierStrategy(api *deriv.DerivAPI, config Config) *MultiplierStrategy {
-	return &MultiplierStrategy{
-		api:    api,
-		config: config,
-		maxPnL: 0,
-	}
+	s := &MultiplierStrategy{api: api, config: config, open: map[int]bool{}}
+	s.orders = newOrderManager(config, s.handleSettlement)
+	return s
 }
 
 func (s *MultiplierStrategy) Execute(ctx context.Context) error {
 	log.Printf("Starting Multiplier Strategy for %s (x%d)...", s.config.Symbol, s.config.Multiplier)
 
+	if err := ValidateMultiplierLimits(s.config.TakeProfit, s.config.TradeStopLoss, s.config.DealCancellation); err != nil {
+		return err
+	}
+	if err := ValidateTrailingTakeProfit(s.config.TrailActivation, s.config.TrailDistance); err != nil {
+		return err
+	}
+
 	if err := s.authorize(); err != nil {
 		return fmt.Errorf("authorization failed: %w", err)
 	}
 
 	go s.monitorBalance(ctx)
 
+	var quotes []float64
+
+	warmUp(s.api, s.config, func(quote float64) {
+		quotes = append(quotes, quote)
+		if len(quotes) > s.config.StreakThreshold+1 {
+			quotes = quotes[1:]
+		}
+	})
+
 	reqTicks := schema.Ticks{Ticks: s.config.Symbol}
 	_, tickSub, err := s.api.SubscribeTicks(reqTicks)
 	if err != nil {
@@ -46,8 +64,6 @@ func (s *MultiplierStrategy) Execute(ctx context.Context) error {
 	}
 	defer tickSub.Forget()
 
-	var quotes []float64
-
 	for {
 		select {
 		case <-ctx.Done():
@@ -57,11 +73,9 @@ func (s *MultiplierStrategy) Execute(ctx context.Context) error {
 				return fmt.Errorf("tick stream closed")
 			}
 
-			// Don't place new trade if one is active
-			s.mu.Lock()
-			active := s.activeContractID != 0
-			s.mu.Unlock()
-			if active {
+			// Don't place new trade while the position limit is reached
+			s.orders.tick()
+			if s.orders.ready() != nil {
 				continue
 			}
 
@@ -89,15 +103,24 @@ func (s *MultiplierStrategy) Execute(ctx context.Context) error {
 				}
 			}
 
+			var contractType schema.ProposalContractType
 			if isUp {
 				log.Printf("Up Trend. Buying MULTUP x%d...", s.config.Multiplier)
-				go s.placeTrade(ctx, schema.ProposalContractTypeMULTUP)
-				quotes = nil
+				contractType = schema.ProposalContractTypeMULTUP
 			} else if isDown {
 				log.Printf("Down Trend. Buying MULTDOWN x%d...", s.config.Multiplier)
-				go s.placeTrade(ctx, schema.ProposalContractTypeMULTDOWN)
-				quotes = nil
+				contractType = schema.ProposalContractTypeMULTDOWN
+			} else {
+				continue
+			}
+
+			ticket, err := s.orders.enter()
+			if err != nil {
+				log.Printf("Trade skipped: %v", err)
+				continue
 			}
+			go s.placeTrade(ctx, contractType, ticket)
+			quotes = nil
 		}
 	}
 }
@@ -133,10 +156,147 @@ func (s *MultiplierStrategy) monitorBalance(ctx context.Context) {
 	}
 }
 
-func (s *MultiplierStrategy) placeTrade(ctx context.Context, contractType schema.ProposalContractType) {
-	// Multipliers usually require currency, amount, multiplier, symbol.
-	// Duration is usually not allowed or optional (handled by stop out).
-	amount := s.config.InitialStake
+// DealCancellations are the deal cancellation windows multipliers accept.
+var DealCancellations = map[string]bool{"5m": true, "10m": true, "15m": true, "30m": true, "60m": true}
+
+// cancelMargin is how long before the deal cancellation window closes a
+// losing contract is cancelled.
+const cancelMargin = 5 * time.Second
+
+// ValidateMultiplierLimits checks the per-trade take profit, stop loss and
+// deal cancellation of a multiplier. Deriv does not allow a stop loss while
+// deal cancellation is active.
+func ValidateMultiplierLimits(takeProfit, stopLoss float64, cancellation string) error {
+	if takeProfit < 0 || stopLoss < 0 {
+		return fmt.Errorf("take profit and stop loss must not be negative")
+	}
+	if cancellation != "" && !DealCancellations[cancellation] {
+		return fmt.Errorf("invalid deal cancellation %q (use 5m, 10m, 15m, 30m or 60m)", cancellation)
+	}
+	if cancellation != "" && stopLoss > 0 {
+		return fmt.Errorf("stop loss cannot be combined with deal cancellation")
+	}
+	return nil
+}
+
+// ValidateTrailingTakeProfit checks the per-position trailing take profit
+// of a multiplier. distance 0 disables it; activation 0 arms it as soon as
+// the position is in profit.
+func ValidateTrailingTakeProfit(activation, distance float64) error {
+	if activation < 0 || distance < 0 {
+		return fmt.Errorf("trailing activation and distance must not be negative")
+	}
+	if activation > 0 && distance == 0 {
+		return fmt.Errorf("trailing activation needs a trail distance")
+	}
+	return nil
+}
+
+// profitTrail is the trailing take profit of one open multiplier. Once the
+// position's profit reaches the activation profit it follows the peak
+// profit at a fixed distance, and the position is closed when profit falls
+// back to that level.
+type profitTrail struct {
+	activation float64
+	distance   float64
+
+	armed bool
+	peak  float64
+	level float64 // profit at which the position is closed
+}
+
+// newProfitTrail returns nil when trailing is disabled.
+func newProfitTrail(activation, distance float64) *profitTrail {
+	if distance <= 0 {
+		return nil
+	}
+	return &profitTrail{activation: activation, distance: distance}
+}
+
+// update feeds the latest profit of the position. armed is true on the
+// update that activates the trail, raised when the level moved up and
+// breached when profit is at or below the level.
+func (t *profitTrail) update(profit float64) (armed, raised, breached bool) {
+	if !t.armed {
+		if profit <= 0 || profit < t.activation {
+			return false, false, false
+		}
+		t.armed = true
+		t.peak = profit
+		t.level = roundCents(profit - t.distance)
+		return true, false, false
+	}
+	if profit > t.peak {
+		t.peak = profit
+		if level := roundCents(profit - t.distance); level > t.level {
+			t.level = level
+			raised = true
+		}
+	}
+	return false, raised, profit <= t.level
+}
+
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// OpenContracts returns the ids of the strategy's open contracts.
+func (s *MultiplierStrategy) OpenContracts() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]int, 0, len(s.open))
+	for id := range s.open {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// UpdateLimits moves the take profit and stop loss of one of the
+// strategy's open contracts. A value of 0 leaves that limit unchanged.
+func (s *MultiplierStrategy) UpdateLimits(contractID int, takeProfit, stopLoss float64) error {
+	s.mu.Lock()
+	open := s.open[contractID]
+	s.mu.Unlock()
+	if !open {
+		return fmt.Errorf("no open contract %d", contractID)
+	}
+	return UpdateLimitOrder(s.api, contractID, takeProfit, stopLoss)
+}
+
+// UpdateLimitOrder sends contract_update for an open multiplier contract,
+// on a connection authorized for its account. A value of 0 leaves that
+// limit unchanged.
+func UpdateLimitOrder(api *deriv.DerivAPI, contractID int, takeProfit, stopLoss float64) error {
+	if takeProfit < 0 || stopLoss < 0 {
+		return fmt.Errorf("take profit and stop loss must not be negative")
+	}
+	if takeProfit == 0 && stopLoss == 0 {
+		return fmt.Errorf("take profit or stop loss is required")
+	}
+	var limits schema.ContractUpdateLimitOrder
+	if takeProfit > 0 {
+		limits.TakeProfit = takeProfit
+	}
+	if stopLoss > 0 {
+		limits.StopLoss = stopLoss
+	}
+	_, err := api.ContractUpdate(schema.ContractUpdate{
+		ContractId:     contractID,
+		ContractUpdate: 1,
+		LimitOrder:     limits,
+	})
+	if err != nil {
+		return fmt.Errorf("contract_update failed for %d: %w", contractID, err)
+	}
+	log.Printf("Contract %d limits updated: take profit %.2f, stop loss %.2f", contractID, takeProfit, stopLoss)
+	return nil
+}
+
+func (s *MultiplierStrategy) placeTrade(ctx context.Context, contractType schema.ProposalContractType, ticket orderTicket) {
+	// Multipliers have no fixed expiry: they close on the take profit, stop
+	// loss or stop out, or when sold after the configured duration.
+	amount := ticket.stake
 	basis := schema.ProposalBasisStake
 	currency := "USD"
 	mult := float64(s.config.Multiplier)
@@ -149,186 +309,210 @@ func (s *MultiplierStrategy) placeTrade(ctx context.Context, contractType schema
 		Currency:     currency,
 		Symbol:       s.config.Symbol,
 		Multiplier:   &mult,
-		// Multipliers might require cancellation, limit_order etc.
-		// For simple test, we leave them optional if API allows.
+	}
+	if s.config.TakeProfit > 0 || s.config.TradeStopLoss > 0 {
+		limits := &schema.ProposalLimitOrder{}
+		if s.config.TakeProfit > 0 {
+			tp := s.config.TakeProfit
+			limits.TakeProfit = &tp
+		}
+		if s.config.TradeStopLoss > 0 {
+			sl := s.config.TradeStopLoss
+			limits.StopLoss = &sl
+		}
+		reqProp.LimitOrder = limits
+	}
+	if s.config.DealCancellation != "" {
+		cancellation := s.config.DealCancellation
+		reqProp.Cancellation = &cancellation
 	}
 
 	propResp, err := s.api.Proposal(reqProp)
 	if err != nil {
 		log.Printf("Proposal error: %v.", err)
+		s.orders.release(ctx, ticket)
 		return
 	}
 
+	// The ask price includes the deal cancellation fee
 	buyReq := schema.Buy{
 		Buy:   propResp.Proposal.Id,
-		Price: amount,
+		Price: propResp.Proposal.AskPrice,
 	}
 
-	_, buySub, err := s.api.SubscribeBuy(buyReq)
+	buyResp, buySub, err := s.api.SubscribeBuy(buyReq)
 	if err != nil {
 		log.Printf("Buy error: %v", err)
+		s.orders.release(ctx, ticket)
 		return
 	}
 	defer buySub.Forget()
 
-	log.Printf("Trade open (%s). Multiplier: x%d. Waiting for exit...", contractType, s.config.Multiplier)
-
+	contractID := buyResp.Buy.ContractId
 	s.mu.Lock()
-	// We might store contract ID if we want to manually close it later
-	// For now, we just monitor updates.
-	s.activeContractID = 1 // Flag as active
+	s.open[contractID] = true
 	s.mu.Unlock()
-
 	defer func() {
 		s.mu.Lock()
-		s.activeContractID = 0
+		delete(s.open, contractID)
 		s.mu.Unlock()
 	}()
 
-	// Since we don't set TP/SL in proposal (simplification), we manually monitor?
-	// Actually Multipliers usually require explicit close or TP/SL.
-	// Let's implement a manual close after 'Duration' if specified, or just generic TP/SL logic if supported.
-	// For now, let's just watch it.
-	// *Critical*: If we don't close it, it stays open forever (until crash).
-	// We'll use the 'Result' monitor to exit.
-
-	// TIMEOUT / DURATION Logic (simulated)
-	// If config.Duration is set, we close after X seconds?
-	// The stream loop blocks. We need a way to sell.
+	log.Printf("Trade open (%s, contract %d). Multiplier: x%d. Take profit: %.2f, stop loss: %.2f, cancellation: %q.",
+		contractType, contractID, s.config.Multiplier, s.config.TakeProfit, s.config.TradeStopLoss, s.config.DealCancellation)
 
-	// Create a timer if Config.Duration > 0
+	// Sell after Duration seconds/minutes; tick durations count contract updates
 	var timeoutChan <-chan time.Time
-	if s.config.Duration > 0 {
+	if s.config.Duration > 0 && s.config.DurationUnit != "t" {
 		d := time.Duration(s.config.Duration) * time.Second
 		if s.config.DurationUnit == "m" {
 			d = time.Duration(s.config.Duration) * time.Minute
 		}
-		// If unit is 't' (ticks), we iterate ticks.
-		if s.config.DurationUnit == "t" {
-			// handled inside loop counting
-		} else {
-			timer := time.NewTimer(d)
-			defer timer.Stop()
-			timeoutChan = timer.C
-		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeoutChan = timer.C
 	}
 
-	contractID := int64(0)
 	ticksPassed := 0
+	cancelling := false // a cancel has been sent
+	expired := false    // the duration timer fired
+	bid := 0.0          // latest bid, the price sells are decided on
+	exit := newEarlyExit(s.api, s.config, contractID)
+	logContractOpened(contractID)
+	trail := newProfitTrail(s.config.TrailActivation, s.config.TrailDistance)
 
 	for {
 		select {
 		case <-timeoutChan:
 			log.Printf("Duration expired. Selling contract %d...", contractID)
-			s.sellContract(contractID)
+			expired = true
+			exit.sell(ExitReasonDuration, bid)
 			// Loop continues until sold status received
 		case contract, ok := <-buySub.Stream:
 			if !ok {
+				// The stream ended without a settlement
+				s.orders.release(ctx, ticket)
 				return
 			}
+			poc := contract.ProposalOpenContract
 
-			if contract.ProposalOpenContract.ContractId != nil {
-				contractID = int64(*contract.ProposalOpenContract.ContractId)
+			if *poc.IsSold == 1 {
+				profit := *poc.Profit
+				status := fmt.Sprintf("%v", poc.Status.Value)
+				s.handleTradeResult(ctx, ticket, string(contractType), contractID, profit, status, exit)
+				return // Trade finished
+			}
+			if poc.BidPrice != nil {
+				bid = *poc.BidPrice
+			}
+			ticksPassed++
+			if cancelling || exit.pending() {
+				continue
+			}
+			if expired {
+				// The sell on expiry failed; try again
+				exit.sell(ExitReasonDuration, bid)
+				continue
 			}
 
 			// Check ticks duration
-			if s.config.DurationUnit == "t" && s.config.Duration > 0 {
-				ticksPassed++
-				if ticksPassed >= s.config.Duration {
-					log.Printf("Tick limit reached (%d). Selling...", ticksPassed)
-					s.sellContract(contractID)
-					// Reset to avoid multiple sells? function handles it.
-					// Set ticksPassed to negative to stop spamming sell
-					ticksPassed = -1000
-				}
+			if s.config.DurationUnit == "t" && s.config.Duration > 0 && ticksPassed >= s.config.Duration {
+				log.Printf("Tick limit reached (%d). Selling contract %d...", ticksPassed, contractID)
+				exit.sell(ExitReasonDuration, bid)
+				continue
 			}
 
-			isSold := *contract.ProposalOpenContract.IsSold
-			if isSold == 1 {
-				profit := *contract.ProposalOpenContract.Profit
-				status := fmt.Sprintf("%v", contract.ProposalOpenContract.Status.Value)
-				s.handleTradeResult(ctx, profit, status)
-				return // Trade finished
+			if trail != nil && poc.Profit != nil {
+				if s.trailProfit(contractID, trail, poc, exit, bid) {
+					continue
+				}
 			}
 
-			// Optional: Manual TP/SL Check
-			currentProfit := *contract.ProposalOpenContract.Profit
-			// log.Printf("Current PnL: %.2f", currentProfit)
-
-			// Simple Stop Loss / Take Profit
-			if currentProfit >= s.config.TargetProfit/2 { // Example mini-target
-				log.Printf("Take Profit (manual) hit: %.2f. Selling...", currentProfit)
-				s.sellContract(contractID)
+			exit.observe(poc)
+			if exit.pending() {
+				continue
 			}
-			if currentProfit <= -s.config.InitialStake*0.5 { // Example stop
-				log.Printf("Stop Loss (manual) hit: %.2f. Selling...", currentProfit)
-				s.sellContract(contractID)
+
+			// Use deal cancellation on a losing contract just before its window closes
+			if poc.Cancellation != nil && poc.Cancellation.DateExpiry != nil &&
+				poc.IsValidToCancel != nil && *poc.IsValidToCancel == 1 &&
+				poc.Profit != nil && *poc.Profit < 0 {
+				expiry := time.Unix(int64(*poc.Cancellation.DateExpiry), 0)
+				if time.Until(expiry) <= cancelMargin {
+					log.Printf("Deal cancellation closing with contract %d at %.2f. Cancelling...", contractID, *poc.Profit)
+					s.cancelContract(contractID)
+					cancelling = true
+				}
 			}
 		}
 	}
 }
 
-func (s *MultiplierStrategy) sellContract(contractID int64) {
-	if contractID == 0 {
-		return
+// trailProfit moves the trailing take profit of an open contract with its
+// latest profit and reports whether the contract is being sold. While the
+// trail level is still a loss it is also set as the contract's native stop
+// loss, so it holds if the bot disconnects; a level in profit can only be
+// enforced by selling.
+func (s *MultiplierStrategy) trailProfit(contractID int, trail *profitTrail, poc *schema.ProposalOpenContractRespProposalOpenContract, exit *earlyExit, bid float64) bool {
+	profit := *poc.Profit
+	armed, raised, breached := trail.update(profit)
+	switch {
+	case armed:
+		log.Printf("Trailing take profit armed on contract %d: profit %.2f, trail level %.2f", contractID, profit, trail.level)
+	case raised:
+		log.Printf("Trailing take profit raised on contract %d: peak %.2f, trail level %.2f", contractID, trail.peak, trail.level)
+	}
+	if breached {
+		log.Printf("Trailing take profit hit on contract %d: profit %.2f <= trail level %.2f (peak %.2f). Selling...",
+			contractID, profit, trail.level, trail.peak)
+		exit.sell(ExitReasonTrailing, bid)
+		return true
 	}
-	// We need to call Sell API
-	// Since api instance is in struct, we spawn a goroutine or call it.
-	// sellReq := schema.SellExpired{SellExpired: 1} // No, that's for expired.
-	// We need generic Sell.
-	// deriv-api might have api.Sell(...)
 
-	// The library `ksysoev/deriv-api` likely supports Sell.
-	// Let's assume it does. If not, we are limited.
-	// Checking previous files: no Sell usage.
-	// I'll try `api.Sell(schema.Sell{Sell: contractID, Price: 0})` (Sell at market)
+	// Deriv rejects a stop loss while deal cancellation is active
+	cancellable := poc.IsValidToCancel != nil && *poc.IsValidToCancel == 1
+	if (armed || raised) && trail.level < 0 && !cancellable {
+		stopLoss := -trail.level
+		go func() {
+			if err := UpdateLimitOrder(s.api, contractID, 0, stopLoss); err != nil {
+				log.Printf("Trailing take profit: %v", err)
+			}
+		}()
+	}
+	return false
+}
 
+func (s *MultiplierStrategy) cancelContract(contractID int) {
 	go func() {
-		// Attempt to sell
-		// Note: schema.Sell struct usually takes `Sell` as the contract ID
-		price := 0.0
-		req := schema.Sell{
-			Sell:  int(contractID),
-			Price: price, // 0 for market
-		}
-		_, err := s.api.Sell(req)
-		if err != nil {
-			log.Printf("Failed to sell contract %d: %v", contractID, err)
+		if _, err := s.api.Cancel(schema.Cancel{Cancel: contractID}); err != nil {
+			log.Printf("Failed to cancel contract %d: %v", contractID, err)
 		}
 	}()
 }
 
-func (s *MultiplierStrategy) handleTradeResult(ctx context.Context, profit float64, status string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	s.totalProfit += profit
-	// Update balance estimation or trust stream
-
-	if s.totalProfit > s.maxPnL {
-		s.maxPnL = s.totalProfit
-	}
-	// Calculate Trailing Stop Level
-	var trailingStopLevel float64
-	if s.config.UseTrailingStop {
-		trailingStopLevel = s.maxPnL - s.config.StopLoss
-	} else {
-		trailingStopLevel = -s.config.StopLoss
-	}
-
-	log.Printf("Result: %s | Profit: %.2f | Total PnL: %.2f", status, profit, s.totalProfit)
-
-	stopLossMsg := "Trailing Stop Loss Hit"
-	if !s.config.UseTrailingStop {
-		stopLossMsg = "Stop Loss Hit"
+func (s *MultiplierStrategy) handleTradeResult(ctx context.Context, ticket orderTicket, contractType string, contractID int, profit float64, status string, exit *earlyExit) {
+	trade := database.Trade{
+		Strategy:     s.config.StrategyName,
+		Symbol:       s.config.Symbol,
+		ContractType: contractType,
+		Profit:       profit,
+		Status:       status,
+		Duration:     s.config.Duration,
+		DurationUnit: s.config.DurationUnit,
+		ContractID:   strconv.Itoa(contractID),
 	}
+	exit.annotate(&trade)
+	s.orders.settle(ctx, ticket, trade)
+}
 
-	if s.totalProfit <= trailingStopLevel {
-		log.Printf("%s! Total PnL: %.2f <= Stop Level: %.2f. Stopping...", stopLossMsg, s.totalProfit, trailingStopLevel)
-		log.Fatalf("%s - Stopping Bot", stopLossMsg)
-	}
+// handleSettlement logs a settlement in entry order and stops the bot when
+// it ended the session.
+func (s *MultiplierStrategy) handleSettlement(ctx context.Context, st settlement) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if s.totalProfit >= s.config.TargetProfit {
-		log.Fatal("Target Profit Hit - Stopping Bot")
-	}
+	log.Printf("Result: %s | Contract: %s | Profit: %.2f | Total PnL: %.2f", st.trade.Status, st.trade.ContractID, st.trade.Profit, st.totalProfit)
+	saveSettlement(ctx, s.config, st, s.balance)
+	stopOnReason(s.config, st)
+	log.Printf("Next Stake: %.2f", st.nextStake)
 }
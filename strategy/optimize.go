@@ -0,0 +1,314 @@
+package strategy
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+
+	"deriv_trade/database"
+)
+
+// OptimizeParams are the Config fields the optimizer can vary.
+var OptimizeParams = []string{"streak_threshold", "martingale", "barrier", "stop_loss"}
+
+// OptimizeMetrics are the ranking metrics Optimize understands.
+var OptimizeMetrics = []string{"net_pnl", "profit_factor", "max_drawdown", "sharpe"}
+
+// maxOptimizeCombinations caps the size of a single search.
+const maxOptimizeCombinations = 20000
+
+// ParamRange is the set of values to try for one parameter: either an
+// explicit list, or Min..Max in increments of Step. Random searches with
+// Step 0 draw anywhere in Min..Max.
+type ParamRange struct {
+	Values []float64 `json:"values,omitempty"`
+	Min    float64   `json:"min"`
+	Max    float64   `json:"max"`
+	Step   float64   `json:"step"`
+}
+
+// OptimizeOptions describes a parameter search.
+type OptimizeOptions struct {
+	Base    Config
+	Ranges  map[string]ParamRange
+	Mode    string  // "grid" (default) or "random"
+	Samples int     // combinations drawn in random mode
+	Metric  string  // one of OptimizeMetrics, default "net_pnl"
+	Payout  float64 // profit ratio of a winning contract; 0 uses the strategy default
+	Workers int     // parallel backtests; 0 uses one per CPU
+	Seed    int64   // random mode seed, for repeatable searches
+	Top     int     // results kept after ranking; 0 keeps all
+}
+
+// Candidates validates the options and returns the values tried per
+// parameter and every combination the search will backtest.
+func (o OptimizeOptions) Candidates() (map[string][]float64, []map[string]float64, error) {
+	if len(o.Ranges) == 0 {
+		return nil, nil, fmt.Errorf("no parameter ranges given")
+	}
+	if _, err := newBacktestSignal(o.Base); err != nil {
+		return nil, nil, err
+	}
+	if !contains(OptimizeMetrics, o.metric()) {
+		return nil, nil, fmt.Errorf("unknown metric %q", o.Metric)
+	}
+
+	names := make([]string, 0, len(o.Ranges))
+	for name := range o.Ranges {
+		if !contains(OptimizeParams, name) {
+			return nil, nil, fmt.Errorf("parameter %q cannot be optimized", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := make(map[string][]float64, len(names))
+	for _, name := range names {
+		r := o.Ranges[name]
+		v, err := r.expand(name, o.Mode == "random")
+		if err != nil {
+			return nil, nil, err
+		}
+		values[name] = v
+	}
+
+	var combos []map[string]float64
+	switch o.Mode {
+	case "", "grid":
+		total := 1
+		for _, name := range names {
+			total *= len(values[name])
+			if total > maxOptimizeCombinations {
+				return nil, nil, fmt.Errorf("grid has more than %d combinations; narrow the ranges or use random mode", maxOptimizeCombinations)
+			}
+		}
+		combos = []map[string]float64{{}}
+		for _, name := range names {
+			var next []map[string]float64
+			for _, combo := range combos {
+				for _, v := range values[name] {
+					c := make(map[string]float64, len(names))
+					for k, x := range combo {
+						c[k] = x
+					}
+					c[name] = v
+					next = append(next, c)
+				}
+			}
+			combos = next
+		}
+
+	case "random":
+		if o.Samples <= 0 || o.Samples > maxOptimizeCombinations {
+			return nil, nil, fmt.Errorf("samples must be between 1 and %d", maxOptimizeCombinations)
+		}
+		rng := rand.New(rand.NewSource(o.Seed))
+		for i := 0; i < o.Samples; i++ {
+			c := make(map[string]float64, len(names))
+			for _, name := range names {
+				r := o.Ranges[name]
+				if len(values[name]) > 0 {
+					c[name] = values[name][rng.Intn(len(values[name]))]
+				} else {
+					c[name] = roundParam(name, r.Min+rng.Float64()*(r.Max-r.Min))
+				}
+			}
+			combos = append(combos, c)
+		}
+
+	default:
+		return nil, nil, fmt.Errorf("unknown mode %q (use grid or random)", o.Mode)
+	}
+	return values, combos, nil
+}
+
+func (o OptimizeOptions) metric() string {
+	if o.Metric == "" {
+		return "net_pnl"
+	}
+	return o.Metric
+}
+
+// expand lists the values of a range. A continuous range (Step 0) in a
+// random search yields no values; the caller samples it directly.
+func (r ParamRange) expand(name string, random bool) ([]float64, error) {
+	if len(r.Values) > 0 {
+		out := make([]float64, len(r.Values))
+		for i, v := range r.Values {
+			out[i] = roundParam(name, v)
+		}
+		return out, nil
+	}
+	if r.Max < r.Min {
+		return nil, fmt.Errorf("parameter %s: max %v is below min %v", name, r.Max, r.Min)
+	}
+	if r.Step <= 0 {
+		if random {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("parameter %s: grid ranges need a positive step or explicit values", name)
+	}
+
+	var out []float64
+	for k := 0; ; k++ {
+		v := r.Min + float64(k)*r.Step
+		if v > r.Max+r.Step*1e-9 {
+			break
+		}
+		out = append(out, roundParam(name, v))
+		if len(out) > maxOptimizeCombinations {
+			return nil, fmt.Errorf("parameter %s: range has too many steps", name)
+		}
+	}
+	return out, nil
+}
+
+// roundParam snaps a value to the precision its Config field uses.
+func roundParam(name string, v float64) float64 {
+	if name == "streak_threshold" {
+		return math.Round(v)
+	}
+	return math.Round(v*1e6) / 1e6
+}
+
+// applyParams returns base with the combination's values filled in.
+func applyParams(base Config, params map[string]float64) (Config, error) {
+	config := base
+	for name, v := range params {
+		switch name {
+		case "streak_threshold":
+			if v < 1 {
+				return config, fmt.Errorf("streak_threshold must be at least 1")
+			}
+			config.StreakThreshold = int(v)
+		case "martingale":
+			if v <= 0 {
+				return config, fmt.Errorf("martingale must be positive")
+			}
+			config.MartingaleMulti = v
+		case "barrier":
+			if v <= 0 {
+				return config, fmt.Errorf("barrier must be positive")
+			}
+			config.Barrier = "+" + strconv.FormatFloat(v, 'f', -1, 64)
+		case "stop_loss":
+			if v <= 0 {
+				return config, fmt.Errorf("stop_loss must be positive")
+			}
+			config.StopLoss = v
+		}
+	}
+	return config, nil
+}
+
+// Optimize backtests every candidate combination over ticks in parallel and
+// returns them ranked best first by the chosen metric.
+func Optimize(ctx context.Context, opts OptimizeOptions, ticks []database.Tick) ([]database.OptimizationResult, error) {
+	_, combos, err := opts.Candidates()
+	if err != nil {
+		return nil, err
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	results := make([]database.OptimizationResult, len(combos))
+	valid := make([]bool, len(combos))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				config, err := applyParams(opts.Base, combos[i])
+				if err != nil {
+					continue // combinations outside a field's valid range are skipped
+				}
+				res, err := Backtest(config, ticks, opts.Payout)
+				if err != nil {
+					continue
+				}
+				results[i] = database.OptimizationResult{
+					Params:     combos[i],
+					Summary:    res.Summary,
+					StopReason: res.StopReason,
+				}
+				valid[i] = true
+			}
+		}()
+	}
+
+feed:
+	for i := range combos {
+		select {
+		case <-ctx.Done():
+			break feed
+		case jobs <- i:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ranked := make([]database.OptimizationResult, 0, len(results))
+	for i, r := range results {
+		if valid[i] {
+			ranked = append(ranked, r)
+		}
+	}
+	RankResults(ranked, opts.metric())
+	if opts.Top > 0 && len(ranked) > opts.Top {
+		ranked = ranked[:opts.Top]
+	}
+	return ranked, nil
+}
+
+// RankResults sorts results best first by metric, breaking ties on net PnL,
+// and numbers them from 1. Lower is better for max_drawdown. Parameter sets
+// that never traded rank last whatever the metric, as their empty summary
+// would otherwise look like a perfect drawdown.
+func RankResults(results []database.OptimizationResult, metric string) {
+	key := func(s database.BacktestSummary) float64 {
+		switch metric {
+		case "profit_factor":
+			return s.ProfitFactor
+		case "max_drawdown":
+			return -s.MaxDrawdown
+		case "sharpe":
+			return s.Sharpe
+		}
+		return s.NetPnL
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if traded := results[i].Summary.Trades > 0; traded != (results[j].Summary.Trades > 0) {
+			return traded
+		}
+		a, b := key(results[i].Summary), key(results[j].Summary)
+		if a != b {
+			return a > b
+		}
+		return results[i].Summary.NetPnL > results[j].Summary.NetPnL
+	})
+	for i := range results {
+		results[i].Rank = i + 1
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
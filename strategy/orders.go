@@ -0,0 +1,243 @@
+package strategy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"deriv_trade/database"
+)
+
+// orderManager decides when a strategy may open another contract and
+// applies settlements to the session's stake and PnL in entry order.
+//
+// At most Config.MaxOpenPositions contracts (default 1) are in flight, and
+// a new entry waits Config.MinEntryTicks ticks and Config.MinEntrySeconds
+// seconds after the previous one. Every entry takes a ticket carrying the
+// stake at that moment; settlements that arrive out of order are held back
+// until the earlier tickets settle or are released, so the stake sequence
+// only depends on the order of entries and their outcomes. Each applied
+// settlement is passed to onSettled, one at a time and in entry order.
+type orderManager struct {
+	applyMu   sync.Mutex // serializes onSettled calls
+	onSettled func(context.Context, settlement)
+
+	mu          sync.Mutex
+	money       *moneyManager
+	maxOpen     int
+	minTicks    int
+	minInterval time.Duration
+	now         func() time.Time // the clock entries are spaced by; simulated in backtests
+
+	open       int
+	entered    bool // an entry has been made, so the spacing gates apply
+	ticksSince int
+	lastEntry  time.Time
+
+	nextSeq  uint64
+	applySeq uint64
+	pending  map[uint64]*settlement // settled or released, waiting for earlier tickets
+}
+
+// orderTicket is an entry granted by orderManager.enter.
+type orderTicket struct {
+	seq   uint64
+	stake float64
+}
+
+// settlement is a settled contract once it has been applied to the session.
+// Released tickets never produce one.
+type settlement struct {
+	ticket      orderTicket
+	trade       database.Trade // as passed to settle; Profit is the contract's result
+	totalProfit float64
+	stopLevel   float64
+	nextStake   float64
+	reason      string // StopReasonStopLoss, StopReasonTargetProfit or ""
+	released    bool
+	resetStake  bool // released, and the stake goes back to Config.InitialStake
+}
+
+// newOrderManager creates the manager for a strategy session. onSettled
+// may be nil when the strategy only releases tickets.
+func newOrderManager(config Config, onSettled func(context.Context, settlement)) *orderManager {
+	maxOpen := config.MaxOpenPositions
+	if maxOpen <= 0 {
+		maxOpen = 1
+	}
+	return &orderManager{
+		onSettled:   onSettled,
+		money:       newMoneyManager(config),
+		maxOpen:     maxOpen,
+		minTicks:    config.MinEntryTicks,
+		minInterval: time.Duration(config.MinEntrySeconds) * time.Second,
+		now:         time.Now,
+		pending:     map[uint64]*settlement{},
+	}
+}
+
+// tick counts a live tick towards the spacing between entries.
+func (m *orderManager) tick() {
+	m.mu.Lock()
+	m.ticksSince++
+	m.mu.Unlock()
+}
+
+// ready reports why a new entry is not allowed yet, or nil when it is.
+func (m *orderManager) ready() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.readyLocked()
+}
+
+func (m *orderManager) readyLocked() error {
+	if m.open >= m.maxOpen {
+		return fmt.Errorf("%d/%d positions open", m.open, m.maxOpen)
+	}
+	if !m.entered {
+		return nil
+	}
+	if m.ticksSince < m.minTicks {
+		return fmt.Errorf("%d/%d ticks since last entry", m.ticksSince, m.minTicks)
+	}
+	if wait := m.minInterval - m.now().Sub(m.lastEntry); wait > 0 {
+		return fmt.Errorf("next entry allowed in %s", wait.Round(time.Second))
+	}
+	return nil
+}
+
+// enter reserves a position for a new contract and returns its ticket, or
+// the reason no entry is allowed yet.
+func (m *orderManager) enter() (orderTicket, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.readyLocked(); err != nil {
+		return orderTicket{}, err
+	}
+	m.open++
+	m.entered = true
+	m.ticksSince = 0
+	m.lastEntry = m.now()
+	t := orderTicket{seq: m.nextSeq, stake: m.money.currentStake}
+	m.nextSeq++
+	return t, nil
+}
+
+// release frees the position of a contract that never opened or whose
+// result does not feed the stake sequence.
+func (m *orderManager) release(ctx context.Context, t orderTicket) {
+	m.finish(ctx, &settlement{ticket: t, released: true})
+}
+
+// releaseResetStake releases a ticket and, once it is applied, sets the
+// stake back to Config.InitialStake.
+func (m *orderManager) releaseResetStake(ctx context.Context, t orderTicket) {
+	m.finish(ctx, &settlement{ticket: t, released: true, resetStake: true})
+}
+
+// settle frees the position of a settled contract. Its settlement is
+// applied once every earlier ticket has settled or been released.
+func (m *orderManager) settle(ctx context.Context, t orderTicket, trade database.Trade) {
+	m.finish(ctx, &settlement{ticket: t, trade: trade})
+}
+
+func (m *orderManager) finish(ctx context.Context, s *settlement) {
+	m.applyMu.Lock()
+	defer m.applyMu.Unlock()
+
+	m.mu.Lock()
+	m.open--
+	m.pending[s.ticket.seq] = s
+	applied := m.drainLocked()
+	m.mu.Unlock()
+
+	if m.onSettled == nil {
+		return
+	}
+	for _, st := range applied {
+		m.onSettled(ctx, st)
+	}
+}
+
+func (m *orderManager) drainLocked() []settlement {
+	var applied []settlement
+	for {
+		s, ok := m.pending[m.applySeq]
+		if !ok {
+			return applied
+		}
+		delete(m.pending, m.applySeq)
+		m.applySeq++
+		if s.released {
+			if s.resetStake {
+				m.money.currentStake = m.money.config.InitialStake
+			}
+			continue
+		}
+		s.reason = m.money.record(s.trade.Profit)
+		s.totalProfit = m.money.totalProfit
+		s.stopLevel = m.money.stopLevel()
+		s.nextStake = m.money.currentStake
+		applied = append(applied, *s)
+	}
+}
+
+// saveSettlement stores the trade of an applied settlement with the session
+// PnL it left behind.
+func saveSettlement(ctx context.Context, config Config, st settlement, balance float64) {
+	if config.DB == nil {
+		return
+	}
+	trade := st.trade
+	trade.Stake = st.ticket.stake
+	trade.LoginID = config.LoginID
+	trade.Balance = balance
+	trade.TotalPnL = st.totalProfit
+	trade.Timestamp = time.Now()
+	if err := config.DB.InsertTrade(ctx, &trade); err != nil {
+		log.Printf("Failed to save trade to database: %v", err)
+	}
+}
+
+// stopOnReason stops the bot when a settlement ended the session, exactly
+// as handleTradeResult always has.
+func stopOnReason(config Config, st settlement) {
+	switch st.reason {
+	case StopReasonStopLoss:
+		stopLossMsg := "Trailing Stop Loss Hit"
+		if !config.UseTrailingStop {
+			stopLossMsg = "Stop Loss Hit"
+		}
+		log.Printf("%s! Total PnL: %.2f <= Stop Level: %.2f. Stopping...", stopLossMsg, st.totalProfit, st.stopLevel)
+		log.Fatalf("%s - Stopping Bot", stopLossMsg)
+	case StopReasonTargetProfit:
+		log.Printf("Target Profit Hit! Total PnL: %.2f. Stopping...", st.totalProfit)
+		log.Fatal("Target Profit Hit - Stopping Bot")
+	}
+}
+
+// contractOpenedPrefix starts the log line written for every contract a
+// strategy buys, so the webserver can tell which bot opened a position.
+const contractOpenedPrefix = "Contract opened: "
+
+func logContractOpened(contractID int) {
+	log.Printf("%s%d", contractOpenedPrefix, contractID)
+}
+
+// ParseContractOpened returns the contract id of a bot log line written
+// when a contract was bought.
+func ParseContractOpened(line string) (int, bool) {
+	i := strings.Index(line, contractOpenedPrefix)
+	if i < 0 {
+		return 0, false
+	}
+	id, err := strconv.Atoi(strings.TrimSpace(line[i+len(contractOpenedPrefix):]))
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
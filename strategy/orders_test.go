@@ -0,0 +1,209 @@
+package strategy
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"deriv_trade/database"
+)
+
+func TestOrderManagerSequencesStakes(t *testing.T) {
+	config := Config{InitialStake: 1, MartingaleMulti: 2, StopLoss: 100, TargetProfit: 100, MaxOpenPositions: 3}
+
+	// Each step finishes one of three tickets entered at the initial stake
+	type step struct {
+		seq  int
+		kind string // "win", "loss", "release" or "reset"
+	}
+	tests := []struct {
+		name        string
+		steps       []step
+		wantSeqs    []uint64  // settlements passed to onSettled, in order
+		wantStakes  []float64 // their next stakes
+		wantEntered float64   // stake of the next entry
+	}{
+		{
+			name:        "in order",
+			steps:       []step{{0, "loss"}, {1, "loss"}, {2, "win"}},
+			wantSeqs:    []uint64{0, 1, 2},
+			wantStakes:  []float64{2, 4, 1},
+			wantEntered: 1,
+		},
+		{
+			name:        "reverse order",
+			steps:       []step{{2, "win"}, {1, "loss"}, {0, "loss"}},
+			wantSeqs:    []uint64{0, 1, 2},
+			wantStakes:  []float64{2, 4, 1},
+			wantEntered: 1,
+		},
+		{
+			name:        "later loss first",
+			steps:       []step{{1, "loss"}, {0, "win"}, {2, "loss"}},
+			wantSeqs:    []uint64{0, 1, 2},
+			wantStakes:  []float64{1, 2, 4},
+			wantEntered: 4,
+		},
+		{
+			name:        "release keeps the stake",
+			steps:       []step{{0, "loss"}, {1, "release"}, {2, "loss"}},
+			wantSeqs:    []uint64{0, 2},
+			wantStakes:  []float64{2, 4},
+			wantEntered: 4,
+		},
+		{
+			name:        "release before earlier settle",
+			steps:       []step{{1, "release"}, {2, "loss"}, {0, "loss"}},
+			wantSeqs:    []uint64{0, 2},
+			wantStakes:  []float64{2, 4},
+			wantEntered: 4,
+		},
+		{
+			name:        "release resets the stake",
+			steps:       []step{{0, "loss"}, {1, "reset"}, {2, "loss"}},
+			wantSeqs:    []uint64{0, 2},
+			wantStakes:  []float64{2, 2},
+			wantEntered: 2,
+		},
+		{
+			name:        "reset applied in entry order",
+			steps:       []step{{2, "loss"}, {1, "reset"}, {0, "loss"}},
+			wantSeqs:    []uint64{0, 2},
+			wantStakes:  []float64{2, 2},
+			wantEntered: 2,
+		},
+		{
+			name:        "reset as the last ticket",
+			steps:       []step{{2, "reset"}, {0, "loss"}, {1, "loss"}},
+			wantSeqs:    []uint64{0, 1},
+			wantStakes:  []float64{2, 4},
+			wantEntered: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seqs []uint64
+			var stakes []float64
+			m := newOrderManager(config, func(_ context.Context, st settlement) {
+				seqs = append(seqs, st.ticket.seq)
+				stakes = append(stakes, st.nextStake)
+			})
+			ctx := context.Background()
+
+			var tickets []orderTicket
+			for i := 0; i < 3; i++ {
+				ticket, err := m.enter()
+				if err != nil {
+					t.Fatalf("enter %d: %v", i, err)
+				}
+				if ticket.stake != config.InitialStake {
+					t.Fatalf("ticket %d stake = %.2f, want %.2f", i, ticket.stake, config.InitialStake)
+				}
+				tickets = append(tickets, ticket)
+			}
+			for _, s := range tt.steps {
+				ticket := tickets[s.seq]
+				switch s.kind {
+				case "win":
+					m.settle(ctx, ticket, database.Trade{Profit: ticket.stake * 0.9})
+				case "loss":
+					m.settle(ctx, ticket, database.Trade{Profit: -ticket.stake})
+				case "release":
+					m.release(ctx, ticket)
+				case "reset":
+					m.releaseResetStake(ctx, ticket)
+				}
+			}
+
+			if !reflect.DeepEqual(seqs, tt.wantSeqs) {
+				t.Errorf("settled %v, want %v", seqs, tt.wantSeqs)
+			}
+			if !reflect.DeepEqual(stakes, tt.wantStakes) {
+				t.Errorf("next stakes %v, want %v", stakes, tt.wantStakes)
+			}
+			ticket, err := m.enter()
+			if err != nil {
+				t.Fatalf("enter after settling: %v", err)
+			}
+			if ticket.stake != tt.wantEntered {
+				t.Errorf("next entry stake = %.2f, want %.2f", ticket.stake, tt.wantEntered)
+			}
+		})
+	}
+}
+
+func TestOrderManagerEntryGates(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+
+	// Each step advances the clock and ticks, then tries to enter
+	type step struct {
+		seconds int
+		ticks   int
+		release bool // release the oldest open ticket first
+		wantOK  bool
+	}
+	tests := []struct {
+		name   string
+		config Config
+		steps  []step
+	}{
+		{
+			name:   "one position by default",
+			config: Config{InitialStake: 1},
+			steps:  []step{{wantOK: true}, {wantOK: false}, {release: true, wantOK: true}},
+		},
+		{
+			name:   "max open positions",
+			config: Config{InitialStake: 1, MaxOpenPositions: 2},
+			steps:  []step{{wantOK: true}, {wantOK: true}, {wantOK: false}, {release: true, wantOK: true}, {wantOK: false}},
+		},
+		{
+			name:   "min entry ticks",
+			config: Config{InitialStake: 1, MaxOpenPositions: 5, MinEntryTicks: 3},
+			steps:  []step{{wantOK: true}, {ticks: 2, wantOK: false}, {ticks: 1, wantOK: true}, {ticks: 1, wantOK: false}},
+		},
+		{
+			name:   "min entry seconds",
+			config: Config{InitialStake: 1, MaxOpenPositions: 5, MinEntrySeconds: 10},
+			steps:  []step{{wantOK: true}, {seconds: 5, wantOK: false}, {seconds: 5, wantOK: true}, {seconds: 9, wantOK: false}},
+		},
+		{
+			name:   "ticks and seconds both apply",
+			config: Config{InitialStake: 1, MaxOpenPositions: 5, MinEntryTicks: 2, MinEntrySeconds: 10},
+			steps:  []step{{wantOK: true}, {seconds: 20, ticks: 1, wantOK: false}, {ticks: 1, wantOK: true}, {ticks: 5, seconds: 3, wantOK: false}},
+		},
+		{
+			name:   "refused entries do not reset spacing",
+			config: Config{InitialStake: 1, MaxOpenPositions: 5, MinEntryTicks: 2},
+			steps:  []step{{wantOK: true}, {ticks: 1, wantOK: false}, {ticks: 1, wantOK: true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := start
+			m := newOrderManager(tt.config, nil)
+			m.now = func() time.Time { return now }
+			ctx := context.Background()
+
+			var open []orderTicket
+			for i, s := range tt.steps {
+				now = now.Add(time.Duration(s.seconds) * time.Second)
+				for j := 0; j < s.ticks; j++ {
+					m.tick()
+				}
+				if s.release {
+					m.release(ctx, open[0])
+					open = open[1:]
+				}
+				ticket, err := m.enter()
+				if ok := err == nil; ok != s.wantOK {
+					t.Fatalf("step %d: enter allowed = %v, want %v (err %v)", i, ok, s.wantOK, err)
+				}
+				if err == nil {
+					open = append(open, ticket)
+				}
+			}
+		})
+	}
+}
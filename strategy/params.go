@@ -0,0 +1,255 @@
+package strategy
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// ParamSpec describes a tunable input declared by a custom strategy script.
+type ParamSpec struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"` // "number", "integer", "boolean" or "string"
+	Default     interface{} `json:"default"`
+	Min         *float64    `json:"min,omitempty"`
+	Max         *float64    `json:"max,omitempty"`
+	Description string      `json:"description,omitempty"`
+}
+
+// paramHeaderRe matches header comment declarations of the form
+//
+//	// @param threshold integer 3 min=1 max=10 Streak length before entering
+var paramHeaderRe = regexp.MustCompile(`^//\s*@param\s+([A-Za-z_$][\w$]*)\s+(\w+)\s+(\S+)(.*)$`)
+
+// paramsExportTimeout bounds the sandboxed run used to read exports.params.
+const paramsExportTimeout = time.Second
+
+// ScriptParams returns the parameter schema declared by a script, either in
+// "// @param" header comments or as an exports.params object of the form
+// { name: { type, default, min, max, description } }. Exported entries
+// override header entries with the same name.
+func ScriptParams(script string) ([]ParamSpec, error) {
+	specs, err := headerParams(script)
+	if err != nil {
+		return nil, err
+	}
+
+	exported, err := exportedParams(script)
+	if err != nil {
+		return nil, err
+	}
+	for _, spec := range exported {
+		replaced := false
+		for i := range specs {
+			if specs[i].Name == spec.Name {
+				specs[i] = spec
+				replaced = true
+			}
+		}
+		if !replaced {
+			specs = append(specs, spec)
+		}
+	}
+	return specs, nil
+}
+
+func headerParams(script string) ([]ParamSpec, error) {
+	var specs []ParamSpec
+	for _, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "//") {
+			break // the header ends at the first line of code
+		}
+		m := paramHeaderRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		spec := ParamSpec{Name: m[1], Type: strings.ToLower(m[2]), Default: m[3]}
+		var desc []string
+		for _, word := range strings.Fields(m[4]) {
+			switch {
+			case strings.HasPrefix(word, "min="):
+				v, err := strconv.ParseFloat(strings.TrimPrefix(word, "min="), 64)
+				if err != nil {
+					return nil, fmt.Errorf("param %s: invalid min %q", spec.Name, word)
+				}
+				spec.Min = &v
+			case strings.HasPrefix(word, "max="):
+				v, err := strconv.ParseFloat(strings.TrimPrefix(word, "max="), 64)
+				if err != nil {
+					return nil, fmt.Errorf("param %s: invalid max %q", spec.Name, word)
+				}
+				spec.Max = &v
+			default:
+				desc = append(desc, word)
+			}
+		}
+		spec.Description = strings.Join(desc, " ")
+
+		def, err := coerceParam(spec, spec.Default)
+		if err != nil {
+			return nil, err
+		}
+		spec.Default = def
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// exportedParams loads the script in a sandbox with a no-op buy() and reads
+// exports.params. Scripts that fail to load declare no exported params; the
+// checker reports the load error itself.
+func exportedParams(script string) ([]ParamSpec, error) {
+	vm := goja.New()
+	timer := time.AfterFunc(paramsExportTimeout, func() {
+		vm.Interrupt("params export timed out")
+	})
+	defer timer.Stop()
+
+	bindScriptGlobals(vm, Config{}, NewDigitStats(""),
+		func(string, float64, int) {},
+		func(interface{}) {},
+		func() bool { return false },
+	)
+	if _, err := vm.RunString(script); err != nil {
+		return nil, nil
+	}
+
+	exports := vm.Get("exports")
+	if exports == nil || goja.IsUndefined(exports) || goja.IsNull(exports) {
+		return nil, nil
+	}
+	params := exports.ToObject(vm).Get("params")
+	if params == nil || goja.IsUndefined(params) || goja.IsNull(params) {
+		return nil, nil
+	}
+	obj := params.ToObject(vm)
+
+	var specs []ParamSpec
+	for _, name := range obj.Keys() {
+		raw, ok := obj.Get(name).Export().(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("param %s: declaration must be an object", name)
+		}
+		spec := ParamSpec{Name: name, Type: "number", Default: raw["default"]}
+		if t, ok := raw["type"].(string); ok {
+			spec.Type = strings.ToLower(t)
+		}
+		if d, ok := raw["description"].(string); ok {
+			spec.Description = d
+		}
+		for key, dst := range map[string]**float64{"min": &spec.Min, "max": &spec.Max} {
+			if v, ok := raw[key]; ok {
+				f, ok := toFloat(v)
+				if !ok {
+					return nil, fmt.Errorf("param %s: %s must be a number", name, key)
+				}
+				*dst = &f
+			}
+		}
+
+		def, err := coerceParam(spec, spec.Default)
+		if err != nil {
+			return nil, err
+		}
+		spec.Default = def
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// ResolveParams merges supplied values over the schema defaults, converting
+// each to its declared type and enforcing min/max. Values for names missing
+// from the schema are dropped.
+func ResolveParams(specs []ParamSpec, values map[string]interface{}) (map[string]interface{}, error) {
+	resolved := make(map[string]interface{}, len(specs))
+	for _, spec := range specs {
+		v, ok := values[spec.Name]
+		if !ok || v == nil {
+			resolved[spec.Name] = spec.Default
+			continue
+		}
+		c, err := coerceParam(spec, v)
+		if err != nil {
+			return nil, err
+		}
+		resolved[spec.Name] = c
+	}
+	return resolved, nil
+}
+
+// ResolveScriptParams reads the schema declared by script and resolves values against it.
+func ResolveScriptParams(script string, values map[string]interface{}) (map[string]interface{}, error) {
+	specs, err := ScriptParams(script)
+	if err != nil {
+		return nil, err
+	}
+	return ResolveParams(specs, values)
+}
+
+func coerceParam(spec ParamSpec, v interface{}) (interface{}, error) {
+	switch spec.Type {
+	case "number", "integer":
+		f, ok := toFloat(v)
+		if !ok {
+			return nil, fmt.Errorf("param %s: %v is not a number", spec.Name, v)
+		}
+		if spec.Type == "integer" && f != float64(int64(f)) {
+			return nil, fmt.Errorf("param %s: %v is not an integer", spec.Name, v)
+		}
+		if spec.Min != nil && f < *spec.Min {
+			return nil, fmt.Errorf("param %s: %v is below the minimum %v", spec.Name, f, *spec.Min)
+		}
+		if spec.Max != nil && f > *spec.Max {
+			return nil, fmt.Errorf("param %s: %v is above the maximum %v", spec.Name, f, *spec.Max)
+		}
+		if spec.Type == "integer" {
+			return int64(f), nil
+		}
+		return f, nil
+	case "boolean":
+		switch b := v.(type) {
+		case bool:
+			return b, nil
+		case string:
+			parsed, err := strconv.ParseBool(b)
+			if err != nil {
+				return nil, fmt.Errorf("param %s: %q is not a boolean", spec.Name, b)
+			}
+			return parsed, nil
+		}
+		return nil, fmt.Errorf("param %s: %v is not a boolean", spec.Name, v)
+	case "string":
+		if v == nil {
+			return "", nil
+		}
+		return fmt.Sprintf("%v", v), nil
+	default:
+		return nil, fmt.Errorf("param %s: unknown type %q", spec.Name, spec.Type)
+	}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
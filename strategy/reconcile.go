@@ -0,0 +1,252 @@
+package strategy
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"deriv_trade/database"
+
+	"github.com/ksysoev/deriv-api"
+	"github.com/ksysoev/deriv-api/schema"
+)
+
+const (
+	// maxProfitTablePage is the most transactions profit_table returns per call.
+	maxProfitTablePage = 500
+	// maxProfitTableRows caps a single reconciliation download.
+	maxProfitTableRows = 20000
+	// profitTolerance is the largest profit difference treated as a match.
+	profitTolerance = 0.005
+	// UntaggedMatchWindow is how far apart a stored trade's timestamp and a
+	// contract's sell time may be for MatchUntagged to pair them. Bots
+	// timestamp trades when they see the settlement.
+	UntaggedMatchWindow = time.Minute
+)
+
+// SettledContract is one row of the account's profit table.
+type SettledContract struct {
+	ContractID   string    `json:"contract_id"`
+	ContractType string    `json:"contract_type"`
+	Symbol       string    `json:"symbol,omitempty"`
+	Status       string    `json:"status,omitempty"`
+	BuyPrice     float64   `json:"buy_price"`
+	SellPrice    float64   `json:"sell_price"`
+	Profit       float64   `json:"profit"`
+	PurchaseTime time.Time `json:"purchase_time"`
+	SellTime     time.Time `json:"sell_time"`
+}
+
+// ProfitMismatch is a stored trade whose profit differs from the profit
+// Deriv reports for the same contract.
+type ProfitMismatch struct {
+	Trade    database.Trade
+	Contract SettledContract
+}
+
+// DownloadProfitTable fetches the contracts settled between from and to,
+// oldest first, paging through profit_table.
+func DownloadProfitTable(api *deriv.DerivAPI, from, to time.Time) ([]SettledContract, error) {
+	dateFrom := strconv.FormatInt(from.Unix(), 10)
+	dateTo := strconv.FormatInt(to.Unix(), 10)
+	description := schema.ProfitTableDescription(1)
+
+	var contracts []SettledContract
+	for len(contracts) < maxProfitTableRows {
+		offset := len(contracts)
+		resp, err := api.ProfitTable(schema.ProfitTable{
+			ProfitTable: 1,
+			DateFrom:    &dateFrom,
+			DateTo:      &dateTo,
+			Description: &description,
+			Limit:       maxProfitTablePage,
+			Offset:      &offset,
+			Sort:        schema.ProfitTableSortASC,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if resp.ProfitTable == nil {
+			break
+		}
+		for _, t := range resp.ProfitTable.Transactions {
+			c, ok := settledContract(t)
+			if ok {
+				contracts = append(contracts, c)
+			}
+		}
+		if len(resp.ProfitTable.Transactions) < maxProfitTablePage {
+			break
+		}
+	}
+	return contracts, nil
+}
+
+func settledContract(t schema.ProfitTableRespProfitTableTransactionsElem) (SettledContract, bool) {
+	id, ok := jsonInt(t.ContractId)
+	if !ok {
+		return SettledContract{}, false
+	}
+	c := SettledContract{ContractID: strconv.FormatInt(id, 10)}
+	if t.BuyPrice != nil {
+		c.BuyPrice = *t.BuyPrice
+	}
+	if t.SellPrice != nil {
+		c.SellPrice = *t.SellPrice
+	}
+	c.Profit = math.Round((c.SellPrice-c.BuyPrice)*100) / 100
+	if t.PurchaseTime != nil {
+		c.PurchaseTime = time.Unix(int64(*t.PurchaseTime), 0).UTC()
+	}
+	if sell, ok := jsonInt(t.SellTime); ok {
+		c.SellTime = time.Unix(sell, 0).UTC()
+	}
+	// Shortcodes start with the contract type, e.g. CALL_R_100_19.54_...
+	if t.Shortcode != nil {
+		c.ContractType, _, _ = strings.Cut(*t.Shortcode, "_")
+	}
+	return c, true
+}
+
+// jsonInt reads a number the schema leaves untyped because Deriv may send
+// it as null.
+func jsonInt(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return int64(n), true
+	case int:
+		return int64(n), true
+	case string:
+		i, err := strconv.ParseInt(n, 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// ContractDetails fills in the symbol, contract type and status of a
+// settled contract from proposal_open_contract, which the profit table
+// does not report.
+func ContractDetails(api *deriv.DerivAPI, c *SettledContract) error {
+	id, err := strconv.Atoi(c.ContractID)
+	if err != nil {
+		return fmt.Errorf("invalid contract id %q", c.ContractID)
+	}
+	resp, err := api.ProposalOpenContract(schema.ProposalOpenContract{
+		ProposalOpenContract: 1,
+		ContractId:           &id,
+	})
+	if err != nil {
+		return err
+	}
+	poc := resp.ProposalOpenContract
+	if poc == nil {
+		return fmt.Errorf("contract %d not found", id)
+	}
+	if poc.Underlying != nil {
+		c.Symbol = *poc.Underlying
+	}
+	if poc.ContractType != nil {
+		c.ContractType = *poc.ContractType
+	}
+	if poc.Status != nil {
+		c.Status = fmt.Sprintf("%v", poc.Status.Value)
+	}
+	return nil
+}
+
+// MatchTrades pairs settled contracts with stored trades by contract id. It
+// returns the contracts with a stored trade whose profit agrees, those with
+// none, and the trades whose profit differs. When a contract was stored
+// more than once, the first trade is compared.
+func MatchTrades(contracts []SettledContract, trades []database.Trade) (matched, missing []SettledContract, mismatched []ProfitMismatch) {
+	stored := make(map[string]database.Trade, len(trades))
+	for _, t := range trades {
+		if _, ok := stored[t.ContractID]; !ok && t.ContractID != "" {
+			stored[t.ContractID] = t
+		}
+	}
+
+	for _, c := range contracts {
+		t, ok := stored[c.ContractID]
+		switch {
+		case !ok:
+			missing = append(missing, c)
+		case math.Abs(t.Profit-c.Profit) > profitTolerance:
+			mismatched = append(mismatched, ProfitMismatch{Trade: t, Contract: c})
+		default:
+			matched = append(matched, c)
+		}
+	}
+	return matched, missing, mismatched
+}
+
+// UntaggedMatch is a stored trade without a contract id paired with the
+// settled contract it most likely records.
+type UntaggedMatch struct {
+	Trade    database.Trade
+	Contract SettledContract
+	Mismatch bool // the trade's profit differs from the contract's
+}
+
+// MatchUntagged pairs contracts that no stored trade records by id with
+// stored trades saved before bots recorded contract ids, on symbol,
+// contract type, stake and settlement time within UntaggedMatchWindow.
+// Contracts need their symbol (see ContractDetails). Each trade pairs with
+// at most one contract, the closest in time. It returns the pairs and the
+// contracts left unpaired.
+func MatchUntagged(contracts []SettledContract, trades []database.Trade) (pairs []UntaggedMatch, unpaired []SettledContract) {
+	used := make([]bool, len(trades))
+	for _, c := range contracts {
+		best := -1
+		var bestGap time.Duration
+		for i, t := range trades {
+			if used[i] || t.ContractID != "" || t.Symbol != c.Symbol || t.ContractType != c.ContractType ||
+				math.Abs(t.Stake-c.BuyPrice) > profitTolerance {
+				continue
+			}
+			gap := t.Timestamp.Sub(c.SellTime)
+			if gap < 0 {
+				gap = -gap
+			}
+			if gap <= UntaggedMatchWindow && (best < 0 || gap < bestGap) {
+				best, bestGap = i, gap
+			}
+		}
+		if best < 0 {
+			unpaired = append(unpaired, c)
+			continue
+		}
+		used[best] = true
+		pairs = append(pairs, UntaggedMatch{
+			Trade:    trades[best],
+			Contract: c,
+			Mismatch: math.Abs(trades[best].Profit-c.Profit) > profitTolerance,
+		})
+	}
+	return pairs, unpaired
+}
+
+// ReconciledTrade is the trade stored for a settled contract the database
+// did not have.
+func ReconciledTrade(c SettledContract) database.Trade {
+	status := c.Status
+	if status == "" {
+		status = "lost"
+		if c.Profit > 0 {
+			status = "won"
+		}
+	}
+	return database.Trade{
+		Strategy:       database.ReconciledStrategy,
+		Symbol:         c.Symbol,
+		ContractType:   c.ContractType,
+		Stake:          c.BuyPrice,
+		Profit:         c.Profit,
+		Status:         status,
+		Timestamp:      c.SellTime,
+		ContractID:     c.ContractID,
+		Reconciliation: database.ReconcileInserted,
+	}
+}
@@ -4,9 +4,10 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"math"
 	"sync"
 
+	"deriv_trade/database"
+
 	"github.com/ksysoev/deriv-api"
 	"github.com/ksysoev/deriv-api/schema"
 )
@@ -15,20 +16,16 @@ type RiseFallStrategy struct {
 	api    *deriv.DerivAPI
 	config Config
 
-	mu           sync.Mutex
-	currentStake float64
-	totalProfit  float64
-	maxPnL       float64
-	balance      float64
+	orders *orderManager
+
+	mu      sync.Mutex
+	balance float64
 }
 
 func NewRiseFallStrategy(api *deriv.DerivAPI, config Config) *RiseFallStrategy {
-	return &RiseFallStrategy{
-		api:          api,
-		config:       config,
-		currentStake: config.InitialStake,
-		maxPnL:       0,
-	}
+	s := &RiseFallStrategy{api: api, config: config}
+	s.orders = newOrderManager(config, s.handleSettlement)
+	return s
 }
 
 func (s *RiseFallStrategy) Execute(ctx context.Context) error {
@@ -40,6 +37,16 @@ func (s *RiseFallStrategy) Execute(ctx context.Context) error {
 
 	go s.monitorBalance(ctx)
 
+	// Keep track of last few quotes to determine trend
+	var quotes []float64
+
+	warmUp(s.api, s.config, func(quote float64) {
+		quotes = append(quotes, quote)
+		if len(quotes) > s.config.StreakThreshold+1 {
+			quotes = quotes[1:]
+		}
+	})
+
 	reqTicks := schema.Ticks{Ticks: s.config.Symbol}
 	_, tickSub, err := s.api.SubscribeTicks(reqTicks)
 	if err != nil {
@@ -47,9 +54,6 @@ func (s *RiseFallStrategy) Execute(ctx context.Context) error {
 	}
 	defer tickSub.Forget()
 
-	// Keep track of last few quotes to determine trend
-	var quotes []float64
-
 	for {
 		select {
 		case <-ctx.Done():
@@ -66,6 +70,7 @@ func (s *RiseFallStrategy) Execute(ctx context.Context) error {
 			}
 
 			log.Printf("Quote: %.4f", quote)
+			s.orders.tick()
 
 			// Need at least StreakThreshold + 1 data points to comparisons
 			if len(quotes) < s.config.StreakThreshold+1 {
@@ -87,19 +92,26 @@ func (s *RiseFallStrategy) Execute(ctx context.Context) error {
 				}
 			}
 
+			var contractType schema.ProposalContractType
 			if isUp {
 				log.Printf("Up Trend Detected (%d ticks). Buying CALL...", s.config.StreakThreshold)
-				stake := s.getStake()
 				// CALL = Rise
-				go s.placeTrade(ctx, schema.ProposalContractTypeCALL, stake)
-				quotes = nil // Reset
+				contractType = schema.ProposalContractTypeCALL
 			} else if isDown {
 				log.Printf("Down Trend Detected (%d ticks). Buying PUT...", s.config.StreakThreshold)
-				stake := s.getStake()
 				// PUT = Fall
-				go s.placeTrade(ctx, schema.ProposalContractTypePUT, stake)
-				quotes = nil // Reset
+				contractType = schema.ProposalContractTypePUT
+			} else {
+				continue
 			}
+
+			ticket, err := s.orders.enter()
+			if err != nil {
+				log.Printf("Trade skipped: %v", err)
+				continue
+			}
+			go s.placeTrade(ctx, contractType, ticket)
+			quotes = nil // Reset
 		}
 	}
 }
@@ -135,14 +147,8 @@ func (s *RiseFallStrategy) monitorBalance(ctx context.Context) {
 	}
 }
 
-func (s *RiseFallStrategy) getStake() float64 {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	return s.currentStake
-}
-
-func (s *RiseFallStrategy) placeTrade(ctx context.Context, contractType schema.ProposalContractType, stake float64) {
-	amount := stake
+func (s *RiseFallStrategy) placeTrade(ctx context.Context, contractType schema.ProposalContractType, ticket orderTicket) {
+	amount := ticket.stake
 	duration := s.config.Duration
 	basis := schema.ProposalBasisStake
 	currency := "USD"
@@ -160,10 +166,8 @@ func (s *RiseFallStrategy) placeTrade(ctx context.Context, contractType schema.P
 
 	propResp, err := s.api.Proposal(reqProp)
 	if err != nil {
-		log.Printf("Proposal error: %v. Resetting stake.", err)
-		s.mu.Lock()
-		s.currentStake = s.config.InitialStake
-		s.mu.Unlock()
+		log.Printf("Proposal error: %v", err)
+		s.orders.release(ctx, ticket)
 		return
 	}
 
@@ -172,12 +176,15 @@ func (s *RiseFallStrategy) placeTrade(ctx context.Context, contractType schema.P
 		Price: amount,
 	}
 
-	_, buySub, err := s.api.SubscribeBuy(buyReq)
+	buyResp, buySub, err := s.api.SubscribeBuy(buyReq)
 	if err != nil {
 		log.Printf("Buy error: %v", err)
+		s.orders.release(ctx, ticket)
 		return
 	}
 	defer buySub.Forget()
+	exit := newEarlyExit(s.api, s.config, buyResp.Buy.ContractId)
+	logContractOpened(buyResp.Buy.ContractId)
 
 	log.Printf("Trade placed (%s). Stake: %.2f.", contractType, amount)
 
@@ -185,57 +192,28 @@ func (s *RiseFallStrategy) placeTrade(ctx context.Context, contractType schema.P
 		if *contract.ProposalOpenContract.IsSold == 1 {
 			profit := *contract.ProposalOpenContract.Profit
 			status := fmt.Sprintf("%v", contract.ProposalOpenContract.Status.Value)
-			s.handleTradeResult(ctx, profit, status)
+			s.handleTradeResult(ctx, ticket, string(contractType), profit, status, exit)
 			return
 		}
+		exit.observe(contract.ProposalOpenContract)
 	}
+	// The stream ended without a settlement
+	s.orders.release(ctx, ticket)
+}
+
+func (s *RiseFallStrategy) handleTradeResult(ctx context.Context, ticket orderTicket, contractType string, profit float64, status string, exit *earlyExit) {
+	trade := database.Trade{ContractType: contractType, Profit: profit, Status: status}
+	exit.annotate(&trade)
+	s.orders.settle(ctx, ticket, trade)
 }
 
-func (s *RiseFallStrategy) handleTradeResult(ctx context.Context, profit float64, status string) {
+// handleSettlement logs a settlement in entry order and stops the bot when
+// it ended the session.
+func (s *RiseFallStrategy) handleSettlement(ctx context.Context, st settlement) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.totalProfit += profit
-	if s.totalProfit > s.maxPnL {
-		s.maxPnL = s.totalProfit
-	}
-	// Calculate Trailing Stop Level
-	var trailingStopLevel float64
-	if s.config.UseTrailingStop {
-		trailingStopLevel = s.maxPnL - s.config.StopLoss
-	} else {
-		trailingStopLevel = -s.config.StopLoss
-	}
-
-	log.Printf("Result: %s | Profit: %.2f | Total PnL: %.2f | Balance: %.2f", status, profit, s.totalProfit, s.balance)
-
-	stopLossMsg := "Trailing Stop Loss Hit"
-	if !s.config.UseTrailingStop {
-		stopLossMsg = "Stop Loss Hit"
-	}
-
-	if s.totalProfit <= trailingStopLevel {
-		log.Printf("%s! Total PnL: %.2f <= Stop Level: %.2f. Stopping...", stopLossMsg, s.totalProfit, trailingStopLevel)
-		log.Fatalf("%s - Stopping Bot", stopLossMsg)
-	}
-	if s.totalProfit >= s.config.TargetProfit {
-		log.Printf("Target Profit Hit! Total PnL: %.2f. Stopping...", s.totalProfit)
-		log.Fatal("Target Profit Hit - Stopping Bot")
-	}
-
-	if profit > 0 {
-		s.currentStake = s.config.InitialStake
-	} else {
-		newStake := s.currentStake * s.config.MartingaleMulti
-		newStake = math.Round(newStake*100) / 100
-
-		allowedLoss := s.totalProfit - trailingStopLevel
-		if newStake > allowedLoss {
-			log.Printf("Martingale stake (%.2f) exceeds allowed risk buffer (%.2f). Reverting to Initial Stake.", newStake, allowedLoss)
-			s.currentStake = s.config.InitialStake
-		} else {
-			s.currentStake = newStake
-		}
-	}
-	log.Printf("Next Stake: %.2f", s.currentStake)
+	log.Printf("Result: %s | Profit: %.2f | Total PnL: %.2f | Balance: %.2f", st.trade.Status, st.trade.Profit, st.totalProfit, s.balance)
+	stopOnReason(s.config, st)
+	log.Printf("Next Stake: %.2f", st.nextStake)
 }
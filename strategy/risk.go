@@ -0,0 +1,70 @@
+package strategy
+
+import (
+	"log"
+	"math"
+)
+
+// Reasons a simulated session ends early.
+const (
+	StopReasonStopLoss     = "stop_loss"
+	StopReasonTargetProfit = "target_profit"
+)
+
+// moneyManager holds the stake and exit rules of the built-in strategies.
+// Live strategies apply it through their orderManager, and offline
+// simulations use it directly so they size and stop sessions exactly like
+// the live bot.
+type moneyManager struct {
+	config       Config
+	currentStake float64
+	totalProfit  float64
+	maxPnL       float64
+}
+
+func newMoneyManager(config Config) *moneyManager {
+	return &moneyManager{config: config, currentStake: config.InitialStake}
+}
+
+// stopLevel is the PnL at which the session stops: trailing StopLoss below
+// the peak when the trailing stop is enabled, otherwise fixed at -StopLoss.
+func (m *moneyManager) stopLevel() float64 {
+	if m.config.UseTrailingStop {
+		return m.maxPnL - m.config.StopLoss
+	}
+	return -m.config.StopLoss
+}
+
+// record applies a settled trade's profit and returns the reason the session
+// stops, or "" while it carries on.
+func (m *moneyManager) record(profit float64) string {
+	m.totalProfit += profit
+	if m.totalProfit > m.maxPnL {
+		m.maxPnL = m.totalProfit
+	}
+	trailingStopLevel := m.stopLevel()
+
+	if m.totalProfit <= trailingStopLevel {
+		return StopReasonStopLoss
+	}
+	if m.totalProfit >= m.config.TargetProfit {
+		return StopReasonTargetProfit
+	}
+
+	if profit > 0 {
+		m.currentStake = m.config.InitialStake
+	} else {
+		newStake := m.currentStake * m.config.MartingaleMulti
+		newStake = math.Round(newStake*100) / 100
+
+		// Never stake more than the room left above the stop level
+		allowedLoss := m.totalProfit - trailingStopLevel
+		if newStake > allowedLoss {
+			log.Printf("Martingale stake (%.2f) exceeds allowed risk buffer (%.2f). Reverting to Initial Stake.", newStake, allowedLoss)
+			m.currentStake = m.config.InitialStake
+		} else {
+			m.currentStake = newStake
+		}
+	}
+	return ""
+}
@@ -5,11 +5,8 @@ import (
 	"deriv_trade/database"
 	"fmt"
 	"log"
-	"math"
-	"strconv"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/ksysoev/deriv-api"
 	"github.com/ksysoev/deriv-api/schema"
@@ -18,6 +15,7 @@ import (
 
 type Config struct {
 	ApiToken        string
+	LoginID         string // Account the token trades on, recorded on every trade
 	Symbol          string
 	Duration        int
 	InitialStake    float64
@@ -33,27 +31,47 @@ type Config struct {
 	SessionID       primitive.ObjectID
 	StrategyName    string
 	UseTrailingStop bool
-	Script          string // Custom JavaScript strategy
+	Script          string                 // Custom JavaScript strategy
+	WarmupTicks     int                    // Ticks of history replayed before trading starts (0 disables)
+	Params          map[string]interface{} // Values for the parameters a custom script declares
+
+	// Entry limits shared by all strategies (see orderManager)
+	MaxOpenPositions int // Contracts in flight at once (0 means 1)
+	MinEntryTicks    int // Ticks between entries
+	MinEntrySeconds  int // Seconds between entries
+
+	// Per-trade multiplier limits sent as limit_order, and the deal
+	// cancellation window ("5m", "10m", "15m", "30m", "60m"); 0/"" disables
+	TakeProfit       float64
+	TradeStopLoss    float64
+	DealCancellation string
+	// Per-position trailing take profit for multipliers: once a position's
+	// profit reaches TrailActivation it is closed when profit falls
+	// TrailDistance below its peak (0 distance disables)
+	TrailActivation float64
+	TrailDistance   float64
+
+	// Early exit rules for sellable contracts (see earlyExit); 0 disables
+	ExitBidPercent   float64 // Sell once the bid reaches this % of the payout
+	ExitAdverseTicks int     // Sell after the bid falls this many updates in a row
+	// Percent below the observed bid an early sale may fill at; 0 uses
+	// DefaultExitSellTolerance
+	ExitSellTolerance float64
 }
 
 type EvenOddStrategy struct {
 	api    *deriv.DerivAPI
 	config Config
+	orders *orderManager
 
-	mu           sync.Mutex
-	currentStake float64
-	totalProfit  float64
-	maxPnL       float64
-	balance      float64
+	mu      sync.Mutex
+	balance float64
 }
 
 func NewEvenOddStrategy(api *deriv.DerivAPI, config Config) *EvenOddStrategy {
-	return &EvenOddStrategy{
-		api:          api,
-		config:       config,
-		currentStake: config.InitialStake,
-		maxPnL:       0, // Start at 0
-	}
+	s := &EvenOddStrategy{api: api, config: config}
+	s.orders = newOrderManager(config, s.handleSettlement)
+	return s
 }
 
 func (s *EvenOddStrategy) Execute(ctx context.Context) error {
@@ -67,7 +85,23 @@ func (s *EvenOddStrategy) Execute(ctx context.Context) error {
 	// 2. Monitor Balance
 	go s.monitorBalance(ctx)
 
-	// 3. Subscribe to Ticks
+	evenStreak := 0
+	oddStreak := 0
+
+	// 3. Warm up streak counters from recent history; warmUp records the
+	// history's pip size on the symbol's digit statistics before each feed
+	digits := DigitStatsFor(s.config.Symbol)
+	warmUp(s.api, s.config, func(quote float64) {
+		if LastDigit(quote, digits.PipSize())%2 == 0 {
+			evenStreak++
+			oddStreak = 0
+		} else {
+			oddStreak++
+			evenStreak = 0
+		}
+	})
+
+	// 4. Subscribe to Ticks
 	reqTicks := schema.Ticks{Ticks: s.config.Symbol}
 	_, tickSub, err := s.api.SubscribeTicks(reqTicks)
 	if err != nil {
@@ -75,9 +109,6 @@ func (s *EvenOddStrategy) Execute(ctx context.Context) error {
 	}
 	defer tickSub.Forget()
 
-	evenStreak := 0
-	oddStreak := 0
-
 	for {
 		select {
 		case <-ctx.Done():
@@ -88,7 +119,10 @@ func (s *EvenOddStrategy) Execute(ctx context.Context) error {
 			}
 
 			quote := *tick.Tick.Quote
-			lastDigit := getLastDigit(quote)
+			lastDigit := DigitStatsFor(s.config.Symbol).Add(quote, int(tick.Tick.PipSize))
+			if lastDigit < 0 {
+				continue // precision unknown, so the digit cannot be told
+			}
 			isEven := lastDigit%2 == 0
 
 			// Update streaks
@@ -101,27 +135,34 @@ func (s *EvenOddStrategy) Execute(ctx context.Context) error {
 			}
 
 			log.Printf("Quote: %.4f | Digit: %d | Even Streak: %d | Odd Streak: %d", quote, lastDigit, evenStreak, oddStreak)
+			s.orders.tick()
 
 			// Check for trade condition
+			var contractType schema.ProposalContractType
 			if evenStreak >= s.config.StreakThreshold {
 				// Streak of Evens -> Bet Odd
 				log.Printf("Streak of %d Evens detected. Placing ODD trade...", evenStreak)
-				stake := s.getStake()
-				go s.placeTrade(ctx, schema.ProposalContractTypeDIGITODD, stake)
-
-				// Reset streaks after trade to avoid immediate re-entry
-				evenStreak = 0
-				oddStreak = 0
+				contractType = schema.ProposalContractTypeDIGITODD
 			} else if oddStreak >= s.config.StreakThreshold {
 				// Streak of Odds -> Bet Even
 				log.Printf("Streak of %d Odds detected. Placing EVEN trade...", oddStreak)
-				stake := s.getStake()
-				go s.placeTrade(ctx, schema.ProposalContractTypeDIGITEVEN, stake)
+				contractType = schema.ProposalContractTypeDIGITEVEN
+			} else {
+				continue
+			}
 
-				// Reset streaks
-				evenStreak = 0
-				oddStreak = 0
+			// Keep the streak while entries are held back so the signal
+			// fires again once a position frees up
+			ticket, err := s.orders.enter()
+			if err != nil {
+				log.Printf("Trade skipped: %v", err)
+				continue
 			}
+			go s.placeTrade(ctx, contractType, ticket)
+
+			// Reset streaks after trade to avoid immediate re-entry
+			evenStreak = 0
+			oddStreak = 0
 		}
 	}
 }
@@ -157,15 +198,9 @@ func (s *EvenOddStrategy) monitorBalance(ctx context.Context) {
 	}
 }
 
-func (s *EvenOddStrategy) getStake() float64 {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	return s.currentStake
-}
-
-func (s *EvenOddStrategy) placeTrade(ctx context.Context, contractType schema.ProposalContractType, stake float64) {
+func (s *EvenOddStrategy) placeTrade(ctx context.Context, contractType schema.ProposalContractType, ticket orderTicket) {
 	// Prepare Proposal
-	amount := stake
+	amount := ticket.stake
 	duration := s.config.Duration
 	basis := schema.ProposalBasisStake
 	currency := "USD"
@@ -185,9 +220,7 @@ func (s *EvenOddStrategy) placeTrade(ctx context.Context, contractType schema.Pr
 	propResp, err := s.api.Proposal(reqProp)
 	if err != nil {
 		log.Printf("Proposal error: %v. Resetting stake to initial.", err)
-		s.mu.Lock()
-		s.currentStake = s.config.InitialStake
-		s.mu.Unlock()
+		s.orders.releaseResetStake(ctx, ticket)
 		return
 	}
 
@@ -197,12 +230,15 @@ func (s *EvenOddStrategy) placeTrade(ctx context.Context, contractType schema.Pr
 		Price: amount,
 	}
 
-	_, buySub, err := s.api.SubscribeBuy(buyReq)
+	buyResp, buySub, err := s.api.SubscribeBuy(buyReq)
 	if err != nil {
 		log.Printf("Buy error: %v", err)
+		s.orders.release(ctx, ticket)
 		return
 	}
 	defer buySub.Forget()
+	exit := newEarlyExit(s.api, s.config, buyResp.Buy.ContractId)
+	logContractOpened(buyResp.Buy.ContractId)
 
 	// Monitor Trade
 	log.Printf("Trade placed. Stake: %.2f. Waiting for result...", amount)
@@ -216,121 +252,42 @@ func (s *EvenOddStrategy) placeTrade(ctx context.Context, contractType schema.Pr
 				status = fmt.Sprintf("%v", statusRaw)
 			}
 
-			s.handleTradeResult(ctx, profit, status)
+			s.handleTradeResult(ctx, ticket, profit, status, exit)
 			return
 		}
+		exit.observe(contract.ProposalOpenContract)
 	}
+	// The stream ended without a settlement
+	s.orders.release(ctx, ticket)
 }
 
-func (s *EvenOddStrategy) handleTradeResult(ctx context.Context, profit float64, status string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	s.totalProfit += profit
-
-	// Update Max PnL for Trailing Stop
-	if s.totalProfit > s.maxPnL {
-		s.maxPnL = s.totalProfit
+func (s *EvenOddStrategy) handleTradeResult(ctx context.Context, ticket orderTicket, profit float64, status string, exit *earlyExit) {
+	trade := database.Trade{
+		Strategy:     s.config.StrategyName,
+		Symbol:       s.config.Symbol,
+		ContractType: "EVEN/ODD",
+		Profit:       profit,
+		Status:       status,
+		Duration:     s.config.Duration,
+		DurationUnit: s.config.DurationUnit,
 	}
+	exit.annotate(&trade)
+	s.orders.settle(ctx, ticket, trade)
+}
 
-	// Calculate Trailing Stop Level
-	var trailingStopLevel float64
-	if s.config.UseTrailingStop {
-		trailingStopLevel = s.maxPnL - s.config.StopLoss
-	} else {
-		trailingStopLevel = -s.config.StopLoss
-	}
+// handleSettlement logs a settlement in entry order and stops the bot when
+// it ended the session.
+func (s *EvenOddStrategy) handleSettlement(ctx context.Context, st settlement) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	log.Printf("Result: %s | Profit: %.2f | Total PnL: %.2f | Balance: %.2f", strings.ToUpper(status), profit, s.totalProfit, s.balance)
+	log.Printf("Result: %s | Profit: %.2f | Total PnL: %.2f | Balance: %.2f", strings.ToUpper(st.trade.Status), st.trade.Profit, st.totalProfit, s.balance)
 
 	// Save trade to database
-	if s.config.DB != nil {
-		trade := &database.Trade{
-			Strategy:     s.config.StrategyName,
-			Symbol:       s.config.Symbol,
-			ContractType: "EVEN/ODD",
-			Stake:        s.currentStake,
-			Profit:       profit,
-			Status:       status,
-			Balance:      s.balance,
-			TotalPnL:     s.totalProfit,
-			Duration:     s.config.Duration,
-			DurationUnit: s.config.DurationUnit,
-			Timestamp:    time.Now(),
-		}
+	saveSettlement(ctx, s.config, st, s.balance)
 
-		if err := s.config.DB.InsertTrade(ctx, trade); err != nil {
-			log.Printf("Failed to save trade to database: %v", err)
-		}
-	}
-
-	// Check Stop Loss
-	stopLossMsg := "Trailing Stop Loss Hit"
-	if !s.config.UseTrailingStop {
-		stopLossMsg = "Stop Loss Hit"
-	}
-
-	if s.totalProfit <= trailingStopLevel {
-		log.Printf("%s! Total PnL: %.2f <= Stop Level: %.2f. Stopping...", stopLossMsg, s.totalProfit, trailingStopLevel)
-		// We can't easily cancel the main loop from here without a cancel function or channel.
-		// Since we passed ctx, we can't cancel it (it's a receive-only context usually, or we don't have the cancel func).
-		// But we can just exit the program or signal main.
-		// For now, let's just log FATAL to stop the process, or we could use a channel if we refactored.
-		// Given the structure, os.Exit or panic is a crude but effective way to stop everything immediately as requested.
-		// Better: return error from Execute? But we are in a goroutine.
-		// Let's just log Fatal for now to ensure it stops.
-		log.Fatalf("%s - Stopping Bot", stopLossMsg)
-	}
+	// Stop on the trailing stop loss or the target profit
+	stopOnReason(s.config, st)
 
-	// Check Target Profit
-	if s.totalProfit >= s.config.TargetProfit {
-		log.Printf("Target Profit Hit! Total PnL: %.2f. Stopping...", s.totalProfit)
-		log.Fatal("Target Profit Hit - Stopping Bot")
-	}
-
-	if profit > 0 {
-		// Win: Reset stake
-		s.currentStake = s.config.InitialStake
-	} else {
-		// Loss: Martingale
-		newStake := s.currentStake * s.config.MartingaleMulti
-		newStake = math.Round(newStake*100) / 100
-
-		// Check if new stake exceeds remaining risk buffer
-		// Buffer = (Total Profit so far) - (Stop Loss Level relative to Max PnL)
-		// Stop Loss Level = Max PnL - Config.StopLoss
-		// Effectively: Buffer = TotalProfit - (MaxPnL - StopLoss)
-		// Usually (MaxPnL - StopLoss) is negative or small.
-		// If StopLoss is a positive budget (e.g. 50), then we stop if TotalProfit <= MaxPnL - 50.
-		// Allowed Loss for next trade = TotalProfit - (MaxPnL - 50).
-		allowedLoss := s.totalProfit - trailingStopLevel
-
-		if newStake > allowedLoss {
-			log.Printf("Martingale stake (%.2f) exceeds allowed risk buffer (%.2f). Reverting to Initial Stake.", newStake, allowedLoss)
-			s.currentStake = s.config.InitialStake
-		} else {
-			s.currentStake = newStake
-		}
-	}
-
-	log.Printf("Next Stake: %.2f | Trailing Stop Level: %.2f", s.currentStake, trailingStopLevel)
-}
-
-func getLastDigit(val float64) int {
-	// Convert to string to safely get the last character
-	// Note: This assumes standard formatting. For high precision, might need better handling.
-	// Deriv ticks usually have enough precision.
-	// Example: 123.45 -> '5'
-
-	// Use Sprintf to control precision if needed, but %v is usually fine for quotes
-	s := fmt.Sprintf("%v", val)
-
-	// Just take the last digit character
-	for i := len(s) - 1; i >= 0; i-- {
-		if s[i] >= '0' && s[i] <= '9' {
-			d, _ := strconv.Atoi(string(s[i]))
-			return d
-		}
-	}
-	return 0
+	log.Printf("Next Stake: %.2f | Trailing Stop Level: %.2f", st.nextStake, st.stopLevel)
 }
@@ -0,0 +1,176 @@
+package strategy
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"deriv_trade/database"
+)
+
+// WalkForwardOptions splits recorded ticks into rolling windows: each window
+// optimizes over InSample ticks and then trades the best parameters, unseen,
+// over the OutSample ticks that follow.
+type WalkForwardOptions struct {
+	Optimize  OptimizeOptions
+	InSample  int  // ticks per in-sample (optimization) window
+	OutSample int  // ticks per out-of-sample (validation) window
+	Step      int  // ticks the windows advance by; 0 uses OutSample
+	Anchored  bool // in-sample windows all start at the first tick and grow
+}
+
+// WalkForwardWindow is one optimize-then-validate step.
+type WalkForwardWindow struct {
+	Index         int                      `json:"index"`
+	InSampleFrom  time.Time                `json:"in_sample_from"`
+	InSampleTo    time.Time                `json:"in_sample_to"`
+	OutSampleFrom time.Time                `json:"out_sample_from"`
+	OutSampleTo   time.Time                `json:"out_sample_to"`
+	Params        map[string]float64       `json:"params"`
+	InSample      database.BacktestSummary `json:"in_sample"`
+	OutSample     database.BacktestSummary `json:"out_sample"`
+	StopReason    string                   `json:"stop_reason,omitempty"` // out-of-sample session
+	// Efficiency is out-of-sample PnL per tick over in-sample PnL per tick;
+	// 0 when the in-sample result was not profitable
+	Efficiency float64 `json:"efficiency"`
+}
+
+// WalkForwardReport summarizes how optimized parameters held up on data the
+// optimizer never saw.
+type WalkForwardReport struct {
+	Windows []WalkForwardWindow `json:"windows"`
+	// OutSample combines every out-of-sample trade into one summary
+	OutSample         database.BacktestSummary `json:"out_sample"`
+	ProfitableWindows int                      `json:"profitable_windows"`
+	MeanWindowPnL     float64                  `json:"mean_window_pnl"`
+	StdWindowPnL      float64                  `json:"std_window_pnl"`
+	// Efficiency is the mean window efficiency; values near or above 1 suggest
+	// a real edge, values near 0 or negative suggest curve fitting
+	Efficiency float64 `json:"efficiency"`
+	// ParamStability is the coefficient of variation of each chosen parameter
+	// across windows; lower means the optimizer keeps picking similar values
+	ParamStability map[string]float64 `json:"param_stability"`
+}
+
+// WalkForward runs a walk-forward analysis over ticks.
+func WalkForward(ctx context.Context, opts WalkForwardOptions, ticks []database.Tick) (*WalkForwardReport, error) {
+	if opts.InSample <= 0 || opts.OutSample <= 0 {
+		return nil, fmt.Errorf("in-sample and out-of-sample window sizes must be positive")
+	}
+	step := opts.Step
+	if step <= 0 {
+		step = opts.OutSample
+	}
+	if opts.InSample+opts.OutSample > len(ticks) {
+		return nil, fmt.Errorf("need at least %d ticks for one window, have %d", opts.InSample+opts.OutSample, len(ticks))
+	}
+	if _, _, err := opts.Optimize.Candidates(); err != nil {
+		return nil, err
+	}
+
+	optimize := opts.Optimize
+	optimize.Top = 1
+
+	report := &WalkForwardReport{Windows: []WalkForwardWindow{}, ParamStability: map[string]float64{}}
+	var outTrades []BacktestTrade
+	chosen := map[string][]float64{}
+
+	for start := 0; start+opts.InSample+opts.OutSample <= len(ticks); start += step {
+		isStart := start
+		if opts.Anchored {
+			isStart = 0
+		}
+		split := start + opts.InSample
+		inSample := ticks[isStart:split]
+		outSample := ticks[split : split+opts.OutSample]
+
+		ranked, err := Optimize(ctx, optimize, inSample)
+		if err != nil {
+			return nil, err
+		}
+		if len(ranked) == 0 {
+			return nil, fmt.Errorf("window %d: no valid parameter combination", len(report.Windows))
+		}
+		best := ranked[0]
+
+		config, err := applyParams(optimize.Base, best.Params)
+		if err != nil {
+			return nil, err
+		}
+		out, err := Backtest(config, outSample, optimize.Payout)
+		if err != nil {
+			return nil, err
+		}
+
+		w := WalkForwardWindow{
+			Index:         len(report.Windows),
+			InSampleFrom:  best.Summary.From,
+			InSampleTo:    best.Summary.To,
+			OutSampleFrom: out.Summary.From,
+			OutSampleTo:   out.Summary.To,
+			Params:        best.Params,
+			InSample:      best.Summary,
+			OutSample:     out.Summary,
+			StopReason:    out.StopReason,
+		}
+		if best.Summary.NetPnL > 0 {
+			isRate := best.Summary.NetPnL / float64(len(inSample))
+			w.Efficiency = (out.Summary.NetPnL / float64(len(outSample))) / isRate
+		}
+		report.Windows = append(report.Windows, w)
+
+		outTrades = append(outTrades, out.Trades...)
+		for name, v := range best.Params {
+			chosen[name] = append(chosen[name], v)
+		}
+	}
+
+	report.OutSample = summarizeTrades(outTrades)
+	report.OutSample.Symbol = optimize.Base.Symbol
+	report.OutSample.From = report.Windows[0].OutSampleFrom
+	report.OutSample.To = report.Windows[len(report.Windows)-1].OutSampleTo
+	for _, w := range report.Windows {
+		report.OutSample.Ticks += w.OutSample.Ticks
+	}
+
+	pnls := make([]float64, len(report.Windows))
+	efficiency := 0.0
+	for i, w := range report.Windows {
+		pnls[i] = w.OutSample.NetPnL
+		if w.OutSample.NetPnL > 0 {
+			report.ProfitableWindows++
+		}
+		efficiency += w.Efficiency
+	}
+	report.MeanWindowPnL, report.StdWindowPnL = meanStd(pnls)
+	report.Efficiency = efficiency / float64(len(report.Windows))
+
+	for name, values := range chosen {
+		mean, std := meanStd(values)
+		if mean != 0 {
+			report.ParamStability[name] = std / math.Abs(mean)
+		}
+	}
+	return report, nil
+}
+
+// meanStd returns the mean and sample standard deviation of values.
+func meanStd(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	if len(values) < 2 {
+		return mean, 0
+	}
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(variance / float64(len(values)-1))
+}
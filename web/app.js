@@ -16,13 +16,21 @@ let wsReconnectTimeout = null;
 let botStartTime = null;
 let runtimeInterval = null;
 
+// Signed-in user ({username, role}), set by initAuth
+let currentUser = null;
+
 // Initialize
-document.addEventListener('DOMContentLoaded', () => {
-    initCharts();
+document.addEventListener('DOMContentLoaded', async () => {
     initTheme();
+    if (!(await initAuth())) return;
+    initCharts();
     initWebSocket();
     initBotControls();
     initEditor();
+    initManualTrade();
+    loadAccounts();
+    setInterval(loadAccounts, 60000);
+    loadPortfolio();
     checkBotStatus();
     loadData();
     setupEventListeners();
@@ -74,6 +82,12 @@ function setupEventListeners() {
         // Save
         const saveBtn = document.getElementById('saveSettingsBtn');
         if (saveBtn) saveBtn.addEventListener('click', saveSettings);
+
+        const addAccountBtn = document.getElementById('addAccountBtn');
+        if (addAccountBtn) addAccountBtn.addEventListener('click', () => addAccountRow('', ''));
+
+        const saveUserBtn = document.getElementById('saveUserBtn');
+        if (saveUserBtn) saveUserBtn.addEventListener('click', saveUser);
     }
 
     // Setup Modal
@@ -91,14 +105,183 @@ function setupEventListeners() {
     }
 }
 
+const roleRank = { viewer: 1, trader: 2, admin: 3 };
+
+function hasRole(role) {
+    return currentUser && roleRank[currentUser.role] >= roleRank[role];
+}
+
+// Set when the login form creates the first admin instead of signing in
+let setupRequired = false;
+
+// initAuth loads the signed-in user, or shows the login form and returns false
+async function initAuth() {
+    const loginForm = document.getElementById('loginForm');
+    loginForm.addEventListener('submit', login);
+    document.getElementById('logoutBtn').addEventListener('click', logout);
+
+    try {
+        const response = await fetch('/api/auth/me');
+        if (response.status === 401) {
+            await showLogin();
+            return false;
+        }
+        if (!response.ok) throw new Error(await response.text());
+        currentUser = await response.json();
+    } catch (error) {
+        console.error('Failed to load user:', error);
+        return false;
+    }
+
+    document.getElementById('currentUserName').textContent = currentUser.username;
+    document.getElementById('currentUserRole').textContent = currentUser.role;
+    document.getElementById('currentUser').classList.remove('d-none');
+    document.getElementById('logoutBtn').classList.remove('d-none');
+    if (hasRole('admin')) {
+        document.getElementById('settingsBtn').classList.remove('d-none');
+    }
+    if (!hasRole('trader')) {
+        ['startBotBtn', 'stopBotBtn', 'manualQuoteBtn', 'manualBuyBtn', 'newJournalBtn'].forEach(id => {
+            const el = document.getElementById(id);
+            if (el) el.classList.add('d-none');
+        });
+    }
+    return true;
+}
+
+async function showLogin() {
+    try {
+        const response = await fetch('/api/auth/setup');
+        setupRequired = response.ok && (await response.json()).required;
+    } catch (error) {
+        console.error('Failed to check setup:', error);
+    }
+    if (setupRequired) {
+        document.getElementById('loginTitle').textContent = 'Create Admin';
+        document.getElementById('loginBtn').textContent = 'Create Admin';
+        document.getElementById('loginPassword').autocomplete = 'new-password';
+        document.getElementById('setupFields').classList.remove('d-none');
+        // The desktop app passes the token it started the server with
+        const token = new URLSearchParams(window.location.search).get('setup_token');
+        if (token) document.getElementById('setupToken').value = token;
+    }
+    new bootstrap.Modal(document.getElementById('loginModal')).show();
+}
+
+async function login(event) {
+    event.preventDefault();
+    const btn = document.getElementById('loginBtn');
+    const errorEl = document.getElementById('loginError');
+    btn.disabled = true;
+    errorEl.classList.add('d-none');
+
+    try {
+        const credentials = {
+            username: document.getElementById('loginUsername').value.trim(),
+            password: document.getElementById('loginPassword').value
+        };
+        if (setupRequired) credentials.setup_token = document.getElementById('setupToken').value.trim();
+        const response = await fetch(setupRequired ? '/api/auth/setup' : '/api/auth/login', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(credentials)
+        });
+        if (!response.ok) throw new Error(await response.text());
+        // The session cookie is set; start the dashboard afresh, without the setup token
+        window.location.replace(window.location.pathname);
+    } catch (error) {
+        errorEl.textContent = error.message;
+        errorEl.classList.remove('d-none');
+        btn.disabled = false;
+    }
+}
+
+async function logout() {
+    try {
+        await fetch('/api/auth/logout', { method: 'POST' });
+    } finally {
+        window.location.reload();
+    }
+}
+
+async function loadUsers() {
+    const container = document.getElementById('settingUsers');
+    try {
+        const response = await fetch('/api/users');
+        if (!response.ok) throw new Error(await response.text());
+        const users = await response.json();
+        container.innerHTML = '';
+        users.forEach(u => {
+            const row = document.createElement('div');
+            row.className = 'd-flex align-items-center gap-2 mb-1';
+            const name = document.createElement('span');
+            name.className = 'flex-grow-1';
+            name.textContent = u.username;
+            const role = document.createElement('span');
+            role.className = 'badge bg-secondary';
+            role.textContent = u.role;
+            const del = document.createElement('button');
+            del.type = 'button';
+            del.className = 'btn btn-sm btn-outline-danger py-0';
+            del.innerHTML = '<i class="bi bi-trash"></i>';
+            del.addEventListener('click', () => deleteUser(u.username));
+            row.append(name, role, del);
+            container.appendChild(row);
+        });
+    } catch (error) {
+        container.textContent = 'Failed to load users: ' + error.message;
+    }
+}
+
+async function saveUser() {
+    const nameInput = document.getElementById('newUserName');
+    const passwordInput = document.getElementById('newUserPassword');
+    try {
+        const response = await fetch('/api/users', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({
+                username: nameInput.value.trim(),
+                password: passwordInput.value,
+                role: document.getElementById('newUserRole').value
+            })
+        });
+        if (!response.ok) throw new Error(await response.text());
+        appendLog(`User ${nameInput.value.trim()} saved`, 'success');
+        nameInput.value = '';
+        passwordInput.value = '';
+        loadUsers();
+    } catch (error) {
+        alert('Failed to save user: ' + error.message);
+    }
+}
+
+async function deleteUser(username) {
+    if (!confirm(`Delete user ${username}?`)) return;
+    try {
+        const response = await fetch(`/api/users?username=${encodeURIComponent(username)}`, { method: 'DELETE' });
+        if (!response.ok) throw new Error(await response.text());
+        appendLog(`User ${username} deleted`, 'info');
+        if (username === currentUser.username) {
+            window.location.reload();
+            return;
+        }
+        loadUsers();
+    } catch (error) {
+        alert('Failed to delete user: ' + error.message);
+    }
+}
+
 async function checkSetup() {
+    if (!hasRole('admin')) return;
+
     try {
         const response = await fetch('/api/settings');
         if (response.ok) {
             const settings = await response.json();
 
             // Check if API token is missing
-            if (!settings.deriv_api_token) {
+            if (!settings.deriv_api_token && !(settings.accounts || []).length) {
                 const setupModal = new bootstrap.Modal(document.getElementById('setupModal'));
                 setupModal.show();
             } else {
@@ -166,22 +349,56 @@ async function saveInitialSetup() {
     }
 }
 
+// Settings as last loaded, so fields the form does not show are saved back unchanged
+let loadedSettings = {};
+
 async function openSettings() {
     try {
         const response = await fetch('/api/settings');
         if (response.ok) {
             const settings = await response.json();
+            loadedSettings = settings;
+            document.getElementById('settingAccounts').innerHTML = '';
+            (settings.accounts || []).forEach(a => addAccountRow(a.name, a.token, a.id));
             document.getElementById('settingApiToken').value = settings.deriv_api_token || '';
             document.getElementById('settingMongoUri').value = settings.mongo_uri || '';
             document.getElementById('settingOpenAIKey').value = settings.openai_key || '';
             document.getElementById('settingOpenAIModel').value = settings.openai_model || 'gpt-3.5-turbo';
+            document.getElementById('settingStrategyStore').value = settings.strategy_store || 'filesystem';
         }
+        loadUsers();
     } catch (error) {
         console.error('Failed to load settings:', error);
         appendLog('Failed to load settings', 'error');
     }
 }
 
+function addAccountRow(name, token, id) {
+    const row = document.createElement('div');
+    row.className = 'input-group input-group-sm mb-1 account-row';
+    // The id keeps an account's stored token when it is renamed
+    row.dataset.id = id || '';
+    row.innerHTML = `
+        <input type="text" class="form-control account-name" placeholder="Name (e.g. demo)">
+        <input type="password" class="form-control account-token" placeholder="API token">
+        <button type="button" class="btn btn-outline-danger"><i class="bi bi-x"></i></button>
+    `;
+    row.querySelector('.account-name').value = name;
+    row.querySelector('.account-token').value = token;
+    row.querySelector('button').addEventListener('click', () => row.remove());
+    document.getElementById('settingAccounts').appendChild(row);
+}
+
+function readAccountRows() {
+    return [...document.querySelectorAll('#settingAccounts .account-row')]
+        .map(row => ({
+            id: row.dataset.id || undefined,
+            name: row.querySelector('.account-name').value.trim(),
+            token: row.querySelector('.account-token').value.trim()
+        }))
+        .filter(a => a.name || a.token);
+}
+
 function closeSettings() {
     if (settingsModalBS) settingsModalBS.hide();
 }
@@ -193,10 +410,13 @@ async function saveSettings() {
     saveBtn.textContent = 'Saving...';
 
     const settings = {
+        ...loadedSettings,
         deriv_api_token: document.getElementById('settingApiToken').value,
         mongo_uri: document.getElementById('settingMongoUri').value,
         openai_key: document.getElementById('settingOpenAIKey').value,
-        openai_model: document.getElementById('settingOpenAIModel').value
+        openai_model: document.getElementById('settingOpenAIModel').value,
+        strategy_store: document.getElementById('settingStrategyStore').value,
+        accounts: readAccountRows()
     };
 
     try {
@@ -206,7 +426,7 @@ async function saveSettings() {
             body: JSON.stringify(settings)
         });
 
-        if (!response.ok) throw new Error('Failed to save settings');
+        if (!response.ok) throw new Error(await response.text());
 
         appendLog('Settings saved.', 'success');
 
@@ -321,8 +541,9 @@ function initWebSocket() {
             const data = JSON.parse(event.data);
             if (data.type === 'log' || data.type === 'info' || data.type === 'error') {
                 appendLog(data.message, data.type);
+            } else if (data.type === 'position' || data.type === 'position_closed') {
+                updatePosition(data.type, data.position);
             }
-            // Could handle other message types here (e.g. trade updates)
         } catch (e) {
             console.error('Error parsing WS message:', e);
         }
@@ -336,6 +557,7 @@ function initBotControls() {
     startBtn.addEventListener('click', async () => {
         const config = {
             strategy: document.getElementById('configStrategy').value,
+            account: document.getElementById('configAccount').value,
             symbol: document.getElementById('configSymbol').value,
             initial_stake: parseFloat(document.getElementById('configInitialStake').value),
             target_profit: parseFloat(document.getElementById('configTargetProfit').value),
@@ -345,6 +567,19 @@ function initBotControls() {
             duration_unit: document.getElementById('configDurationUnit').value,
             streak_threshold: parseInt(document.getElementById('configStreakThreshold').value),
             barrier: document.getElementById('configBarrier').value,
+            prediction: readPrediction(),
+            warmup_ticks: parseInt(document.getElementById('configWarmupTicks').value) || 0,
+            take_profit: parseFloat(document.getElementById('configTakeProfit').value) || 0,
+            trade_stop_loss: parseFloat(document.getElementById('configTradeStopLoss').value) || 0,
+            deal_cancellation: document.getElementById('configDealCancellation').value,
+            trail_activation: parseFloat(document.getElementById('configTrailActivation').value) || 0,
+            trail_distance: parseFloat(document.getElementById('configTrailDistance').value) || 0,
+            exit_bid_percent: parseFloat(document.getElementById('configExitBidPercent').value) || 0,
+            exit_adverse_ticks: parseInt(document.getElementById('configExitAdverseTicks').value) || 0,
+            exit_sell_tolerance: parseFloat(document.getElementById('configExitSellTolerance').value) || 0,
+            max_open_positions: parseInt(document.getElementById('configMaxOpen').value) || 1,
+            min_entry_ticks: parseInt(document.getElementById('configMinEntryTicks').value) || 0,
+            min_entry_seconds: parseInt(document.getElementById('configMinEntrySeconds').value) || 0,
             use_trailing_stop: document.getElementById('configUseTrailingStop').checked
         };
 
@@ -820,6 +1055,14 @@ function formatCurrency(value) {
     return sign + '$' + Math.abs(num).toFixed(2);
 }
 
+// escapeHtml makes user-controlled text such as account and bot names safe
+// to put into HTML templates and attribute values.
+function escapeHtml(value) {
+    return String(value ?? '').replace(/[&<>"']/g, c => ({
+        '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;'
+    })[c]);
+}
+
 function formatTime(timestamp) {
     if (!timestamp) return '-';
     const date = new Date(timestamp);
@@ -884,6 +1127,7 @@ if (generateBtn) {
                     }
 
                     appendLog('Strategy generated by AI (' + mode + ')', 'success');
+                    if (data.issues) logStrategyIssues(data.issues);
 
                     // Close modal
                     const modalEl = document.getElementById('aiStrategyModal');
@@ -904,6 +1148,79 @@ if (generateBtn) {
     });
 }
 
+// Export Strategy Bundle (current dashboard settings as the recommended config)
+const exportBtn = document.getElementById('exportStrategyBtn');
+if (exportBtn) {
+    exportBtn.addEventListener('click', async () => {
+        const name = document.getElementById('currentStrategyName').textContent.trim();
+        if (name === 'Untitled') {
+            alert('Save the strategy before exporting it');
+            return;
+        }
+        const format = confirm('Export as zip? (Cancel for JSON)') ? 'zip' : 'json';
+
+        try {
+            const response = await fetch('/api/strategies/export', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ name, format, bot_config: getBotConfig() })
+            });
+            if (!response.ok) throw new Error(await response.text());
+
+            const blob = await response.blob();
+            const url = window.URL.createObjectURL(blob);
+            const a = document.createElement('a');
+            a.href = url;
+            a.download = name.replace(/\.(js|xml)$/, '') + (format === 'zip' ? '.zip' : '.bundle.json');
+            document.body.appendChild(a);
+            a.click();
+            window.URL.revokeObjectURL(url);
+            document.body.removeChild(a);
+            appendLog(`Exported ${name}`, 'success');
+        } catch (error) {
+            appendLog(`Failed to export strategy: ${error.message}`, 'error');
+        }
+    });
+}
+
+// Import Strategy Bundle
+const importBtn = document.getElementById('importStrategyBtn');
+const importFile = document.getElementById('importStrategyFile');
+if (importBtn && importFile) {
+    importBtn.addEventListener('click', () => importFile.click());
+    importFile.addEventListener('change', async () => {
+        const file = importFile.files[0];
+        if (!file) return;
+
+        const formData = new FormData();
+        formData.append('file', file);
+        try {
+            const response = await fetch('/api/strategies/import?on_conflict=rename', {
+                method: 'POST',
+                body: formData
+            });
+            const text = await response.text();
+            if (!response.ok) {
+                try {
+                    const data = JSON.parse(text);
+                    if (data.issues) logStrategyIssues(data.issues);
+                } catch (e) { /* plain text error */ }
+                throw new Error(text);
+            }
+
+            const result = JSON.parse(text);
+            if (result.issues) logStrategyIssues(result.issues);
+            appendLog(result.renamed ? `Imported as ${result.name} (name was taken)` : `Imported ${result.name}`, 'success');
+            await loadSavedStrategies();
+            loadStrategyContent(result.name);
+        } catch (error) {
+            appendLog(`Failed to import strategy: ${error.message}`, 'error');
+        } finally {
+            importFile.value = '';
+        }
+    });
+}
+
 // Download Strategy
 const downloadBtn = document.getElementById('downloadStrategyBtn');
 if (downloadBtn) {
@@ -939,8 +1256,11 @@ if (downloadBtn) {
 // Editor State
 let editor = null;
 const defaultScript = `// Custom Strategy Script
-// Available globals: log(msg), buy(contractType, amount), onTick(quote)
-// config: getInitialStake(), getSymbol()
+// Available globals: log(msg), buy(contractType, amount[, prediction]), onTick(quote)
+// config: getInitialStake(), getSymbol(), params.<name>
+// digits: digitStats(window) -> {counts, frequencies, last_digit, digit_streak, parity_streak, p_value, ...}
+// Declare inputs in the header, e.g.:
+// @param threshold integer 3 min=1 max=10 Ticks to wait before buying
 
 function onTick(quote) {
     log("Tick: " + quote);
@@ -1010,6 +1330,15 @@ function initEditor() {
     // Strategy Management
     loadSavedStrategies();
 
+    const strategySearchInput = document.getElementById('strategySearchInput');
+    if (strategySearchInput) {
+        let searchTimer = null;
+        strategySearchInput.addEventListener('input', () => {
+            clearTimeout(searchTimer);
+            searchTimer = setTimeout(loadSavedStrategies, 300);
+        });
+    }
+
     const saveStrategyBtn = document.getElementById('saveStrategyBtn');
     if (saveStrategyBtn) {
         saveStrategyBtn.addEventListener('click', () => {
@@ -1025,6 +1354,11 @@ function initEditor() {
         });
     }
 
+    const historyStrategyBtn = document.getElementById('historyStrategyBtn');
+    if (historyStrategyBtn) {
+        historyStrategyBtn.addEventListener('click', showStrategyHistory);
+    }
+
     const confirmSaveBtn = document.getElementById('confirmSaveStrategyBtn');
     if (confirmSaveBtn) {
         confirmSaveBtn.addEventListener('click', saveCurrentStrategy);
@@ -1035,6 +1369,7 @@ function initEditor() {
         newStrategyBtn.addEventListener('click', () => {
             if (editor) editor.setValue(defaultScript);
             document.getElementById('currentStrategyName').textContent = 'Untitled';
+            renderStrategyParams([], {});
             const tagsEl = document.getElementById('currentStrategyTags');
             if (tagsEl) tagsEl.classList.add('d-none');
         });
@@ -1346,8 +1681,15 @@ window.deleteJournalEntry = async function (id) {
 };
 
 async function loadSavedStrategies() {
+    // "tag:name" searches by tag, anything else by strategy name
+    const searchEl = document.getElementById('strategySearchInput');
+    const search = searchEl ? searchEl.value.trim() : '';
+    const query = search.startsWith('tag:')
+        ? `?tag=${encodeURIComponent(search.slice(4).trim())}`
+        : (search ? `?q=${encodeURIComponent(search)}` : '');
+
     try {
-        const response = await fetch('/api/strategies/list');
+        const response = await fetch('/api/strategies/list' + query);
         if (response.ok) {
             const strategies = await response.json();
             const container = document.getElementById('strategyList');
@@ -1365,7 +1707,7 @@ async function loadSavedStrategies() {
                     return `
                     <div class="list-group-item list-group-item-action d-flex justify-content-between align-items-start p-2 strategy-item" role="button" onclick="loadStrategyContent('${strat.name}')">
                         <div class="ms-2 me-auto text-truncate" style="max-width: 140px;">
-                            <div class="fw-bold text-truncate" title="${strat.name}">${strat.name}</div>
+                            <div class="fw-bold text-truncate" title="${strat.description || strat.name}">${strat.name}</div>
                             <div class="mt-1">${tagsHtml}</div>
                         </div>
                         <div class="d-flex align-items-center">
@@ -1399,6 +1741,7 @@ window.loadStrategyContent = async function (name) {
                 editor.setValue(content);
                 // Update header Info
                 document.getElementById('currentStrategyName').textContent = name;
+                loadStrategyParams(name);
 
                 // Fetch stats/meta again to get tags? Or just update form list...
                 // For now, we don't have tags in the GET response content, only in list.
@@ -1451,6 +1794,10 @@ async function saveCurrentStrategy() {
     }
 
     const tags = tagsInput.value.split(',').map(t => t.trim()).filter(t => t.length > 0);
+    const noteInput = document.getElementById('strategyNoteInput');
+    const note = noteInput ? noteInput.value.trim() : '';
+    const descriptionInput = document.getElementById('strategyDescriptionInput');
+    const description = descriptionInput && descriptionInput.value.trim() ? descriptionInput.value.trim() : undefined;
 
     if (!editor) return;
     const content = editor.getValue();
@@ -1464,12 +1811,17 @@ async function saveCurrentStrategy() {
         const response = await fetch('/api/strategies/save', {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({ name, content, tags })
+            body: JSON.stringify({ name, content, tags, params: getStrategyParamValues(), note, description })
         });
 
         if (response.ok) {
             appendLog(`Strategy saved: ${name}`, 'success');
-            document.getElementById('currentStrategyName').textContent = name.endsWith('.js') ? name : name + '.js';
+            const saved = await response.json();
+            const savedName = saved.name;
+            if (saved.version) appendLog(`Saved as version ${saved.version.version}`, 'info');
+            if (noteInput) noteInput.value = '';
+            document.getElementById('currentStrategyName').textContent = savedName;
+            loadStrategyParams(savedName);
 
             // Reload list
             await loadSavedStrategies();
@@ -1479,28 +1831,49 @@ async function saveCurrentStrategy() {
             const modal = bootstrap.Modal.getInstance(modalEl);
             modal.hide();
         } else {
-            throw new Error('Failed to save');
+            const errText = await response.text();
+            let message = errText;
+            try {
+                const data = JSON.parse(errText);
+                if (data.issues) {
+                    logStrategyIssues(data.issues);
+                    message = data.issues.filter(i => i.severity === 'error').map(i => i.message).join('\n');
+                }
+            } catch (e) { /* plain-text error */ }
+            throw new Error(message || 'Failed to save');
         }
     } catch (error) {
         console.error('Failed to save strategy:', error);
-        alert('Failed to save strategy');
+        alert(`Failed to save strategy:\n${error.message}`);
     } finally {
         btn.disabled = false;
         btn.textContent = originalText;
     }
 }
 
+// Print DBot validation issues to the log panel
+function logStrategyIssues(issues) {
+    issues.forEach(issue => {
+        const where = issue.block_type ? ` [${issue.block_type}${issue.block_id ? ' #' + issue.block_id : ''}]` : '';
+        appendLog(`DBot ${issue.severity}${where}: ${issue.message}`, issue.severity === 'error' ? 'error' : 'system');
+    });
+}
+
 async function startBotWithScript(script) {
     const runScriptBtn = document.getElementById('runScriptBtn');
 
     // Get base config but override strategy
     const config = getBotConfig();
-    config.strategy = 'custom';
+    // DBot XML workspaces run on the block interpreter, everything else as JS
+    config.strategy = (script.includes('<xml') && script.includes('<block')) ? 'dbot' : 'custom';
     config.script = script;
+    const scriptName = document.getElementById('currentStrategyName').textContent.trim();
+    if (scriptName !== 'Untitled') config.script_name = scriptName;
+    if (config.strategy === 'custom') config.params = getStrategyParamValues();
 
     try {
         if (runScriptBtn) runScriptBtn.disabled = true;
-        appendLog(`Starting Custom Strategy...`, 'info');
+        appendLog(`Starting ${config.strategy === 'dbot' ? 'DBot' : 'Custom'} Strategy...`, 'info');
 
         const response = await fetch('/api/bot/start', {
             method: 'POST',
@@ -1524,9 +1897,17 @@ async function startBotWithScript(script) {
     }
 }
 
+// readPrediction returns the digit prediction, or undefined when left empty
+// so the strategy picks the digit itself.
+function readPrediction() {
+    const value = document.getElementById('configPrediction').value;
+    return value === '' ? undefined : parseInt(value);
+}
+
 function getBotConfig() {
     return {
         strategy: document.getElementById('configStrategy').value,
+        account: document.getElementById('configAccount').value,
         symbol: document.getElementById('configSymbol').value,
         initial_stake: parseFloat(document.getElementById('configInitialStake').value),
         target_profit: parseFloat(document.getElementById('configTargetProfit').value),
@@ -1536,6 +1917,19 @@ function getBotConfig() {
         duration_unit: document.getElementById('configDurationUnit').value,
         streak_threshold: parseInt(document.getElementById('configStreakThreshold').value),
         barrier: document.getElementById('configBarrier').value,
+        prediction: readPrediction(),
+        warmup_ticks: parseInt(document.getElementById('configWarmupTicks').value) || 0,
+        take_profit: parseFloat(document.getElementById('configTakeProfit').value) || 0,
+        trade_stop_loss: parseFloat(document.getElementById('configTradeStopLoss').value) || 0,
+        deal_cancellation: document.getElementById('configDealCancellation').value,
+        trail_activation: parseFloat(document.getElementById('configTrailActivation').value) || 0,
+        trail_distance: parseFloat(document.getElementById('configTrailDistance').value) || 0,
+        exit_bid_percent: parseFloat(document.getElementById('configExitBidPercent').value) || 0,
+        exit_adverse_ticks: parseInt(document.getElementById('configExitAdverseTicks').value) || 0,
+        exit_sell_tolerance: parseFloat(document.getElementById('configExitSellTolerance').value) || 0,
+        max_open_positions: parseInt(document.getElementById('configMaxOpen').value) || 1,
+        min_entry_ticks: parseInt(document.getElementById('configMinEntryTicks').value) || 0,
+        min_entry_seconds: parseInt(document.getElementById('configMinEntrySeconds').value) || 0,
         use_trailing_stop: document.getElementById('configUseTrailingStop').checked
     };
 }
@@ -1559,6 +1953,259 @@ function formatStrategy(strategy) {
         .join(' ');
 }
 
+// Accounts
+async function loadAccounts() {
+    try {
+        const response = await fetch('/api/accounts');
+        if (!response.ok) return;
+        const accounts = await response.json();
+
+        ['configAccount', 'manualAccount'].forEach(id => {
+            const select = document.getElementById(id);
+            const selected = select.value;
+            select.innerHTML = '<option value="">Default</option>';
+            accounts.filter(a => !a.default).forEach(a => {
+                const option = document.createElement('option');
+                option.value = a.name;
+                option.textContent = a.login_id ? `${a.name} (${a.login_id})` : a.name;
+                select.appendChild(option);
+            });
+            select.value = selected;
+            if (select.value !== selected) select.value = '';
+        });
+
+        const balances = document.getElementById('accountBalances');
+        if (accounts.length === 0) {
+            balances.textContent = 'No accounts configured';
+            return;
+        }
+        balances.innerHTML = accounts.map(a => `
+            <div class="d-flex justify-content-between">
+                <span>${escapeHtml(a.name)}${a.is_virtual ? ' <span class="badge bg-secondary">demo</span>' : ''}</span>
+                ${a.error
+                    ? `<span class="text-danger" title="${escapeHtml(a.error)}">unavailable</span>`
+                    : `<span class="font-monospace">${a.balance.toFixed(2)} ${escapeHtml(a.currency)}</span>`}
+            </div>
+        `).join('');
+    } catch (error) {
+        console.error('Error loading accounts:', error);
+    }
+}
+
+// Open Positions
+const openPositions = new Map();
+
+async function loadPortfolio() {
+    try {
+        const response = await fetch('/api/portfolio');
+        if (!response.ok) return;
+        const snapshot = await response.json();
+        openPositions.clear();
+        snapshot.positions.forEach(p => openPositions.set(p.contract_id, p));
+        renderPositions();
+    } catch (error) {
+        console.error('Error loading portfolio:', error);
+    }
+}
+
+function updatePosition(type, position) {
+    if (type === 'position_closed') {
+        openPositions.delete(position.contract_id);
+    } else {
+        openPositions.set(position.contract_id, position);
+    }
+    renderPositions();
+}
+
+function renderPositions() {
+    const body = document.getElementById('positionsBody');
+    const byBot = document.getElementById('positionsByBot');
+    const positions = [...openPositions.values()].sort((a, b) => b.purchase_time - a.purchase_time);
+
+    if (positions.length === 0) {
+        body.innerHTML = '<tr><td colspan="9" class="text-center py-4 text-muted">No open positions</td></tr>';
+        byBot.innerHTML = '<span class="text-muted">No open positions</span>';
+        return;
+    }
+
+    body.innerHTML = positions.map(p => `
+        <tr>
+            <td class="font-monospace">${p.contract_id}</td>
+            <td>${escapeHtml(p.account)}</td>
+            <td>${escapeHtml(p.bot)}</td>
+            <td>${escapeHtml(p.contract_type)}</td>
+            <td>${escapeHtml(p.symbol)}</td>
+            <td>${formatCurrency(p.buy_price)}</td>
+            <td>${formatCurrency(p.bid_price)}</td>
+            <td class="${p.profit >= 0 ? 'text-success' : 'text-danger'}">${formatCurrency(p.profit)}</td>
+            <td>${String(p.contract_type).startsWith('MULT') && hasRole('trader')
+                ? `<button class="btn btn-sm btn-outline-secondary py-0" title="Move take profit / stop loss"
+                    data-contract="${p.contract_id}"><i class="bi bi-sliders"></i></button>`
+                : ''}</td>
+        </tr>
+    `).join('');
+    body.querySelectorAll('button[data-contract]').forEach(btn => {
+        const p = openPositions.get(Number(btn.dataset.contract));
+        btn.addEventListener('click', () => updatePositionLimits(p.contract_id, p.account));
+    });
+
+    const bots = {};
+    positions.forEach(p => {
+        const key = `${p.account}/${p.bot}`;
+        bots[key] = bots[key] || { count: 0, pnl: 0 };
+        bots[key].count++;
+        bots[key].pnl += p.profit;
+    });
+    byBot.innerHTML = Object.entries(bots).map(([bot, b]) =>
+        `<span><span class="fw-bold">${escapeHtml(bot)}</span>: ${b.count} open, <span class="${b.pnl >= 0 ? 'text-success' : 'text-danger'}">${formatCurrency(b.pnl)}</span></span>`
+    ).join('');
+}
+
+// updatePositionLimits moves the take profit and stop loss of an open multiplier
+async function updatePositionLimits(contractId, account) {
+    const input = prompt(`New take profit and stop loss for contract ${contractId} (e.g. "5, 3"; leave one empty to keep it):`);
+    if (input === null) return;
+    const [takeProfit, stopLoss] = input.split(',').map(v => parseFloat(v) || 0);
+    try {
+        const response = await fetch('/api/trade/limits', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ contract_id: contractId, account, take_profit: takeProfit, stop_loss: stopLoss })
+        });
+        if (!response.ok) throw new Error(await response.text());
+        appendLog(`Contract ${contractId} limits updated`, 'success');
+    } catch (error) {
+        appendLog(`Failed to update contract ${contractId} limits: ${error.message}`, 'error');
+    }
+}
+
+// Manual Trade
+let manualProposalId = null;
+
+function initManualTrade() {
+    document.getElementById('manualQuoteBtn').addEventListener('click', requestManualQuote);
+    document.getElementById('manualBuyBtn').addEventListener('click', buyManualQuote);
+    ['manualContractType', 'manualAccount'].forEach(id => {
+        document.getElementById(id).addEventListener('change', () => {
+            manualProposalId = null;
+            document.getElementById('manualBuyBtn').disabled = true;
+        });
+    });
+    loadManualPositions();
+    setInterval(loadManualPositions, 2000);
+}
+
+function readManualOrder() {
+    const contractType = document.getElementById('manualContractType').value;
+    const extra = document.getElementById('manualBarrier').value.trim();
+    const order = {
+        account: document.getElementById('manualAccount').value,
+        contract_type: contractType,
+        symbol: document.getElementById('configSymbol').value,
+        stake: parseFloat(document.getElementById('manualStake').value),
+        duration: parseInt(document.getElementById('manualDuration').value),
+        duration_unit: 't'
+    };
+    if (contractType.startsWith('MULT')) {
+        order.multiplier = parseInt(extra) || 100;
+        delete order.duration;
+        delete order.duration_unit;
+    } else if (['DIGITMATCH', 'DIGITDIFF', 'DIGITOVER', 'DIGITUNDER'].includes(contractType)) {
+        order.prediction = parseInt(extra);
+    } else if (extra !== '') {
+        order.barrier = extra;
+    }
+    return order;
+}
+
+async function requestManualQuote() {
+    const quoteEl = document.getElementById('manualQuote');
+    const buyBtn = document.getElementById('manualBuyBtn');
+    buyBtn.disabled = true;
+    manualProposalId = null;
+    try {
+        const response = await fetch('/api/trade/proposal', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(readManualOrder())
+        });
+        if (!response.ok) throw new Error(await response.text());
+        const quote = await response.json();
+        manualProposalId = quote.proposal_id;
+        quoteEl.textContent = `Ask $${quote.ask_price.toFixed(2)} | Payout $${quote.payout.toFixed(2)} | ${quote.longcode}`;
+        buyBtn.disabled = false;
+    } catch (error) {
+        quoteEl.textContent = 'Quote failed: ' + error.message;
+    }
+}
+
+async function buyManualQuote() {
+    if (!manualProposalId) return;
+    const buyBtn = document.getElementById('manualBuyBtn');
+    buyBtn.disabled = true;
+    try {
+        const response = await fetch('/api/trade/buy', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({
+                proposal_id: manualProposalId,
+                account: document.getElementById('manualAccount').value
+            })
+        });
+        if (!response.ok) throw new Error(await response.text());
+        manualProposalId = null;
+        document.getElementById('manualQuote').textContent = 'Bought. Get a new quote to trade again.';
+        loadManualPositions();
+    } catch (error) {
+        document.getElementById('manualQuote').textContent = 'Buy failed: ' + error.message;
+    }
+}
+
+async function sellManualPosition(contractId) {
+    try {
+        const response = await fetch('/api/trade/sell', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({
+                contract_id: contractId,
+                account: document.getElementById('manualAccount').value
+            })
+        });
+        if (!response.ok) throw new Error(await response.text());
+        loadManualPositions();
+    } catch (error) {
+        appendLog(`Manual sell of ${contractId} failed: ${error.message}`, 'error');
+    }
+}
+
+async function loadManualPositions() {
+    try {
+        const account = encodeURIComponent(document.getElementById('manualAccount').value);
+        const response = await fetch(`/api/trade/open?account=${account}`);
+        if (!response.ok) return;
+        const status = await response.json();
+        document.getElementById('manualPnL').textContent = formatCurrency(status.total_pnl);
+        const list = document.getElementById('manualPositions');
+        list.innerHTML = '';
+        if (status.stop_reason) {
+            list.innerHTML = `<div class="list-group-item bg-transparent text-danger small">Stopped: ${escapeHtml(status.stop_reason)}</div>`;
+        }
+        status.positions.forEach(p => {
+            const item = document.createElement('div');
+            item.className = 'list-group-item d-flex justify-content-between align-items-center bg-transparent small';
+            item.innerHTML = `
+                <span>${escapeHtml(p.contract_type)} #${p.contract_id}</span>
+                <span class="${p.profit >= 0 ? 'text-success' : 'text-danger'}">${formatCurrency(p.profit)}</span>
+                <button class="btn btn-sm btn-outline-danger" ${p.valid_to_sell ? '' : 'disabled'}>Sell</button>
+            `;
+            item.querySelector('button').addEventListener('click', () => sellManualPosition(p.contract_id));
+            list.appendChild(item);
+        });
+    } catch (error) {
+        console.error('Error loading manual positions:', error);
+    }
+}
+
 // Theme Management
 function initTheme() {
     const toggleBtn = document.getElementById('themeToggleBtn');
@@ -1631,3 +2278,176 @@ function updateChartsTheme(theme) {
     updateChart(winLossChart);
     updateChart(profitDistChart);
 }
+
+// Strategy Parameters
+async function loadStrategyParams(name) {
+    renderStrategyParams([], {});
+    if (name.endsWith('.xml')) return;
+    try {
+        const response = await fetch(`/api/strategies/params?name=${encodeURIComponent(name)}`);
+        if (!response.ok) throw new Error(await response.text());
+        const data = await response.json();
+        renderStrategyParams(data.schema, data.values);
+    } catch (error) {
+        appendLog(`Failed to load strategy parameters: ${error.message}`, 'error');
+    }
+}
+
+function renderStrategyParams(schema, values) {
+    const panel = document.getElementById('strategyParamsPanel');
+    const form = document.getElementById('strategyParamsForm');
+    if (!panel || !form) return;
+
+    if (!schema || schema.length === 0) {
+        form.innerHTML = '';
+        panel.classList.add('d-none');
+        return;
+    }
+
+    // Names, descriptions and defaults come from the script, so they are
+    // set as text and properties rather than HTML
+    form.innerHTML = '';
+    schema.forEach(p => {
+        const value = values && values[p.name] !== undefined ? values[p.name] : p.default;
+        let input;
+        if (p.type === 'boolean') {
+            input = document.createElement('select');
+            input.className = 'form-select form-select-sm';
+            ['true', 'false'].forEach(v => {
+                const option = document.createElement('option');
+                option.value = v;
+                option.textContent = v;
+                input.appendChild(option);
+            });
+            input.value = value ? 'true' : 'false';
+        } else {
+            input = document.createElement('input');
+            input.className = 'form-control form-control-sm';
+            if (p.type === 'string') {
+                input.type = 'text';
+            } else {
+                input.type = 'number';
+                input.step = p.type === 'integer' ? '1' : 'any';
+                if (p.min !== undefined) input.min = p.min;
+                if (p.max !== undefined) input.max = p.max;
+            }
+            input.value = value !== undefined && value !== null ? value : '';
+        }
+        input.dataset.param = p.name;
+        input.dataset.type = p.type;
+
+        const col = document.createElement('div');
+        col.className = 'col-auto';
+        if (p.description) col.title = p.description;
+        const label = document.createElement('label');
+        label.className = 'form-label small text-muted mb-0';
+        label.textContent = p.name;
+        col.append(label, input);
+        form.appendChild(col);
+    });
+    panel.classList.remove('d-none');
+}
+
+function getStrategyParamValues() {
+    const values = {};
+    document.querySelectorAll('#strategyParamsForm [data-param]').forEach(el => {
+        const type = el.dataset.type;
+        if (type === 'boolean') values[el.dataset.param] = el.value === 'true';
+        else if (type === 'string') values[el.dataset.param] = el.value;
+        else if (el.value !== '') values[el.dataset.param] = parseFloat(el.value);
+    });
+    return Object.keys(values).length > 0 ? values : undefined;
+}
+
+// Strategy Version History
+async function showStrategyHistory() {
+    const name = document.getElementById('currentStrategyName').textContent.trim();
+    if (name === 'Untitled') {
+        alert('Save or load a strategy first');
+        return;
+    }
+
+    const list = document.getElementById('strategyVersionList');
+    const diffView = document.getElementById('strategyDiffView');
+    diffView.classList.add('d-none');
+    list.innerHTML = '<div class="text-center p-3 text-muted small">Loading...</div>';
+    new bootstrap.Modal(document.getElementById('strategyHistoryModal')).show();
+
+    try {
+        const response = await fetch(`/api/strategies/versions?name=${encodeURIComponent(name)}`);
+        if (!response.ok) throw new Error(await response.text());
+        const versions = await response.json();
+        if (!versions || versions.length === 0) {
+            list.innerHTML = '<div class="text-center p-3 text-muted small">No versions recorded</div>';
+            return;
+        }
+        // Notes and names are free text, so they are set as text and the
+        // buttons get listeners rather than inline handlers
+        list.innerHTML = '';
+        versions.forEach(v => {
+            const item = document.createElement('div');
+            item.className = 'list-group-item d-flex justify-content-between align-items-center';
+            item.innerHTML = `
+                <div>
+                    <span class="fw-bold"></span>
+                    <span class="text-muted small ms-2"></span>
+                    <code class="small ms-2"></code>
+                    <div class="small"></div>
+                </div>
+                <div class="d-flex gap-1">
+                    <button class="btn btn-sm btn-outline-secondary">Diff</button>
+                    <button class="btn btn-sm btn-outline-primary">Restore</button>
+                </div>`;
+            const [version, time, hash, note] = item.querySelectorAll('span, code, div.small');
+            version.textContent = `v${v.version}`;
+            time.textContent = new Date(v.timestamp).toLocaleString();
+            hash.textContent = v.hash.substring(0, 8);
+            note.textContent = v.note || '';
+            const [diffBtn, restoreBtn] = item.querySelectorAll('button');
+            diffBtn.addEventListener('click', () => showStrategyDiff(name, v.version));
+            restoreBtn.addEventListener('click', () => restoreStrategyVersion(name, v.version));
+            list.appendChild(item);
+        });
+    } catch (error) {
+        list.innerHTML = '<div class="text-danger small p-2"></div>';
+        list.firstChild.textContent = error.message;
+    }
+}
+
+window.showStrategyDiff = async function (name, version) {
+    const diffView = document.getElementById('strategyDiffView');
+    try {
+        const response = await fetch(`/api/strategies/diff?name=${encodeURIComponent(name)}&from=${version}`);
+        if (!response.ok) throw new Error(await response.text());
+        const diff = await response.json();
+        diffView.innerHTML = '';
+        diff.lines.forEach(l => {
+            const line = document.createElement('div');
+            line.textContent = `${l.op} ${l.text}`;
+            if (l.op === '+') line.className = 'text-success';
+            if (l.op === '-') line.className = 'text-danger';
+            diffView.appendChild(line);
+        });
+        diffView.classList.remove('d-none');
+    } catch (error) {
+        appendLog(`Failed to load diff: ${error.message}`, 'error');
+    }
+};
+
+window.restoreStrategyVersion = async function (name, version) {
+    if (!confirm(`Restore ${name} to version ${version}?`)) return;
+    try {
+        const response = await fetch('/api/strategies/restore', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ name, version })
+        });
+        if (!response.ok) throw new Error(await response.text());
+        appendLog(`Restored ${name} to version ${version}`, 'success');
+        bootstrap.Modal.getInstance(document.getElementById('strategyHistoryModal')).hide();
+        await loadStrategyContent(name);
+        loadSavedStrategies();
+    } catch (error) {
+        appendLog(`Failed to restore strategy: ${error.message}`, 'error');
+    }
+};